@@ -0,0 +1,440 @@
+// Package alert evaluates declarative rules on the vote counts of topics,
+// such as "any topic reaches 50 net votes", and sends an alert when a rule
+// starts to hold.
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+)
+
+// Metric is a value computed from the vote counts of a topic
+type Metric string
+
+// Metrics
+const (
+	Upvote   Metric = "upvote"
+	Downvote Metric = "downvote"
+	// Net is the upvotes less the downvotes
+	Net Metric = "net"
+	// Total is the upvotes and the downvotes
+	Total Metric = "total"
+	// DownvoteRatio is the downvotes per upvote, infinite for downvotes
+	// without upvotes
+	DownvoteRatio Metric = "downvoteRatio"
+)
+
+// Of returns the metric of the vote counts
+func (m Metric) Of(upvote, downvote uint64) float64 {
+	switch m {
+	case Upvote:
+		return float64(upvote)
+	case Downvote:
+		return float64(downvote)
+	case Net:
+		return float64(upvote) - float64(downvote)
+	case Total:
+		return float64(upvote) + float64(downvote)
+	case DownvoteRatio:
+		if upvote == 0 {
+			if downvote == 0 {
+				return 0
+			}
+			return math.Inf(1)
+		}
+		return float64(downvote) / float64(upvote)
+	}
+	return math.NaN()
+}
+
+// Op compares a metric to the value of a rule
+type Op string
+
+// Operators
+const (
+	Greater      Op = ">"
+	GreaterEqual Op = ">="
+	Less         Op = "<"
+	LessEqual    Op = "<="
+	Equal        Op = "=="
+)
+
+// holds returns whether "x op y" holds
+func (op Op) holds(x, y float64) bool {
+	switch op {
+	case Greater:
+		return x > y
+	case GreaterEqual:
+		return x >= y
+	case Less:
+		return x < y
+	case LessEqual:
+		return x <= y
+	case Equal:
+		return x == y
+	}
+	return false
+}
+
+var metrics = map[Metric]bool{Upvote: true, Downvote: true, Net: true, Total: true, DownvoteRatio: true}
+
+var ops = map[Op]bool{Greater: true, GreaterEqual: true, Less: true, LessEqual: true, Equal: true}
+
+// ErrRuleNotFound is returned for an unknown rule id
+var ErrRuleNotFound = errors.New("alert rule not found")
+
+// maxRuleNameLen bounds the rule names
+const maxRuleNameLen = 100
+
+// Rule alerts when "metric op value" starts to hold for a topic, e.g.
+// {"metric": "net", "op": ">=", "value": 50}
+type Rule struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	// Topic limits the rule to a topic, nil watches every topic
+	Topic  *uuid.UUID `json:"topic,omitempty"`
+	Metric Metric     `json:"metric"`
+	Op     Op         `json:"op"`
+	Value  float64    `json:"value"`
+	// Callback is an http(s) URL the alerts of the rule are posted to, its
+	// host must be one of the callback hosts of the engine
+	Callback string `json:"callback,omitempty"`
+}
+
+// Check returns an error when the rule is invalid
+func (r *Rule) Check() error {
+	if r.Name == "" || len(r.Name) > maxRuleNameLen {
+		return fmt.Errorf("name must have 1 to %d characters", maxRuleNameLen)
+	}
+	if !metrics[r.Metric] {
+		return fmt.Errorf("invalid metric %q", r.Metric)
+	}
+	if !ops[r.Op] {
+		return fmt.Errorf("invalid op %q", r.Op)
+	}
+	if math.IsNaN(r.Value) || math.IsInf(r.Value, 0) {
+		return errors.New("value must be finite")
+	}
+	if r.Callback != "" {
+		if u, err := url.Parse(r.Callback); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid callback %q", r.Callback)
+		}
+	}
+	return nil
+}
+
+// Alert is a rule which started to hold for a topic
+type Alert struct {
+	ID       uuid.UUID `json:"id"`
+	Time     time.Time `json:"time"`
+	Rule     Rule      `json:"rule"`
+	Topic    uuid.UUID `json:"topic"`
+	Name     string    `json:"name"`
+	Upvote   uint64    `json:"upvote"`
+	Downvote uint64    `json:"downvote"`
+	// Value is the metric of the rule
+	Value float64 `json:"value"`
+}
+
+// MarshalJSON encodes an infinite Value as null, which JSON lacks
+func (a Alert) MarshalJSON() ([]byte, error) {
+	type alert Alert
+	v := struct {
+		alert
+		Value *float64 `json:"value"`
+	}{alert: alert(a)}
+	if !math.IsInf(a.Value, 0) && !math.IsNaN(a.Value) {
+		v.Value = &a.Value
+	}
+	return json.Marshal(v)
+}
+
+// Sink delivers the alerts, it must not block
+type Sink interface {
+	Send(Alert)
+}
+
+// LogSink writes the alerts to a log, such as glog.Warningf
+type LogSink func(format string, args ...interface{})
+
+// Send logs the alert
+func (l LogSink) Send(a Alert) {
+	l("Alert %q on topic %v %q: %v %v %v with %d upvotes and %d downvotes",
+		a.Rule.Name, a.Topic, a.Name, a.Rule.Metric, a.Rule.Op, a.Rule.Value, a.Upvote, a.Downvote)
+}
+
+// CallbackSink posts the alerts of rules with a callback as JSON, a bounded
+// number at a time. Alerts over the bound are dropped, failed posts and
+// redirects are not retried.
+type CallbackSink struct {
+	Client *http.Client
+	// Errorf reports the failed posts when not nil
+	Errorf func(format string, args ...interface{})
+
+	slots chan struct{}
+}
+
+// NewCallbackSink returns a sink posting with timeout, at most concurrency
+// alerts at a time
+func NewCallbackSink(concurrency int, timeout time.Duration) *CallbackSink {
+	client := &http.Client{
+		Timeout: timeout,
+		// A redirect would leave the allowed callback hosts
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return &CallbackSink{Client: client, slots: make(chan struct{}, concurrency)}
+}
+
+// Send posts the alert in the background
+func (s *CallbackSink) Send(a Alert) {
+	if a.Rule.Callback == "" {
+		return
+	}
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		s.errorf("Drop alert %v to %v: too many pending callbacks", a.ID, a.Rule.Callback)
+		return
+	}
+
+	go func() {
+		defer func() { <-s.slots }()
+		if err := s.post(a); err != nil {
+			s.errorf("Post alert %v to %v err: %v", a.ID, a.Rule.Callback, err)
+		}
+	}()
+}
+
+func (s *CallbackSink) post(a Alert) error {
+	body, err := json.Marshal(a)
+	if err != nil {
+		return err
+	}
+	resp, err := s.Client.Post(a.Rule.Callback, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %v", resp.Status)
+	}
+	return nil
+}
+
+func (s *CallbackSink) errorf(format string, args ...interface{}) {
+	if s.Errorf != nil {
+		s.Errorf(format, args...)
+	}
+}
+
+// Engine evaluates the rules on the voted topics. A rule alerts once when
+// it starts to hold for a topic, and again only after it stopped holding.
+// It is safe for concurrent use.
+type Engine struct {
+	// Now returns the current time, it is replaced by tests
+	Now func() time.Time
+	// CallbackHosts are the hosts the rule callbacks may post to, ignoring
+	// case and port. Without hosts rules have no callback.
+	CallbackHosts []string
+
+	sinks []Sink
+	max   int
+
+	mu     sync.Mutex
+	rules  map[uuid.UUID]*Rule
+	order  []uuid.UUID                      // rule ids, the oldest first
+	firing map[uuid.UUID]map[uuid.UUID]bool // topics holding a rule, by rule
+	alerts []Alert                          // the newest last
+}
+
+// New returns an engine without rules keeping the latest max alerts and
+// sending them to the sinks
+func New(max int, sinks ...Sink) *Engine {
+	return &Engine{
+		Now:    time.Now,
+		sinks:  sinks,
+		max:    max,
+		rules:  make(map[uuid.UUID]*Rule),
+		firing: make(map[uuid.UUID]map[uuid.UUID]bool),
+	}
+}
+
+// check returns an error when the rule is invalid or its callback posts to
+// a host which is not allowed
+func (e *Engine) check(r *Rule) error {
+	if err := r.Check(); err != nil {
+		return err
+	}
+	if r.Callback == "" {
+		return nil
+	}
+	u, _ := url.Parse(r.Callback)
+	for _, host := range e.CallbackHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("callback host %q is not allowed", u.Hostname())
+}
+
+// Add adds a rule with a new id and returns it
+func (e *Engine) Add(r Rule) (Rule, error) {
+	if err := e.check(&r); err != nil {
+		return Rule{}, err
+	}
+	r.ID = uuid.New()
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.rules[r.ID] = &r
+	e.order = append(e.order, r.ID)
+	e.firing[r.ID] = make(map[uuid.UUID]bool)
+	return r, nil
+}
+
+// Get returns the rule id
+func (e *Engine) Get(id uuid.UUID) (Rule, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, ok := e.rules[id]
+	if !ok {
+		return Rule{}, false
+	}
+	return *r, true
+}
+
+// Rules returns the rules, the oldest first
+func (e *Engine) Rules() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	rules := make([]Rule, 0, len(e.order))
+	for _, id := range e.order {
+		rules = append(rules, *e.rules[id])
+	}
+	return rules
+}
+
+// Update replaces the rule id, which alerts again for the topics it holds for
+func (e *Engine) Update(id uuid.UUID, r Rule) (Rule, error) {
+	if err := e.check(&r); err != nil {
+		return Rule{}, err
+	}
+	r.ID = id
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, ok := e.rules[id]; !ok {
+		return Rule{}, ErrRuleNotFound
+	}
+	e.rules[id] = &r
+	e.firing[id] = make(map[uuid.UUID]bool)
+	return r, nil
+}
+
+// Delete deletes the rule id
+func (e *Engine) Delete(id uuid.UUID) (Rule, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	r, ok := e.rules[id]
+	if !ok {
+		return Rule{}, ErrRuleNotFound
+	}
+	delete(e.rules, id)
+	delete(e.firing, id)
+	for i, ruleID := range e.order {
+		if ruleID == id {
+			e.order = append(e.order[:i], e.order[i+1:]...)
+			break
+		}
+	}
+	return *r, nil
+}
+
+// Alerts returns the latest alerts, the newest first
+func (e *Engine) Alerts() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := make([]Alert, 0, len(e.alerts))
+	for i := len(e.alerts) - 1; i >= 0; i-- {
+		alerts = append(alerts, e.alerts[i])
+	}
+	return alerts
+}
+
+// Evaluate evaluates the rules on the vote counts of topic t, and sends the
+// alerts of the rules which started to hold
+func (e *Engine) Evaluate(t *cache.Topic) []Alert {
+	var fired []Alert
+
+	e.mu.Lock()
+	for _, id := range e.order {
+		r := e.rules[id]
+		if r.Topic != nil && *r.Topic != t.UID {
+			continue
+		}
+
+		value := r.Metric.Of(t.Upvote, t.Downvote)
+		holds := r.Op.holds(value, r.Value)
+		if holds == e.firing[id][t.UID] {
+			continue
+		}
+		if !holds {
+			delete(e.firing[id], t.UID)
+			continue
+		}
+		e.firing[id][t.UID] = true
+
+		a := Alert{
+			ID:       uuid.New(),
+			Time:     e.Now().UTC(),
+			Rule:     *r,
+			Topic:    t.UID,
+			Name:     t.Name,
+			Upvote:   t.Upvote,
+			Downvote: t.Downvote,
+			Value:    value,
+		}
+		fired = append(fired, a)
+		if len(e.alerts) == e.max {
+			e.alerts = append(e.alerts[:0], e.alerts[1:]...)
+		}
+		e.alerts = append(e.alerts, a)
+	}
+	e.mu.Unlock()
+
+	for _, a := range fired {
+		for _, s := range e.sinks {
+			s.Send(a)
+		}
+	}
+	return fired
+}
+
+// Handle evaluates the rules on the topic of a TopicVoted event
+func (e *Engine) Handle(ev events.Event) {
+	if ev.Type != events.TopicVoted {
+		return
+	}
+	if t, ok := ev.Data.(*cache.Topic); ok {
+		e.Evaluate(t)
+	}
+}
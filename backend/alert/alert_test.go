@@ -0,0 +1,165 @@
+package alert
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+)
+
+// recorder is a sink keeping the alerts
+type recorder []Alert
+
+func (r *recorder) Send(a Alert) {
+	*r = append(*r, a)
+}
+
+func TestMetrics(t *testing.T) {
+	assert.Equal(t, 3.0, Upvote.Of(3, 5))
+	assert.Equal(t, 5.0, Downvote.Of(3, 5))
+	assert.Equal(t, -2.0, Net.Of(3, 5))
+	assert.Equal(t, 8.0, Total.Of(3, 5))
+	assert.Equal(t, 2.5, DownvoteRatio.Of(2, 5))
+	assert.Equal(t, 0.0, DownvoteRatio.Of(0, 0))
+	assert.True(t, math.IsInf(DownvoteRatio.Of(0, 1), 1))
+}
+
+func TestEvaluate(t *testing.T) {
+	var sent recorder
+	e := New(10, &sent)
+
+	net, err := e.Add(Rule{Name: "Popular", Metric: Net, Op: GreaterEqual, Value: 50})
+	assert.Nil(t, err)
+	_, err = e.Add(Rule{Name: "Disliked", Metric: DownvoteRatio, Op: Greater, Value: 2})
+	assert.Nil(t, err)
+
+	topic := &cache.Topic{UID: uuid.New(), Name: "Alerted"}
+	vote := func(upvote, downvote uint64) []Alert {
+		return e.Evaluate(&cache.Topic{UID: topic.UID, Name: topic.Name, Upvote: upvote, Downvote: downvote})
+	}
+
+	assert.Empty(t, vote(49, 0))
+	fired := vote(50, 0)
+	assert.Len(t, fired, 1)
+	assert.Equal(t, "Popular", fired[0].Rule.Name)
+	assert.Equal(t, 50.0, fired[0].Value)
+
+	// Fires once while the rule holds
+	assert.Empty(t, vote(51, 0))
+	assert.Empty(t, vote(60, 9))
+
+	// Fires again after it stopped holding
+	assert.Empty(t, vote(60, 11))
+	assert.Len(t, vote(61, 11), 1)
+
+	// Other topics are evaluated on their own
+	fired = e.Evaluate(&cache.Topic{UID: uuid.New(), Upvote: 1, Downvote: 3})
+	assert.Len(t, fired, 1)
+	assert.Equal(t, "Disliked", fired[0].Rule.Name)
+
+	assert.Len(t, sent, 3)
+	alerts := e.Alerts()
+	assert.Len(t, alerts, 3)
+	assert.Equal(t, "Disliked", alerts[0].Rule.Name)
+
+	// An updated rule alerts again for the topics it holds for
+	_, err = e.Update(net.ID, Rule{Name: "Very popular", Metric: Upvote, Op: Greater, Value: 60})
+	assert.Nil(t, err)
+	fired = vote(61, 11)
+	assert.Len(t, fired, 1)
+	assert.Equal(t, net.ID, fired[0].Rule.ID)
+	assert.Equal(t, "Very popular", fired[0].Rule.Name)
+
+	_, err = e.Delete(net.ID)
+	assert.Nil(t, err)
+	_, err = e.Delete(net.ID)
+	assert.Equal(t, ErrRuleNotFound, err)
+	_, err = e.Update(net.ID, Rule{Name: "Gone", Metric: Upvote, Op: Greater})
+	assert.Equal(t, ErrRuleNotFound, err)
+	assert.Len(t, e.Rules(), 1)
+}
+
+func TestTopicRule(t *testing.T) {
+	e := New(1)
+	uid := uuid.New()
+	_, err := e.Add(Rule{Name: "Watched", Topic: &uid, Metric: Downvote, Op: Equal, Value: 1})
+	assert.Nil(t, err)
+
+	assert.Empty(t, e.Evaluate(&cache.Topic{UID: uuid.New(), Downvote: 1}))
+	e.Handle(events.New(events.TopicCreated, uid, &cache.Topic{UID: uid, Downvote: 1}))
+	assert.Empty(t, e.Alerts())
+	e.Handle(events.New(events.TopicVoted, uid, &cache.Topic{UID: uid, Downvote: 1}))
+	assert.Len(t, e.Alerts(), 1)
+
+	// Only the latest alerts are kept
+	e.Handle(events.New(events.TopicVoted, uid, &cache.Topic{UID: uid, Downvote: 2}))
+	e.Handle(events.New(events.TopicVoted, uid, &cache.Topic{UID: uid, Downvote: 1}))
+	assert.Len(t, e.Alerts(), 1)
+}
+
+func TestCheck(t *testing.T) {
+	for _, r := range []Rule{
+		{Metric: Net, Op: Greater},
+		{Name: "x", Metric: "score", Op: Greater},
+		{Name: "x", Metric: Net, Op: "!="},
+		{Name: "x", Metric: Net, Op: Greater, Value: math.Inf(1)},
+		{Name: "x", Metric: Net, Op: Greater, Callback: "mailto:ops@example.com"},
+		{Name: "x", Metric: Net, Op: Greater, Callback: "http://169.254.169.254/latest"},
+		{Name: "x", Metric: Net, Op: Greater, Callback: "https://hooks.example.com.evil.test/alert"},
+	} {
+		e := New(1)
+		e.CallbackHosts = []string{"hooks.example.com"}
+		_, err := e.Add(r)
+		assert.NotNil(t, err, r)
+	}
+
+	// Without callback hosts rules have no callback
+	_, err := New(1).Add(Rule{Name: "x", Metric: Net, Op: Greater, Callback: "https://hooks.example.com/alert"})
+	assert.NotNil(t, err)
+
+	e := New(1)
+	e.CallbackHosts = []string{"hooks.example.com"}
+	_, err = e.Add(Rule{Name: "x", Metric: Net, Op: Greater, Callback: "https://HOOKS.example.com:8443/alert"})
+	assert.Nil(t, err)
+}
+
+func TestCallbackSink(t *testing.T) {
+	received := make(chan map[string]interface{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		var a map[string]interface{}
+		assert.Nil(t, json.Unmarshal(body, &a))
+		received <- a
+	}))
+	defer srv.Close()
+
+	s := NewCallbackSink(1, time.Second)
+	e := New(10, s)
+	e.CallbackHosts = []string{"127.0.0.1"}
+	_, err := e.Add(Rule{Name: "Disliked", Metric: DownvoteRatio, Op: GreaterEqual, Value: 2, Callback: srv.URL})
+	assert.Nil(t, err)
+	_, err = e.Add(Rule{Name: "Logged only", Metric: Downvote, Op: Greater, Value: 0})
+	assert.Nil(t, err)
+
+	uid := uuid.New()
+	assert.Len(t, e.Evaluate(&cache.Topic{UID: uid, Name: "Bad", Downvote: 1}), 2)
+
+	select {
+	case a := <-received:
+		assert.Equal(t, uid.String(), a["topic"])
+		assert.Equal(t, "Disliked", a["rule"].(map[string]interface{})["name"])
+		// JSON has no infinity
+		assert.Nil(t, a["value"])
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the callback")
+	}
+}
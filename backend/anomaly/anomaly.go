@@ -0,0 +1,490 @@
+// Package anomaly watches the vote stream per topic and per client for
+// scripted voting: bursts, uniform intervals and single client dominance.
+package anomaly
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxFlags bounds the number of flagged topic and client pairs remembered,
+// the least recently flagged pair is forgotten first, after the pairs not
+// holding votes.
+const maxFlags = 10000
+
+// Action defines what happens to a suspicious vote
+type Action int
+
+const (
+	// Accept counts the vote, it is not suspicious
+	Accept Action = iota
+	// Flag counts the vote and records it for review
+	Flag
+	// Quarantine holds the vote until a moderator releases it
+	Quarantine
+	// Discount drops the vote
+	Discount
+)
+
+// String returns the action name
+func (a Action) String() string {
+	switch a {
+	case Accept:
+		return "accept"
+	case Flag:
+		return "flag"
+	case Quarantine:
+		return "quarantine"
+	case Discount:
+		return "discount"
+	}
+	return fmt.Sprintf("Action(%d)", int(a))
+}
+
+// MarshalText encodes the action name
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText decodes the action name
+func (a *Action) UnmarshalText(b []byte) error {
+	v, err := ParseAction(string(b))
+	if err != nil {
+		return err
+	}
+	*a = v
+	return nil
+}
+
+// ParseAction parses the name of an action taken on suspicious votes
+func ParseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "flag":
+		return Flag, nil
+	case "quarantine":
+		return Quarantine, nil
+	case "discount":
+		return Discount, nil
+	}
+	return Accept, fmt.Errorf("unknown anomaly action %q", s)
+}
+
+// Rule names a detection rule
+type Rule string
+
+const (
+	// RuleClientBurst fires when a client votes too often within the window
+	RuleClientBurst Rule = "client-burst"
+	// RuleTopicBurst fires when a topic gets too many votes within the window
+	RuleTopicBurst Rule = "topic-burst"
+	// RuleUniformInterval fires when a client votes at machine-regular intervals
+	RuleUniformInterval Rule = "uniform-interval"
+	// RuleDominance fires when a single client casts most votes of a topic
+	RuleDominance Rule = "single-client-dominance"
+)
+
+// Vote is a vote seen by the detector
+type Vote struct {
+	Topic  uuid.UUID
+	Client string
+	Up     bool
+	At     time.Time
+	// Weight is the number of votes cast at once, 0 counts as 1
+	Weight uint64
+}
+
+// Decision is the action taken on a vote and the rules which fired
+type Decision struct {
+	Action Action
+	Rules  []Rule
+}
+
+// Config is the JSON configuration of a Detector, a zero limit disables
+// its rule
+type Config struct {
+	// Window is the duration bursts and dominance are measured over
+	Window string `json:"window"`
+	// History is how long a client's vote intervals are remembered
+	History string `json:"history"`
+	// MaxClientVotes is the most votes a client may cast within the window
+	MaxClientVotes int `json:"maxClientVotes"`
+	// MaxTopicVotes is the most votes a topic may get within the window
+	MaxTopicVotes int `json:"maxTopicVotes"`
+	// UniformSamples is the number of consecutive intervals of a client
+	// checked for regularity
+	UniformSamples int `json:"uniformSamples"`
+	// UniformJitter is the coefficient of variation of the intervals
+	// below which they look scripted
+	UniformJitter float64 `json:"uniformJitter"`
+	// DominanceMinVotes is the topic votes within the window needed
+	// before dominance is checked
+	DominanceMinVotes int `json:"dominanceMinVotes"`
+	// DominanceShare is the share of a topic's votes within the window
+	// above which a single client dominates it
+	DominanceShare float64 `json:"dominanceShare"`
+	// Action is "flag", "quarantine" or "discount"
+	Action string `json:"action"`
+}
+
+// DefaultConfig flags clients voting more than once a second on average,
+// at regular intervals, or casting most votes of a busy topic
+func DefaultConfig() Config {
+	return Config{
+		Window:            "1m",
+		History:           "1h",
+		MaxClientVotes:    60,
+		UniformSamples:    10,
+		UniformJitter:     0.05,
+		DominanceMinVotes: 30,
+		DominanceShare:    0.5,
+		Action:            "flag",
+	}
+}
+
+// Suspect is a topic and client pair which cast suspicious votes
+type Suspect struct {
+	ID            uuid.UUID `json:"id"`
+	Topic         uuid.UUID `json:"topic"`
+	Client        string    `json:"client"`
+	Rules         []Rule    `json:"rules"`
+	Action        Action    `json:"action"`
+	Votes         int       `json:"votes"`
+	HeldUpvotes   uint64    `json:"heldUpvotes"`
+	HeldDownvotes uint64    `json:"heldDownvotes"`
+	FirstAt       time.Time `json:"firstAt"`
+	LastAt        time.Time `json:"lastAt"`
+}
+
+type flagKey struct {
+	topic  uuid.UUID
+	client string
+}
+
+type clientVote struct {
+	client string
+	at     time.Time
+}
+
+// topicWindow holds the votes of a topic within the window
+type topicWindow struct {
+	votes  []clientVote
+	counts map[string]int
+}
+
+// Detector watches the vote stream. It is safe for concurrent use.
+type Detector struct {
+	// Errorf reports the held votes dropped with a forgotten suspect when
+	// not nil
+	Errorf func(format string, args ...interface{})
+
+	window  time.Duration
+	history time.Duration
+	cfg     Config
+	action  Action
+
+	mu        sync.Mutex
+	clients   map[string][]time.Time
+	topics    map[uuid.UUID]*topicWindow
+	flags     map[flagKey]*Suspect
+	lastSweep time.Time
+}
+
+// New creates a Detector from its configuration
+func New(cfg Config) (*Detector, error) {
+	d := &Detector{
+		cfg:     cfg,
+		clients: make(map[string][]time.Time),
+		topics:  make(map[uuid.UUID]*topicWindow),
+		flags:   make(map[flagKey]*Suspect),
+	}
+
+	var err error
+	if d.window, err = time.ParseDuration(cfg.Window); err != nil || d.window <= 0 {
+		return nil, fmt.Errorf("invalid anomaly window %q", cfg.Window)
+	}
+	if d.history, err = time.ParseDuration(cfg.History); err != nil || d.history < d.window {
+		return nil, fmt.Errorf("invalid anomaly history %q", cfg.History)
+	}
+	if d.action, err = ParseAction(cfg.Action); err != nil {
+		return nil, err
+	}
+	if cfg.MaxClientVotes < 0 || cfg.MaxTopicVotes < 0 || cfg.UniformSamples < 0 || cfg.DominanceMinVotes < 0 {
+		return nil, fmt.Errorf("anomaly limits must not be negative")
+	}
+	if cfg.UniformSamples == 1 {
+		return nil, fmt.Errorf("anomaly uniformSamples must be at least 2")
+	}
+	if cfg.DominanceShare < 0 || cfg.DominanceShare >= 1 {
+		return nil, fmt.Errorf("anomaly dominanceShare must be within [0, 1)")
+	}
+	return d, nil
+}
+
+// Load reads a Detector configuration in JSON, omitted fields keep
+// their DefaultConfig value
+func Load(r io.Reader) (*Detector, error) {
+	cfg := DefaultConfig()
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// LoadFile reads a Detector configuration JSON file
+func LoadFile(path string) (*Detector, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Observe records vote v and decides whether it is counted. Votes must be
+// observed in time order.
+func (d *Detector) Observe(v Vote) Decision {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.sweep(v.At)
+
+	var rules []Rule
+	if d.observeClient(v) {
+		rules = append(rules, RuleClientBurst)
+	}
+	if d.uniform(v.Client) {
+		rules = append(rules, RuleUniformInterval)
+	}
+	topicBurst, dominance := d.observeTopic(v)
+	if topicBurst {
+		rules = append(rules, RuleTopicBurst)
+	}
+	if dominance {
+		rules = append(rules, RuleDominance)
+	}
+
+	if len(rules) == 0 {
+		return Decision{Action: Accept}
+	}
+	d.flag(v, rules)
+	return Decision{Action: d.action, Rules: rules}
+}
+
+// observeClient records the vote time of the client and reports whether
+// the client exceeds its vote limit within the window
+func (d *Detector) observeClient(v Vote) bool {
+	// Only the timestamps the rules look at are kept
+	keep := d.cfg.MaxClientVotes + 1
+	if d.cfg.UniformSamples+1 > keep {
+		keep = d.cfg.UniformSamples + 1
+	}
+
+	times := append(d.clients[v.Client], v.At)
+	if len(times) > keep {
+		times = append(times[:0], times[len(times)-keep:]...)
+	}
+	d.clients[v.Client] = times
+
+	n := d.cfg.MaxClientVotes
+	return n > 0 && len(times) > n && v.At.Sub(times[len(times)-n-1]) < d.window
+}
+
+// uniform reports whether the last intervals between the client's votes
+// are too regular to be cast by a human
+func (d *Detector) uniform(client string) bool {
+	n := d.cfg.UniformSamples
+	times := d.clients[client]
+	if n == 0 || len(times) < n+1 {
+		return false
+	}
+	times = times[len(times)-n-1:]
+
+	var sum float64
+	intervals := make([]float64, n)
+	for i := range intervals {
+		intervals[i] = times[i+1].Sub(times[i]).Seconds()
+		sum += intervals[i]
+	}
+	mean := sum / float64(n)
+	if mean <= 0 {
+		// Simultaneous votes are left to the burst rules
+		return false
+	}
+
+	var variance float64
+	for _, interval := range intervals {
+		variance += (interval - mean) * (interval - mean)
+	}
+	variance /= float64(n)
+	return math.Sqrt(variance)/mean <= d.cfg.UniformJitter
+}
+
+// observeTopic records the vote in the topic window and reports whether
+// the topic gets too many votes and whether the client dominates it
+func (d *Detector) observeTopic(v Vote) (bool, bool) {
+	w, ok := d.topics[v.Topic]
+	if !ok {
+		w = &topicWindow{counts: make(map[string]int)}
+		d.topics[v.Topic] = w
+	}
+	w.prune(v.At.Add(-d.window))
+	w.votes = append(w.votes, clientVote{client: v.Client, at: v.At})
+	w.counts[v.Client]++
+
+	total := len(w.votes)
+	burst := d.cfg.MaxTopicVotes > 0 && total > d.cfg.MaxTopicVotes
+	dominance := d.cfg.DominanceMinVotes > 0 && total >= d.cfg.DominanceMinVotes &&
+		float64(w.counts[v.Client]) > d.cfg.DominanceShare*float64(total)
+	return burst, dominance
+}
+
+// prune drops the votes cast before since
+func (w *topicWindow) prune(since time.Time) {
+	i := 0
+	for ; i < len(w.votes) && w.votes[i].at.Before(since); i++ {
+		if w.counts[w.votes[i].client]--; w.counts[w.votes[i].client] == 0 {
+			delete(w.counts, w.votes[i].client)
+		}
+	}
+	w.votes = append(w.votes[:0], w.votes[i:]...)
+}
+
+// sweep forgets idle clients and topics, at most once per window
+func (d *Detector) sweep(now time.Time) {
+	if now.Sub(d.lastSweep) < d.window {
+		return
+	}
+	d.lastSweep = now
+
+	for client, times := range d.clients {
+		if now.Sub(times[len(times)-1]) > d.history {
+			delete(d.clients, client)
+		}
+	}
+	for uid, w := range d.topics {
+		if w.prune(now.Add(-d.window)); len(w.votes) == 0 {
+			delete(d.topics, uid)
+		}
+	}
+}
+
+// flag records a suspicious vote
+func (d *Detector) flag(v Vote, rules []Rule) {
+	key := flagKey{topic: v.Topic, client: v.Client}
+	f, ok := d.flags[key]
+	if !ok {
+		if len(d.flags) >= maxFlags {
+			d.evict()
+		}
+		f = &Suspect{ID: uuid.New(), Topic: v.Topic, Client: v.Client, FirstAt: v.At}
+		d.flags[key] = f
+	}
+
+	f.Action = d.action
+	f.Votes++
+	f.LastAt = v.At
+	for _, rule := range rules {
+		if !hasRule(f.Rules, rule) {
+			f.Rules = append(f.Rules, rule)
+		}
+	}
+	if d.action == Quarantine {
+		weight := v.Weight
+		if weight == 0 {
+			weight = 1
+		}
+		if v.Up {
+			f.HeldUpvotes += weight
+		} else {
+			f.HeldDownvotes += weight
+		}
+	}
+}
+
+// evict forgets the least recently flagged pair, pairs holding votes are
+// only forgotten when every pair holds votes and their drop is reported
+func (d *Detector) evict() {
+	var oldest flagKey
+	var found, holding bool
+	for key, f := range d.flags {
+		held := f.HeldUpvotes > 0 || f.HeldDownvotes > 0
+		if !found || holding && !held || holding == held && f.LastAt.Before(d.flags[oldest].LastAt) {
+			oldest, found, holding = key, true, held
+		}
+	}
+
+	f := d.flags[oldest]
+	delete(d.flags, oldest)
+	if holding && d.Errorf != nil {
+		d.Errorf("Anomaly %v forgotten: dropped %d held upvotes and %d held downvotes of topic %v from %v",
+			f.ID, f.HeldUpvotes, f.HeldDownvotes, f.Topic, f.Client)
+	}
+}
+
+func hasRule(rules []Rule, rule Rule) bool {
+	for _, r := range rules {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
+
+// Suspects returns a copy of the flagged pairs, the most recently flagged first
+func (d *Detector) Suspects() []Suspect {
+	d.mu.Lock()
+	flags := make([]Suspect, 0, len(d.flags))
+	for _, f := range d.flags {
+		c := *f
+		c.Rules = append([]Rule(nil), f.Rules...)
+		flags = append(flags, c)
+	}
+	d.mu.Unlock()
+
+	sort.Slice(flags, func(i, j int) bool {
+		if !flags[i].LastAt.Equal(flags[j].LastAt) {
+			return flags[i].LastAt.After(flags[j].LastAt)
+		}
+		return flags[i].ID.String() < flags[j].ID.String()
+	})
+	return flags
+}
+
+// Resolve forgets the suspect with the given id, it returns the suspect so
+// that the caller may count its held votes. The rules keep watching the client.
+func (d *Detector) Resolve(id uuid.UUID) (Suspect, bool) {
+	s, ok, _ := d.ResolveWith(id, nil)
+	return s, ok
+}
+
+// ResolveWith forgets the suspect with the given id once count, unless nil,
+// counted its held votes, so that they are counted once. The suspect is kept
+// when count fails, its error is returned.
+func (d *Detector) ResolveWith(id uuid.UUID, count func(Suspect) error) (Suspect, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for key, f := range d.flags {
+		if f.ID != id {
+			continue
+		}
+		if count != nil {
+			if err := count(*f); err != nil {
+				return *f, true, err
+			}
+		}
+		delete(d.flags, key)
+		return *f, true, nil
+	}
+	return Suspect{}, false, nil
+}
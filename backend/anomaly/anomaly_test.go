@@ -0,0 +1,177 @@
+package anomaly
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newDetector(t *testing.T, cfg Config) *Detector {
+	d, err := New(cfg)
+	assert.Nil(t, err)
+	return d
+}
+
+// disabled returns a configuration with every rule disabled
+func disabled() Config {
+	return Config{Window: "1m", History: "1h", Action: "flag"}
+}
+
+func TestClientBurst(t *testing.T) {
+	cfg := disabled()
+	cfg.MaxClientVotes = 3
+	d := newDetector(t, cfg)
+
+	topic := uuid.New()
+	for i := 0; i < 3; i++ {
+		decision := d.Observe(Vote{Topic: topic, Client: "a", Up: true, At: epoch.Add(time.Duration(i) * time.Second)})
+		assert.Equal(t, Decision{Action: Accept}, decision)
+	}
+	decision := d.Observe(Vote{Topic: topic, Client: "a", Up: true, At: epoch.Add(3 * time.Second)})
+	assert.Equal(t, Decision{Action: Flag, Rules: []Rule{RuleClientBurst}}, decision)
+
+	// Other clients and later votes are not affected
+	assert.Equal(t, Accept, d.Observe(Vote{Topic: topic, Client: "b", At: epoch.Add(4 * time.Second)}).Action)
+	assert.Equal(t, Accept, d.Observe(Vote{Topic: topic, Client: "a", At: epoch.Add(2 * time.Minute)}).Action)
+}
+
+func TestTopicBurstAndDominance(t *testing.T) {
+	cfg := disabled()
+	cfg.MaxTopicVotes = 5
+	cfg.DominanceMinVotes = 4
+	cfg.DominanceShare = 0.5
+	d := newDetector(t, cfg)
+
+	topic := uuid.New()
+	for i, client := range []string{"a", "b", "c"} {
+		assert.Equal(t, Accept, d.Observe(Vote{Topic: topic, Client: client, At: epoch.Add(time.Duration(i) * time.Second)}).Action)
+	}
+	// a has 2 of 4 votes, which is not above half
+	assert.Equal(t, Accept, d.Observe(Vote{Topic: topic, Client: "a", At: epoch.Add(3 * time.Second)}).Action)
+	assert.Equal(t, []Rule{RuleDominance}, d.Observe(Vote{Topic: topic, Client: "a", At: epoch.Add(4 * time.Second)}).Rules)
+	assert.Equal(t, []Rule{RuleTopicBurst}, d.Observe(Vote{Topic: topic, Client: "d", At: epoch.Add(5 * time.Second)}).Rules)
+
+	// The window slides
+	assert.Equal(t, Accept, d.Observe(Vote{Topic: topic, Client: "a", At: epoch.Add(2 * time.Minute)}).Action)
+}
+
+func TestUniformInterval(t *testing.T) {
+	cfg := disabled()
+	cfg.UniformSamples = 4
+	cfg.UniformJitter = 0.05
+	d := newDetector(t, cfg)
+
+	topic := uuid.New()
+	var decision Decision
+	for i := 0; i < 5; i++ {
+		decision = d.Observe(Vote{Topic: topic, Client: "bot", At: epoch.Add(time.Duration(i) * 10 * time.Second)})
+	}
+	assert.Equal(t, []Rule{RuleUniformInterval}, decision.Rules)
+
+	// Irregular intervals look human
+	at := epoch
+	for _, seconds := range []int{3, 17, 8, 41, 12} {
+		at = at.Add(time.Duration(seconds) * time.Second)
+		decision = d.Observe(Vote{Topic: topic, Client: "human", At: at})
+	}
+	assert.Equal(t, Accept, decision.Action)
+}
+
+func TestQuarantineSuspects(t *testing.T) {
+	cfg := disabled()
+	cfg.MaxClientVotes = 1
+	cfg.Action = "quarantine"
+	d := newDetector(t, cfg)
+
+	topic1, topic2 := uuid.New(), uuid.New()
+	d.Observe(Vote{Topic: topic1, Client: "a", Up: true, At: epoch})
+	d.Observe(Vote{Topic: topic1, Client: "a", Up: true, At: epoch.Add(time.Second)})
+	d.Observe(Vote{Topic: topic1, Client: "a", Up: false, At: epoch.Add(2 * time.Second), Weight: 3})
+	decision := d.Observe(Vote{Topic: topic2, Client: "a", Up: true, At: epoch.Add(3 * time.Second)})
+	assert.Equal(t, Quarantine, decision.Action)
+
+	suspects := d.Suspects()
+	assert.Len(t, suspects, 2)
+	assert.Equal(t, topic2, suspects[0].Topic)
+	assert.Equal(t, topic1, suspects[1].Topic)
+	assert.Equal(t, 2, suspects[1].Votes)
+	assert.Equal(t, uint64(1), suspects[1].HeldUpvotes)
+	assert.Equal(t, uint64(3), suspects[1].HeldDownvotes)
+	assert.Equal(t, epoch.Add(time.Second), suspects[1].FirstAt)
+
+	// A failed count keeps the suspect
+	failed := errors.New("topic closed")
+	_, ok, err := d.ResolveWith(suspects[1].ID, func(Suspect) error { return failed })
+	assert.True(t, ok)
+	assert.Equal(t, failed, err)
+	assert.Len(t, d.Suspects(), 2)
+
+	resolved, ok := d.Resolve(suspects[1].ID)
+	assert.True(t, ok)
+	assert.Equal(t, suspects[1], resolved)
+	assert.Len(t, d.Suspects(), 1)
+
+	_, ok = d.Resolve(suspects[1].ID)
+	assert.False(t, ok)
+}
+
+func TestEvictHeldVotes(t *testing.T) {
+	cfg := disabled()
+	cfg.Action = "quarantine"
+	d := newDetector(t, cfg)
+	var dropped []string
+	d.Errorf = func(format string, args ...interface{}) {
+		dropped = append(dropped, fmt.Sprintf(format, args...))
+	}
+
+	// The pairs holding votes outlive the least recently flagged ones
+	topic := uuid.New()
+	d.flag(Vote{Topic: topic, Client: "held", Up: true, At: epoch}, []Rule{RuleClientBurst})
+	d.action = Flag
+	for i := 1; i <= maxFlags; i++ {
+		d.flag(Vote{Topic: topic, Client: strconv.Itoa(i), At: epoch.Add(time.Duration(i) * time.Second)}, []Rule{RuleClientBurst})
+	}
+	assert.Len(t, d.flags, maxFlags)
+	assert.Contains(t, d.flags, flagKey{topic: topic, client: "held"})
+	assert.NotContains(t, d.flags, flagKey{topic: topic, client: "1"})
+	assert.Empty(t, dropped)
+
+	// Once every pair holds votes, the dropped votes are reported
+	for _, f := range d.flags {
+		f.HeldDownvotes++
+	}
+	d.flag(Vote{Topic: topic, Client: "a", At: epoch.Add(time.Hour)}, []Rule{RuleClientBurst})
+	assert.NotContains(t, d.flags, flagKey{topic: topic, client: "held"})
+	assert.Len(t, dropped, 1)
+	assert.Contains(t, dropped[0], "dropped 1 held upvotes and 1 held downvotes of topic "+topic.String()+" from held")
+}
+
+func TestLoad(t *testing.T) {
+	d, err := Load(strings.NewReader(`{"action": "discount", "maxClientVotes": 0}`))
+	assert.Nil(t, err)
+	assert.Equal(t, Discount, d.action)
+	assert.Equal(t, time.Minute, d.window)
+	assert.Equal(t, 0, d.cfg.MaxClientVotes)
+	assert.Equal(t, DefaultConfig().UniformSamples, d.cfg.UniformSamples)
+
+	for _, input := range []string{
+		`{"action": "ban"}`,
+		`{"window": "soon"}`,
+		`{"window": "2h"}`,
+		`{"dominanceShare": 1}`,
+		`{"uniformSamples": 1}`,
+		`{"maxTopicVotes": -1}`,
+		`[`,
+	} {
+		_, err := Load(strings.NewReader(input))
+		assert.NotNil(t, err, input)
+	}
+}
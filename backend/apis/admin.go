@@ -0,0 +1,118 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+// maxImportSize limits the request body accepted by the import API.
+const maxImportSize = 32 << 20
+
+// exportTopics streams all topics as NDJSON (default) or CSV.
+func exportTopics(c *gin.Context) {
+	format, err := cache.ParseSnapshotFormat(c.Query("format"))
+	if err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid export format"})
+		return
+	}
+
+	topics := cache.ExportTopics()
+
+	switch format {
+	case cache.FormatCSV:
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	default:
+		c.Header("Content-Type", "application/x-ndjson")
+	}
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=topics.%s", format))
+	c.Status(http.StatusOK)
+
+	if err := cache.WriteSnapshot(c.Writer, format, topics); err != nil {
+		// Headers are already sent, the client sees a truncated dump.
+		glog.Errorf("Export topics err: %v", err)
+	}
+}
+
+// importTopics validates a NDJSON or CSV dump and loads it into the cache.
+// Nothing is imported when any record is invalid.
+func importTopics(c *gin.Context) {
+	format, err := cache.ParseSnapshotFormat(importFormat(c))
+	if err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid import format"})
+		return
+	}
+
+	mode, err := cache.ParseConflictMode(c.Query("mode"))
+	if err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid conflict mode"})
+		return
+	}
+
+	body := http.MaxBytesReader(c.Writer, c.Request.Body, maxImportSize)
+	topics, err := cache.ReadSnapshot(body, format)
+	if err != nil {
+		glog.Errorf("Read import dump err: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid import dump", "error": err.Error()})
+		return
+	}
+
+	if err := validateImport(topics); err != nil {
+		glog.Errorf("Validate import dump err: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid import dump", "error": err.Error()})
+		return
+	}
+
+	result := cache.ImportTopics(topics, mode)
+	glog.Infof("Imported %d topics with mode %v: %+v", len(topics), mode, result)
+	recordAudit(c, audit.Entry{Action: "topics.import", Reason: string(mode), After: result})
+
+	c.JSON(http.StatusOK, result)
+}
+
+// importFormat returns the format query parameter, falling back to the
+// request Content-Type.
+func importFormat(c *gin.Context) string {
+	if format := c.Query("format"); format != "" {
+		return format
+	}
+	if strings.HasPrefix(c.ContentType(), "text/csv") {
+		return string(cache.FormatCSV)
+	}
+	return string(cache.FormatNDJSON)
+}
+
+// validateImport applies the createTopic rules to every record of a dump.
+func validateImport(topics []cache.Topic) error {
+	seen := make(map[uuid.UUID]bool, len(topics))
+	for i := range topics {
+		t := &topics[i]
+		if t.UID == uuid.Nil {
+			return fmt.Errorf("record %d: missing uid", i+1)
+		}
+		if seen[t.UID] {
+			return fmt.Errorf("record %d: duplicate uid %v", i+1, t.UID)
+		}
+		seen[t.UID] = true
+
+		if errs := validateTopic(t, false); len(errs) > 0 {
+			return fmt.Errorf("record %d: %v", i+1, errs)
+		}
+		state, err := cache.ParseTopicState(string(t.State))
+		if err != nil {
+			return fmt.Errorf("record %d: %v", i+1, err)
+		}
+		t.State = state
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportTopics(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("export-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/admin/export", nil)
+	asAdmin(req)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 200
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+
+	topics, err := cache.ReadSnapshot(resp.Body, cache.FormatNDJSON)
+	assert.Nil(t, err)
+	assert.Contains(t, topics, cache.Topic{UID: uid, Name: "export-1"})
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/admin/export?format=csv", nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 200
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", resp.Header().Get("Content-Type"))
+
+	topics, err = cache.ReadSnapshot(resp.Body, cache.FormatCSV)
+	assert.Nil(t, err)
+	assert.Contains(t, topics, cache.Topic{UID: uid, Name: "export-1"})
+
+	// Only admins dump and load the topics
+	for _, method := range []string{"GET /admin/export", "POST /admin/import"} {
+		route := strings.Fields(method)
+		req, _ = http.NewRequest(route[0], route[1], bytes.NewBufferString(`[]`))
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, method)
+	}
+}
+
+func TestImportTopicsOK(t *testing.T) {
+	router := SetupRouter()
+
+	uid := uuid.New()
+	dump := fmt.Sprintf("uid,name,upvote,downvote\n%v,import-csv,4,2\n", uid)
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/admin/import?mode=overwrite", bytes.NewBufferString(dump))
+	asAdmin(req)
+	req.Header.Set("Content-Type", "text/csv")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 200
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var respBody cache.ImportResult
+	err := json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Equal(t, cache.ImportResult{Created: 1}, respBody)
+
+	topic, ok := cache.GetTopic(uid)
+	assert.True(t, ok)
+	assert.Equal(t, cache.Topic{UID: uid, Name: "import-csv", Upvote: 4, Downvote: 2}, *topic)
+}
+
+func TestImportTopicsInvalid(t *testing.T) {
+	router := SetupRouter()
+
+	uid := uuid.New()
+	dump := fmt.Sprintf("{\"uid\":\"%v\",\"name\":\"ok\"}\n{\"name\":\"no-uid\"}\n", uid)
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/admin/import", bytes.NewBufferString(dump))
+	asAdmin(req)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 400
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	var respBody map[string]string
+	err := json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Equal(t, "Invalid import dump", respBody["message"])
+	assert.Equal(t, "record 2: missing uid", respBody["error"])
+
+	// Nothing is imported when any record is invalid
+	_, ok := cache.GetTopic(uid)
+	assert.False(t, ok)
+
+	// Perform a POST request with that handler.
+	req, _ = http.NewRequest("POST", "/admin/import?mode=replace", bytes.NewBufferString(dump))
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 400
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
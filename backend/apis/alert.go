@@ -0,0 +1,153 @@
+package apis
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/alert"
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/events"
+)
+
+// alertCallbackTimeout bounds the posts of an alert callback
+const alertCallbackTimeout = 10 * time.Second
+
+// alertCallbacks posts the alerts of rules with a callback
+var alertCallbacks = newAlertCallbacks()
+
+func newAlertCallbacks() *alert.CallbackSink {
+	s := alert.NewCallbackSink(maxAlertCallbacks, alertCallbackTimeout)
+	s.Errorf = glog.Errorf
+	return s
+}
+
+// alerts evaluates the alert rules on every counted vote
+var alerts = alert.New(maxAlerts, alert.LogSink(glog.Warningf), alertCallbacks)
+
+func init() {
+	events.Subscribe(func(e events.Event) {
+		alerts.Handle(e)
+	})
+}
+
+// SetAlerts sets the engine evaluating the alert rules.
+// It is not safe to call while serving.
+func SetAlerts(e *alert.Engine) {
+	alerts = e
+}
+
+// SetAlertCallbackHosts sets the hosts the alert rule callbacks may post
+// to, without hosts rules have no callback.
+// It is not safe to call while serving.
+func SetAlertCallbackHosts(hosts []string) {
+	alerts.CallbackHosts = hosts
+}
+
+// listAlertRules returns the alert rules, the oldest first
+func listAlertRules(c *gin.Context) {
+	c.JSON(http.StatusOK, alerts.Rules())
+	return
+}
+
+// getAlertRule returns the alert rule given by the id path parameter
+func getAlertRule(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	rule, ok := alerts.Get(id)
+	if !ok {
+		glog.Errorf("Alert rule %v not exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Alert rule not exist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rule)
+	return
+}
+
+// createAlertRule implements the RESTful POST API.
+func createAlertRule(c *gin.Context) {
+	var body alert.Rule
+	if err := c.ShouldBindJSON(&body); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+
+	rule, err := alerts.Add(body)
+	if err != nil {
+		glog.Errorf("Invalid alert rule: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid alert rule: " + err.Error()})
+		return
+	}
+	glog.Infof("Alert rule %v %q created", rule.ID, rule.Name)
+	recordAudit(c, audit.Entry{Action: "alert.rule.create", Target: rule.ID.String(), After: rule})
+
+	c.JSON(http.StatusOK, rule)
+	return
+}
+
+// updateAlertRule replaces the alert rule given by the id path parameter
+func updateAlertRule(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	var body alert.Rule
+	if err := c.ShouldBindJSON(&body); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+
+	old, _ := alerts.Get(id)
+	rule, err := alerts.Update(id, body)
+	switch err {
+	case nil:
+	case alert.ErrRuleNotFound:
+		glog.Errorf("Alert rule %v not exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Alert rule not exist"})
+		return
+	default:
+		glog.Errorf("Invalid alert rule: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid alert rule: " + err.Error()})
+		return
+	}
+	glog.Infof("Alert rule %v %q updated", rule.ID, rule.Name)
+	recordAudit(c, audit.Entry{Action: "alert.rule.update", Target: id.String(), Before: old, After: rule})
+
+	c.JSON(http.StatusOK, rule)
+	return
+}
+
+// deleteAlertRule deletes the alert rule given by the id path parameter
+func deleteAlertRule(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	rule, err := alerts.Delete(id)
+	if err != nil {
+		glog.Errorf("Delete alert rule %v err: %v", id, err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Alert rule not exist"})
+		return
+	}
+	glog.Infof("Alert rule %v %q deleted", rule.ID, rule.Name)
+	recordAudit(c, audit.Entry{Action: "alert.rule.delete", Target: id.String(), Before: rule})
+
+	c.JSON(http.StatusOK, rule)
+	return
+}
+
+// listAlerts returns the latest alerts, the newest first
+func listAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, alerts.Alerts())
+	return
+}
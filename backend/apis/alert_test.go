@@ -0,0 +1,103 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jenting/voting-topic/backend/alert"
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+func TestAlertRules(t *testing.T) {
+	router := SetupRouter()
+
+	saved := alerts
+	SetAlerts(alert.New(maxAlerts))
+	defer SetAlerts(saved)
+
+	uid, err := cache.CreateTopic("25-1 Alerted")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	send := func(method, path, body string) (int, alert.Rule) {
+		req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+		asAdmin(req)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var rule alert.Rule
+		_ = json.Unmarshal([]byte(resp.Body.String()), &rule)
+		return resp.Code, rule
+	}
+
+	code, _ := send("POST", "/admin/alerts/rules", `{"name": "Popular", "metric": "score", "op": ">=", "value": 2}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	// Callbacks only post to the configured hosts
+	code, _ = send("POST", "/admin/alerts/rules", `{"name": "Popular", "metric": "net", "op": ">=", "value": 2, "callback": "http://169.254.169.254/"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, rule := send("POST", "/admin/alerts/rules", fmt.Sprintf(`{"name": "Popular", "topic": "%v", "metric": "net", "op": ">=", "value": 2}`, uid))
+	assert.Equal(t, http.StatusOK, code)
+	path := fmt.Sprintf("/admin/alerts/rules/%v", rule.ID)
+
+	code, got := send("GET", path, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, rule, got)
+
+	// Only admins manage the alerts
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/admin/alerts"},
+		{"GET", "/admin/alerts/rules"},
+		{"POST", "/admin/alerts/rules"},
+		{"GET", path},
+		{"PUT", path},
+		{"DELETE", path},
+	} {
+		req, _ := http.NewRequest(route.method, route.path, bytes.NewBufferString(`{}`))
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, "%v %v", route.method, route.path)
+	}
+
+	for i := 0; i < 3; i++ {
+		code, _ = send("PUT", "/topic/upvote", fmt.Sprintf(`{"uid": "%v"}`, uid))
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/admin/alerts", nil)
+	asAdmin(req)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var fired []alert.Alert
+	err = json.Unmarshal([]byte(resp.Body.String()), &fired)
+	assert.Nil(t, err)
+	// Fired once when reached
+	assert.Len(t, fired, 1)
+	assert.Equal(t, rule.ID, fired[0].Rule.ID)
+	assert.EqualValues(t, 2, fired[0].Upvote)
+
+	code, _ = send("PUT", path, `{"name": "Popular", "metric": "net", "op": "~", "value": 2}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, got = send("PUT", path, `{"name": "Very popular", "metric": "upvote", "op": ">", "value": 100}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, rule.ID, got.ID)
+	assert.Nil(t, got.Topic)
+
+	code, _ = send("DELETE", path, "")
+	assert.Equal(t, http.StatusOK, code)
+	code, _ = send("GET", path, "")
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = send("PUT", path, `{"name": "Popular", "metric": "net", "op": ">=", "value": 2}`)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = send("DELETE", "/admin/alerts/rules/x", "")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
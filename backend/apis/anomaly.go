@@ -0,0 +1,122 @@
+package apis
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/anomaly"
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+// voteDetector watches the votes for scripted voting, by default it only
+// flags suspicious votes.
+var voteDetector = mustDetector(anomaly.New(anomaly.DefaultConfig()))
+
+func mustDetector(d *anomaly.Detector, err error) *anomaly.Detector {
+	if err != nil {
+		panic(err)
+	}
+	d.Errorf = glog.Errorf
+	return d
+}
+
+// SetVoteDetector sets the anomaly detector watching the votes.
+// It is not safe to call while serving.
+func SetVoteDetector(d *anomaly.Detector) {
+	voteDetector = d
+}
+
+// countVote counts n votes of the client unless the anomaly detector
+// quarantines or discounts them, it returns the decision of the detector.
+// The client is not told, so that a script cannot probe the detector.
+func countVote(c *gin.Context, uid uuid.UUID, up bool, n uint64) (anomaly.Decision, error) {
+	client := c.ClientIP()
+	decision := voteDetector.Observe(anomaly.Vote{Topic: uid, Client: client, Up: up, At: time.Now(), Weight: n})
+	if decision.Action != anomaly.Accept {
+		glog.Warningf("Suspicious vote on topic %v from %v %v: %v", uid, client, decision.Action, decision.Rules)
+	}
+
+	if !counted(decision) {
+		return decision, nil
+	}
+	return decision, cache.IncTopicVotes(uid, up, n)
+}
+
+// counted reports whether the votes of the decision are counted now
+func counted(decision anomaly.Decision) bool {
+	return decision.Action == anomaly.Accept || decision.Action == anomaly.Flag
+}
+
+// listAnomalies returns the topic and client pairs which cast suspicious
+// votes, the most recently flagged first
+func listAnomalies(c *gin.Context) {
+	c.JSON(http.StatusOK, voteDetector.Suspects())
+	return
+}
+
+// releaseAnomaly counts the quarantined votes of a suspect and forgets it
+func releaseAnomaly(c *gin.Context) {
+	suspect, ok := resolveAnomaly(c, func(s anomaly.Suspect) error {
+		return cache.AddTopicVotes(s.Topic, s.HeldUpvotes, s.HeldDownvotes)
+	})
+	if !ok {
+		return
+	}
+
+	glog.Infof("Released %d upvotes and %d downvotes of topic %v from %v",
+		suspect.HeldUpvotes, suspect.HeldDownvotes, suspect.Topic, suspect.Client)
+	recordAudit(c, audit.Entry{Action: "anomaly.release", Target: suspect.Topic.String(), After: suspect})
+	publishVoted(suspect.Topic)
+
+	c.JSON(http.StatusOK, suspect)
+	return
+}
+
+// dismissAnomaly drops the quarantined votes of a suspect and forgets it
+func dismissAnomaly(c *gin.Context) {
+	suspect, ok := resolveAnomaly(c, nil)
+	if !ok {
+		return
+	}
+	glog.Infof("Dismissed %d upvotes and %d downvotes of topic %v from %v",
+		suspect.HeldUpvotes, suspect.HeldDownvotes, suspect.Topic, suspect.Client)
+	recordAudit(c, audit.Entry{Action: "anomaly.dismiss", Target: suspect.Topic.String(), Before: suspect})
+
+	c.JSON(http.StatusOK, suspect)
+	return
+}
+
+// resolveAnomaly forgets the suspect given by the id path parameter once
+// count, unless nil, counted its held votes. It responds with an error and
+// returns false when there is no such suspect or count fails, the suspect
+// is kept then.
+func resolveAnomaly(c *gin.Context, count func(anomaly.Suspect) error) (anomaly.Suspect, bool) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return anomaly.Suspect{}, false
+	}
+
+	suspect, ok, err := voteDetector.ResolveWith(id, count)
+	if !ok {
+		glog.Errorf("Anomaly %v not exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Anomaly not exist"})
+		return anomaly.Suspect{}, false
+	}
+	switch err {
+	case nil:
+		return suspect, true
+	case cache.ErrPollNotOpen:
+		c.JSON(http.StatusConflict, gin.H{"message": "Poll not open yet"})
+	case cache.ErrPollClosed:
+		c.JSON(http.StatusConflict, gin.H{"message": "Poll closed"})
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"message": "Topic not exist"})
+	}
+	glog.Errorf("Release votes of %v on topic %v err: %v", id, suspect.Topic, err)
+	return anomaly.Suspect{}, false
+}
@@ -0,0 +1,181 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jenting/voting-topic/backend/anomaly"
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/voter"
+	"github.com/stretchr/testify/assert"
+)
+
+func withDetector(t *testing.T, cfg anomaly.Config) {
+	d, err := anomaly.New(cfg)
+	assert.Nil(t, err)
+
+	saved := voteDetector
+	SetVoteDetector(d)
+	t.Cleanup(func() { SetVoteDetector(saved) })
+}
+
+func TestQuarantineVotes(t *testing.T) {
+	router := SetupRouter()
+	withDetector(t, anomaly.Config{Window: "1h", History: "1h", MaxClientVotes: 2, Action: "quarantine"})
+
+	uid, err := cache.CreateTopic("11-1 Quarantined topic")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for _, path := range []string{"/topic/upvote", "/topic/upvote", "/topic/upvote", "/topic/downvote"} {
+		req, _ := http.NewRequest("PUT", path, bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// The votes over the burst limit are held
+	topic, _ := cache.GetTopic(uid)
+	assert.Equal(t, uint64(2), topic.Upvote)
+	assert.Equal(t, uint64(0), topic.Downvote)
+
+	// Only admins review the suspects
+	req, _ := http.NewRequest("GET", "/admin/anomalies", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/admin/anomalies", nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var suspects []anomaly.Suspect
+	err = json.Unmarshal([]byte(resp.Body.String()), &suspects)
+	assert.Nil(t, err)
+	assert.Len(t, suspects, 1)
+	assert.Equal(t, uid, suspects[0].Topic)
+	assert.Equal(t, anomaly.Quarantine, suspects[0].Action)
+	assert.Equal(t, []anomaly.Rule{anomaly.RuleClientBurst}, suspects[0].Rules)
+	assert.Equal(t, uint64(1), suspects[0].HeldUpvotes)
+	assert.Equal(t, uint64(1), suspects[0].HeldDownvotes)
+
+	for _, action := range []string{"release", "dismiss"} {
+		req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/anomalies/%v/%v", suspects[0].ID, action), nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, action)
+	}
+
+	// Perform a POST request with that handler.
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/anomalies/%v/release", suspects[0].ID), nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	topic, _ = cache.GetTopic(uid)
+	assert.Equal(t, uint64(3), topic.Upvote)
+	assert.Equal(t, uint64(1), topic.Downvote)
+
+	// The suspect is resolved
+	for _, action := range []string{"release", "dismiss"} {
+		req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/anomalies/%v/%v", suspects[0].ID, action), nil)
+		asAdmin(req)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusNotFound, resp.Code)
+	}
+
+	req, _ = http.NewRequest("POST", "/admin/anomalies/not-an-id/dismiss", nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestDiscountVotes(t *testing.T) {
+	router := SetupRouter()
+	withDetector(t, anomaly.Config{Window: "1h", History: "1h", MaxClientVotes: 1, Action: "discount"})
+
+	sessions, err := voter.New(nil)
+	assert.Nil(t, err)
+	SetVoterSessions(sessions)
+	defer SetVoterSessions(nil)
+
+	uid, err := cache.CreateTopic("11-2 Discounted topic")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for _, id := range []string{"voter1", "voter2", "voter2", "voter3"} {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: voter.CookieName, Value: sessions.Sign(id)})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		// The discounted votes are not recorded, the voter may vote again
+		assert.Equal(t, http.StatusOK, resp.Code, id)
+	}
+
+	topic, _ := cache.GetTopic(uid)
+	assert.Equal(t, uint64(1), topic.Upvote)
+	// Only the counted vote is audited
+	assert.Len(t, auditLog.Query(audit.Query{Action: "topic.upvote", Target: uid.String()}), 1)
+
+	suspects := voteDetector.Suspects()
+	assert.Len(t, suspects, 1)
+	assert.Equal(t, uint64(0), suspects[0].HeldUpvotes)
+}
+
+func TestReleaseAnomalyRefused(t *testing.T) {
+	router := SetupRouter()
+	withDetector(t, anomaly.Config{Window: "1h", History: "1h", MaxClientVotes: 1, Action: "quarantine"})
+
+	uid, err := cache.CreateTopic("11-3 Closing topic")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+	suspects := voteDetector.Suspects()
+	assert.Len(t, suspects, 1)
+
+	release := func() (int, string) {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/anomalies/%v/release", suspects[0].ID), nil)
+		asAdmin(req)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var body map[string]interface{}
+		_ = json.Unmarshal([]byte(resp.Body.String()), &body)
+		message, _ := body["message"].(string)
+		return resp.Code, message
+	}
+
+	// The held votes of a closed poll are not counted, the suspect is kept
+	past := time.Now().Add(-time.Minute)
+	assert.Nil(t, cache.SetTopicWindow(uid, nil, &past))
+	code, message := release()
+	assert.Equal(t, http.StatusConflict, code)
+	assert.Equal(t, "Poll closed", message)
+	assert.EqualValues(t, 1, cache.GetTopicUpvote(uid))
+
+	assert.True(t, cache.DeleteTopic(uid))
+	code, message = release()
+	assert.Equal(t, http.StatusNotFound, code)
+	assert.Equal(t, "Topic not exist", message)
+
+	assert.Len(t, voteDetector.Suspects(), 1)
+	assert.Empty(t, auditLog.Query(audit.Query{Action: "anomaly.release", Target: uid.String()}))
+}
@@ -0,0 +1,111 @@
+package apis
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+// auditLog records the mutating operations
+var auditLog = audit.New(defaultAuditEntries, nil)
+
+// SetAuditLog sets the log recording the mutating operations.
+// It is not safe to call while serving.
+func SetAuditLog(l *audit.Log) {
+	auditLog = l
+}
+
+// voteCounts are the vote counts of a topic in the audit log
+type voteCounts struct {
+	Upvote   uint64 `json:"upvote"`
+	Downvote uint64 `json:"downvote"`
+}
+
+// countsOf returns the vote counts of t
+func countsOf(t *cache.Topic) voteCounts {
+	return voteCounts{Upvote: t.Upvote, Downvote: t.Downvote}
+}
+
+// requestActor returns who makes a request: the bearer token name, the
+// logged in identity, else the client IP
+func requestActor(c *gin.Context) string {
+	if actor := c.GetString(tokenActorKey); actor != "" {
+		return actor
+	}
+	if identity, ok := currentIdentity(c); ok {
+		return identity.String()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// recordAudit records the operation e of the request in the audit log
+func recordAudit(c *gin.Context, e audit.Entry) {
+	e.Actor = requestActor(c)
+	e.IP = c.ClientIP()
+	if _, err := auditLog.Record(e); err != nil {
+		glog.Errorf("Record audit entry %v of %v err: %v", e.Action, e.Target, err)
+	}
+}
+
+// auditQuery parses the actor, action, target, since, until and limit query
+// parameters, it responds with an error and returns false when they are
+// invalid
+func auditQuery(c *gin.Context, defaultLimit, maxLimit int) (audit.Query, bool) {
+	q := audit.Query{Actor: c.Query("actor"), Action: c.Query("action"), Target: c.Query("target")}
+
+	for name, t := range map[string]*time.Time{"since": &q.Since, "until": &q.Until} {
+		input := c.Query(name)
+		if input == "" {
+			continue
+		}
+		v, err := time.Parse(time.RFC3339, input)
+		if err != nil {
+			glog.Errorf("Invalid input %v: %v", name, input)
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input " + name})
+			return audit.Query{}, false
+		}
+		*t = v
+	}
+
+	limit, ok := queryLimit(c, defaultLimit, maxLimit)
+	if !ok {
+		return audit.Query{}, false
+	}
+	q.Limit = limit
+	return q, true
+}
+
+// listAudit returns the audit entries matching the query parameters, the
+// newest first
+func listAudit(c *gin.Context) {
+	q, ok := auditQuery(c, defaultAuditQuery, maxAuditQuery)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, auditLog.Query(q))
+	return
+}
+
+// exportAudit streams the audit entries matching the query parameters as
+// JSON lines, the oldest first
+func exportAudit(c *gin.Context) {
+	q, ok := auditQuery(c, defaultAuditEntries, defaultAuditEntries)
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", "attachment; filename=audit.jsonl")
+	c.Status(http.StatusOK)
+
+	if err := auditLog.WriteJSONL(c.Writer, q); err != nil {
+		// Headers are already sent, the client sees a truncated dump.
+		glog.Errorf("Export audit log err: %v", err)
+	}
+}
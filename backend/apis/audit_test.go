@@ -0,0 +1,86 @@
+package apis
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	router := SetupRouter()
+
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "23-1 Audited"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var topic cache.Topic
+	err := json.Unmarshal([]byte(resp.Body.String()), &topic)
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for i := 0; i < 2; i++ {
+		req, _ = http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, topic.UID)))
+		req.Header.Set("Content-Type", "application/json")
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/admin/audit?action=topic.upvote&target=%v", topic.UID), nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var entries []audit.Entry
+	err = json.Unmarshal([]byte(resp.Body.String()), &entries)
+	assert.Equal(t, nil, err, "List audit entries failed")
+	assert.Len(t, entries, 2)
+	// The newest first
+	assert.EqualValues(t, 2, entries[0].After.(map[string]interface{})["upvote"])
+	assert.EqualValues(t, 1, entries[0].Before.(map[string]interface{})["upvote"])
+	assert.Equal(t, "ip:"+entries[0].IP, entries[0].Actor)
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/admin/audit/export?target=%v", topic.UID), nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "application/x-ndjson", resp.Header().Get("Content-Type"))
+
+	// The oldest first
+	var actions []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var e audit.Entry
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &e))
+		actions = append(actions, e.Action)
+	}
+	assert.Equal(t, []string{"topic.create", "topic.upvote", "topic.upvote"}, actions)
+
+	for _, query := range []string{"since=yesterday", "until=2020-01-01", "limit=0"} {
+		req, _ = http.NewRequest("GET", "/admin/audit?"+query, nil)
+		asAdmin(req)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+
+	// Only admins read the audit log
+	for _, path := range []string{"/admin/audit", "/admin/audit/export"} {
+		req, _ = http.NewRequest("GET", path, nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, path)
+	}
+}
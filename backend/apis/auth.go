@@ -0,0 +1,264 @@
+package apis
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/auth"
+)
+
+const (
+	// sessionCookie holds the session id of a logged in user
+	sessionCookie = "session"
+	// loginStateCookie binds a login in progress to the browser
+	loginStateCookie = "login_state"
+	// loginStateMaxAge is the lifetime in seconds of the login state cookie
+	loginStateMaxAge = 600
+	// tokenActorKey holds the actor of a request with a bearer token
+	tokenActorKey = "tokenActor"
+)
+
+var (
+	// authProvider logs users in, nil disables the login
+	authProvider *auth.Provider
+	// authSessions keeps the logged in identities
+	authSessions *auth.Sessions
+	// companyDomains are the email domains of the company accounts,
+	// empty means every identity
+	companyDomains []string
+	// adminTokens and adminIdentities may call the admin APIs, which refuse
+	// every request when both are empty
+	adminTokens     auth.Tokens
+	adminIdentities map[string]bool
+	// serviceTokens may add batch votes, which are refused when it is empty
+	serviceTokens auth.Tokens
+)
+
+// SetAdmins sets the bearer tokens and the logged in identities, emails or
+// subjects without email, allowed to call the admin APIs.
+// It is not safe to call while serving.
+func SetAdmins(tokens auth.Tokens, identities []string) {
+	adminTokens = tokens
+	adminIdentities = make(map[string]bool)
+	for _, identity := range identities {
+		adminIdentities[identity] = true
+	}
+}
+
+// SetServiceTokens sets the bearer tokens of the trusted services allowed
+// to add batch votes. It is not safe to call while serving.
+func SetServiceTokens(tokens auth.Tokens) {
+	serviceTokens = tokens
+}
+
+// requireService aborts the requests without a service bearer token with
+// 401 Unauthorized
+func requireService(c *gin.Context) {
+	requireToken(c, serviceTokens)
+}
+
+// requireAdmin aborts the requests without an admin bearer token or admin
+// login, with 401 Unauthorized without credentials and 403 Forbidden with
+// the credentials of another user
+func requireAdmin(c *gin.Context) {
+	if header := c.GetHeader("Authorization"); header != "" {
+		requireToken(c, adminTokens)
+		return
+	}
+
+	identity, ok := currentIdentity(c)
+	if !ok {
+		glog.Errorf("Admin request %v %v without credentials from %v", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Admin credentials required"})
+		return
+	}
+	if !adminIdentities[identity.String()] || (identity.Email != "" && !identity.EmailVerified) {
+		glog.Errorf("Admin request %v %v from %v refused", c.Request.Method, c.Request.URL.Path, identity)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Admin only"})
+		return
+	}
+	c.Next()
+}
+
+// isAdmin reports whether the request has an admin bearer token or comes
+// from an admin login
+func isAdmin(c *gin.Context) bool {
+	if secret, ok := auth.BearerToken(c.GetHeader("Authorization")); ok {
+		_, ok = adminTokens.Lookup(secret)
+		return ok
+	}
+	identity, ok := currentIdentity(c)
+	return ok && adminIdentities[identity.String()] && (identity.Email == "" || identity.EmailVerified)
+}
+
+// requireToken aborts the requests without one of the bearer tokens with
+// 401 Unauthorized, else records the token name as the request actor
+func requireToken(c *gin.Context, tokens auth.Tokens) {
+	secret, ok := auth.BearerToken(c.GetHeader("Authorization"))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Bearer token required"})
+		return
+	}
+	name, ok := tokens.Lookup(secret)
+	if !ok {
+		glog.Errorf("Invalid bearer token for %v %v from %v", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Invalid bearer token"})
+		return
+	}
+	c.Set(tokenActorKey, "token:"+name)
+	c.Next()
+}
+
+// SetAuth enables the OIDC login, restricted topics are voted on by
+// verified emails of the domains only. It is not safe to call while serving.
+func SetAuth(p *auth.Provider, s *auth.Sessions, domains []string) {
+	authProvider, authSessions, companyDomains = p, s, domains
+}
+
+// login redirects to the identity provider, the user comes back to the
+// local path given by the return query parameter
+func login(c *gin.Context) {
+	if authProvider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Login not enabled"})
+		return
+	}
+
+	returnTo := c.DefaultQuery("return", "/")
+	if !strings.HasPrefix(returnTo, "/") || strings.HasPrefix(returnTo, "//") || strings.HasPrefix(returnTo, "/\\") {
+		// Only local redirects, not to another site
+		returnTo = "/"
+	}
+
+	var values [3]string
+	for i := range values {
+		v, err := auth.RandomString()
+		if err != nil {
+			glog.Errorf("Start login err: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Login failed"})
+			return
+		}
+		values[i] = v
+	}
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	authSessions.StartLogin(state, auth.Login{Verifier: verifier, Nonce: nonce, ReturnTo: returnTo})
+	setCookie(c, loginStateCookie, state, loginStateMaxAge)
+
+	c.Redirect(http.StatusFound, authProvider.AuthCodeURL(state, nonce, verifier))
+}
+
+// loginCallback redeems the authorization code and starts a session
+func loginCallback(c *gin.Context) {
+	if authProvider == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Login not enabled"})
+		return
+	}
+
+	if reason := c.Query("error"); reason != "" {
+		glog.Errorf("Login denied: %v %v", reason, c.Query("error_description"))
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login failed", "error": reason})
+		return
+	}
+
+	state := c.Query("state")
+	cookie, err := c.Cookie(loginStateCookie)
+	setCookie(c, loginStateCookie, "", -1)
+	if err != nil || state == "" || cookie != state {
+		glog.Errorf("Login state mismatch from %v", c.ClientIP())
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid login state"})
+		return
+	}
+
+	l, ok := authSessions.FinishLogin(state)
+	if !ok {
+		glog.Errorf("Login state %v not exist", state)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid login state"})
+		return
+	}
+
+	identity, err := authProvider.Exchange(c.Request.Context(), c.Query("code"), l.Verifier, l.Nonce)
+	if err != nil {
+		glog.Errorf("Login exchange err: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login failed"})
+		return
+	}
+
+	sid, err := authSessions.Create(*identity)
+	if err != nil {
+		glog.Errorf("Create session err: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Login failed"})
+		return
+	}
+	setCookie(c, sessionCookie, sid, 0)
+	glog.Infof("%v logged in", identity)
+
+	c.Redirect(http.StatusFound, l.ReturnTo)
+}
+
+// logout ends the session
+func logout(c *gin.Context) {
+	if sid, err := c.Cookie(sessionCookie); err == nil && authSessions != nil {
+		authSessions.Delete(sid)
+	}
+	setCookie(c, sessionCookie, "", -1)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	return
+}
+
+// getMe returns the identity of the logged in user
+func getMe(c *gin.Context) {
+	identity, ok := currentIdentity(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Not logged in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, identity)
+	return
+}
+
+// currentIdentity returns the identity of the request session
+func currentIdentity(c *gin.Context) (auth.Identity, bool) {
+	if authSessions == nil {
+		return auth.Identity{}, false
+	}
+	sid, err := c.Cookie(sessionCookie)
+	if err != nil {
+		return auth.Identity{}, false
+	}
+	return authSessions.Get(sid)
+}
+
+// requireCompanyAccount responds with an error and returns false unless
+// the request comes from a logged in company account
+func requireCompanyAccount(c *gin.Context) bool {
+	identity, ok := currentIdentity(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login required"})
+		return false
+	}
+	if !identity.InDomains(companyDomains) {
+		glog.Errorf("%v is not a company account", identity)
+		c.JSON(http.StatusForbidden, gin.H{"message": "Company account required"})
+		return false
+	}
+	return true
+}
+
+// setCookie sets an HTTP only cookie, a negative maxAge deletes it and
+// zero keeps it until the browser closes
+func setCookie(c *gin.Context, name, value string, maxAge int) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
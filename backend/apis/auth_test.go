@@ -0,0 +1,297 @@
+package apis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jenting/voting-topic/backend/auth"
+	"github.com/jenting/voting-topic/backend/auth/authtest"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func withAuth(t *testing.T, idp *authtest.Provider) {
+	p, err := auth.Discover(context.Background(), auth.Config{
+		Issuer:      idp.URL,
+		ClientID:    authtest.ClientID,
+		RedirectURL: "http://voting.example/callback",
+	})
+	assert.Nil(t, err)
+
+	SetAuth(p, auth.NewSessions(time.Hour), []string{"example.com"})
+	t.Cleanup(func() { SetAuth(nil, nil, nil) })
+}
+
+// logIn runs the login flow against the mock identity provider and returns
+// the session cookie
+func logIn(t *testing.T, router *gin.Engine) *http.Cookie {
+	req, _ := http.NewRequest("GET", "/login?return=/boards", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusFound, resp.Code)
+	state := resp.Result().Cookies()[0]
+	assert.Equal(t, "login_state", state.Name)
+
+	// The identity provider redirects back at once
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	idpResp, err := client.Get(resp.Header().Get("Location"))
+	assert.Nil(t, err)
+	idpResp.Body.Close()
+	callback, err := url.Parse(idpResp.Header.Get("Location"))
+	assert.Nil(t, err)
+
+	req, _ = http.NewRequest("GET", callback.RequestURI(), nil)
+	req.AddCookie(state)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusFound, resp.Code)
+	assert.Equal(t, "/boards", resp.Header().Get("Location"))
+
+	for _, cookie := range resp.Result().Cookies() {
+		if cookie.Name == "session" {
+			return cookie
+		}
+	}
+	t.Fatal("No session cookie")
+	return nil
+}
+
+func TestLogin(t *testing.T) {
+	router := SetupRouter()
+
+	req, _ := http.NewRequest("GET", "/login", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	idp := authtest.NewProvider(authtest.Claims{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+	defer idp.Close()
+	withAuth(t, idp)
+
+	session := logIn(t, router)
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/me", nil)
+	req.AddCookie(session)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var identity auth.Identity
+	err := json.Unmarshal([]byte(resp.Body.String()), &identity)
+	assert.Nil(t, err)
+	assert.Equal(t, auth.Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}, identity)
+
+	// Perform a POST request with that handler.
+	req, _ = http.NewRequest("POST", "/logout", nil)
+	req.AddCookie(session)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	req, _ = http.NewRequest("GET", "/me", nil)
+	req.AddCookie(session)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestLoginCallbackInvalid(t *testing.T) {
+	router := SetupRouter()
+	idp := authtest.NewProvider(authtest.Claims{Subject: "alice"})
+	defer idp.Close()
+	withAuth(t, idp)
+
+	tests := []struct {
+		path     string
+		cookie   string
+		expected int
+	}{
+		{"/callback?code=x&state=s1", "", http.StatusBadRequest},
+		{"/callback?code=x&state=s1", "s2", http.StatusBadRequest},
+		{"/callback?code=x&state=s1", "s1", http.StatusBadRequest},
+		{"/callback?error=access_denied", "", http.StatusUnauthorized},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", test.path, nil)
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "login_state", Value: test.cookie})
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, test.expected, resp.Code, test.path)
+	}
+
+	// Redirects stay on the site
+	for _, path := range []string{"/login?return=https://evil.example", "/login?return=//evil.example"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusFound, resp.Code)
+
+		state := resp.Result().Cookies()[0].Value
+		l, ok := authSessions.FinishLogin(state)
+		assert.True(t, ok)
+		assert.Equal(t, "/", l.ReturnTo)
+	}
+}
+
+func TestRestrictedTopic(t *testing.T) {
+	router := SetupRouter()
+	idp := authtest.NewProvider(authtest.Claims{Subject: "mallory", Email: "mallory@other.com", EmailVerified: true})
+	defer idp.Close()
+	withAuth(t, idp)
+
+	outsider := logIn(t, router)
+	idp.SetClaims(authtest.Claims{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+	employee := logIn(t, router)
+
+	create := func(cookie *http.Cookie) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "14-1 Company only", "restricted": true, "createdBy": "forged"}`))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, create(nil).Code)
+	assert.Equal(t, http.StatusForbidden, create(outsider).Code)
+
+	resp := create(employee)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var topic cache.Topic
+	err := json.Unmarshal([]byte(resp.Body.String()), &topic)
+	assert.Nil(t, err)
+	assert.True(t, topic.Restricted)
+	assert.Equal(t, "alice@example.com", topic.CreatedBy)
+
+	vote := func(cookie *http.Cookie) int {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, topic.UID)))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, vote(nil))
+	assert.Equal(t, http.StatusForbidden, vote(outsider))
+	assert.Equal(t, http.StatusOK, vote(employee))
+	assert.Equal(t, http.StatusConflict, vote(employee), "An identity votes once")
+
+	voted, _ := cache.GetTopic(topic.UID)
+	assert.Equal(t, uint64(1), voted.Upvote)
+	assert.Equal(t, true, cache.GetVoterVotes("user:alice")[topic.UID])
+
+	// Only the creator changes the voting window
+	closeTopic := func(cookie *http.Cookie) int {
+		closesAt := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		req, _ := http.NewRequest("PUT", "/topic", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v", "closesAt": %q}`, topic.UID, closesAt)))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	assert.Equal(t, http.StatusForbidden, closeTopic(nil))
+	assert.Equal(t, http.StatusForbidden, closeTopic(outsider))
+	assert.Equal(t, http.StatusOK, closeTopic(employee))
+
+	// Anonymous topics have no creator
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "14-2 Anonymous", "createdBy": "forged"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var anonymous cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &anonymous)
+	assert.Nil(t, err)
+	assert.Equal(t, "", anonymous.CreatedBy)
+}
+
+// testAdminToken authorizes the admin requests of the tests
+const testAdminToken = "test-admin-token"
+
+// testServiceToken authorizes the batch votes of the tests
+const testServiceToken = "test-service-token"
+
+func init() {
+	SetAdmins(auth.Tokens{{Name: "test", Secret: testAdminToken}}, []string{"alice@example.com"})
+	SetServiceTokens(auth.Tokens{{Name: "importer", Secret: testServiceToken}})
+}
+
+// asAdmin authorizes req with the admin token of the tests
+func asAdmin(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+testAdminToken)
+}
+
+func TestRequireAdmin(t *testing.T) {
+	router := SetupRouter()
+	idp := authtest.NewProvider(authtest.Claims{Subject: "mallory", Email: "mallory@example.com", EmailVerified: true})
+	defer idp.Close()
+	withAuth(t, idp)
+
+	mallory := logIn(t, router)
+	idp.SetClaims(authtest.Claims{Subject: "alice", Email: "alice@example.com", EmailVerified: true})
+	alice := logIn(t, router)
+
+	uid, err := cache.CreateTopic("27-1 Admin only")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for _, test := range []struct {
+		authorization string
+		cookie        *http.Cookie
+		code          int
+	}{
+		{"", nil, http.StatusUnauthorized},
+		{"Bearer wrong", nil, http.StatusUnauthorized},
+		{"Basic " + testAdminToken, nil, http.StatusUnauthorized},
+		{"", mallory, http.StatusForbidden},
+		// Allowed, whatever the handler answers
+		{"", alice, 0},
+		{"Bearer " + testAdminToken, nil, 0},
+	} {
+		for _, route := range []struct{ method, path, body string }{
+			{"PUT", fmt.Sprintf("/admin/topics/%v/votes", uid), `{"upvote": 1, "reason": "recount"}`},
+			{"PATCH", fmt.Sprintf("/admin/topics/%v/votes", uid), `{"upvote": 1, "reason": "recount"}`},
+			{"GET", fmt.Sprintf("/admin/topics/%v/corrections", uid), ""},
+		} {
+			req, _ := http.NewRequest(route.method, route.path, bytes.NewBufferString(route.body))
+			req.Header.Set("Content-Type", "application/json")
+			if test.authorization != "" {
+				req.Header.Set("Authorization", test.authorization)
+			}
+			if test.cookie != nil {
+				req.AddCookie(test.cookie)
+			}
+			resp := httptest.NewRecorder()
+			router.ServeHTTP(resp, req)
+			if test.code == 0 {
+				assert.NotContains(t, []int{http.StatusUnauthorized, http.StatusForbidden}, resp.Code, "%v %v", route.method, route.path)
+			} else {
+				assert.Equal(t, test.code, resp.Code, "%v %v %v", route.method, route.path, test.authorization)
+			}
+		}
+	}
+
+	// The corrections record the admin
+	corrections := cache.GetTopicCorrections(uid)
+	assert.Len(t, corrections, 4)
+	assert.Equal(t, "alice@example.com", corrections[0].Actor)
+	assert.Equal(t, "token:test", corrections[3].Actor)
+}
@@ -0,0 +1,142 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+const (
+	// batchAtomic batches apply all votes or none
+	batchAtomic = "atomic"
+	// batchBestEffort batches apply the valid votes
+	batchBestEffort = "best-effort"
+)
+
+// batchVote is a vote of a batch, count defaults to 1
+type batchVote struct {
+	UID       uuid.UUID `json:"uid"`
+	Direction string    `json:"direction"`
+	Count     uint64    `json:"count"`
+}
+
+// batchVoteResult is the outcome of a vote of a batch
+type batchVoteResult struct {
+	UID     uuid.UUID `json:"uid"`
+	Status  int       `json:"status"`
+	Message string    `json:"message,omitempty"`
+}
+
+// customMethod rejects the requests to another custom method of the route.
+// The router reads the colon of a custom method as a path parameter, so
+// /votes:batch also matches /votes:merge.
+func customMethod(c *gin.Context) {
+	if c.Request.URL.Path != c.FullPath() {
+		glog.Errorf("Unknown custom method %q", c.Request.URL.Path)
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Action not exist"})
+		return
+	}
+	c.Next()
+}
+
+// batchVotes implements the RESTful POST API for trusted services adding the votes of the JSON
+// body `{"mode", "votes"}` with a result per vote. An atomic batch (default)
+// applies all votes or none and fails with 422, a best-effort batch applies
+// the valid votes.
+func batchVotes(c *gin.Context) {
+	var body struct {
+		Mode  string      `json:"mode"`
+		Votes []batchVote `json:"votes"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+
+	if body.Mode == "" {
+		body.Mode = batchAtomic
+	}
+	if body.Mode != batchAtomic && body.Mode != batchBestEffort {
+		glog.Errorf("Invalid batch mode %q", body.Mode)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input mode"})
+		return
+	}
+	if len(body.Votes) == 0 || len(body.Votes) > maxBatchVotes {
+		glog.Errorf("Invalid batch of %d votes", len(body.Votes))
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Batch must have 1 to 10000 votes"})
+		return
+	}
+
+	// Invalid directions and counts fail before the cache is asked
+	results := make([]batchVoteResult, len(body.Votes))
+	batch := make([]cache.TopicVotes, 0, len(body.Votes))
+	index := make([]int, 0, len(body.Votes))
+	for i, v := range body.Votes {
+		results[i] = batchVoteResult{UID: v.UID, Status: http.StatusOK}
+		if v.Direction != "up" && v.Direction != "down" {
+			results[i].Status, results[i].Message = http.StatusBadRequest, "Invalid direction"
+			continue
+		}
+		if v.Count == 0 {
+			v.Count = 1
+		}
+		if v.Count > maxBatchVoteCount {
+			results[i].Status, results[i].Message = http.StatusBadRequest, "Count must be at most 1000000"
+			continue
+		}
+		batch = append(batch, cache.TopicVotes{UID: v.UID, Up: v.Direction == "up", Count: v.Count})
+		index = append(index, i)
+	}
+
+	atomic := body.Mode == batchAtomic
+	if atomic && len(batch) < len(body.Votes) {
+		for _, i := range index {
+			results[i].Status, results[i].Message = http.StatusConflict, "Batch aborted"
+		}
+	} else {
+		for j, err := range cache.IncTopicVotesBatch(batch, atomic) {
+			if err != nil {
+				results[index[j]].Status, results[index[j]].Message = batchVoteStatus(err)
+				continue
+			}
+			recordAudit(c, audit.Entry{Action: "votes.batch", Target: batch[j].UID.String(), After: body.Votes[index[j]]})
+			publishVoted(batch[j].UID)
+		}
+	}
+
+	applied := 0
+	for _, r := range results {
+		if r.Status == http.StatusOK {
+			applied++
+		}
+	}
+	glog.Infof("Applied %d of %d batch votes", applied, len(results))
+
+	status := http.StatusOK
+	if atomic && applied < len(results) {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, gin.H{"mode": body.Mode, "applied": applied, "failed": len(results) - applied, "results": results})
+	return
+}
+
+// batchVoteStatus returns the status and message of a batch vote error
+func batchVoteStatus(err error) (int, string) {
+	switch err {
+	case cache.ErrPollNotOpen:
+		return http.StatusForbidden, "Poll not open yet"
+	case cache.ErrPollClosed:
+		return http.StatusForbidden, "Poll closed"
+	case cache.ErrBatchAborted:
+		return http.StatusConflict, "Batch aborted"
+	case cache.ErrCountOutOfRange:
+		return http.StatusConflict, "Vote count out of range"
+	}
+	return http.StatusNotFound, "Topic not exist"
+}
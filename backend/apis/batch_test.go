@@ -0,0 +1,115 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchVotes(t *testing.T) {
+	router := SetupRouter()
+
+	past := time.Now().Add(-time.Hour)
+	a, err := cache.CreateTopic("21-1 Batch")
+	assert.Equal(t, nil, err, "Create topic failed")
+	b, err := cache.CreateTopic("21-2 Batch")
+	assert.Equal(t, nil, err, "Create topic failed")
+	closed, err := cache.NewTopic(cache.Topic{Name: "21-3 Batch closed", ClosesAt: &past})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	type response struct {
+		Mode    string            `json:"mode"`
+		Applied int               `json:"applied"`
+		Failed  int               `json:"failed"`
+		Results []batchVoteResult `json:"results"`
+	}
+	batch := func(path, body string) (int, response) {
+		req, _ := http.NewRequest("POST", path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+testServiceToken)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var r response
+		_ = json.Unmarshal([]byte(resp.Body.String()), &r)
+		return resp.Code, r
+	}
+
+	valid := fmt.Sprintf(`{"uid": "%v", "direction": "up", "count": 5}, {"uid": "%v", "direction": "down"}`, a, b)
+	invalid := fmt.Sprintf(`{"uid": "%v", "direction": "up"}, {"uid": "%v", "direction": "sideways"}, {"uid": "%v", "direction": "up"}`, closed, a, uuid.New())
+
+	// Atomic batches apply nothing when a vote fails
+	code, r := batch("/votes:batch", `{"votes": [`+valid+`, `+invalid+`]}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "atomic", r.Mode)
+	assert.Equal(t, 0, r.Applied)
+	assert.Equal(t, 5, r.Failed)
+	statuses := make([]int, len(r.Results))
+	for i, result := range r.Results {
+		statuses[i] = result.Status
+	}
+	assert.Equal(t, []int{409, 409, 409, 400, 409}, statuses)
+	assert.EqualValues(t, 0, cache.GetTopicUpvote(a))
+
+	code, r = batch("/votes:batch", fmt.Sprintf(`{"votes": [%s, {"uid": "%v", "direction": "up"}]}`, valid, closed))
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "Poll closed", r.Results[2].Message)
+	assert.Equal(t, "Batch aborted", r.Results[0].Message)
+
+	// Best-effort batches apply the valid votes
+	code, r = batch("/votes:batch", `{"mode": "best-effort", "votes": [`+valid+`, `+invalid+`]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, r.Applied)
+	for i, result := range r.Results {
+		statuses[i] = result.Status
+	}
+	assert.Equal(t, []int{200, 200, 403, 400, 404}, statuses)
+	assert.EqualValues(t, 5, cache.GetTopicUpvote(a))
+	assert.EqualValues(t, 1, cache.GetTopicDownvote(b))
+
+	code, r = batch("/votes:batch", `{"votes": [`+valid+`]}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 2, r.Applied)
+	assert.EqualValues(t, 10, cache.GetTopicUpvote(a))
+
+	code, _ = batch("/votes:batch", `{"mode": "all", "votes": [`+valid+`]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = batch("/votes:batch", `{"votes": []}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = batch("/votes:merge", `{"votes": [`+valid+`]}`)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	// Counts are bounded and never overflow
+	code, r = batch("/votes:batch", fmt.Sprintf(`{"votes": [{"uid": "%v", "direction": "up", "count": 1000001}]}`, a))
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, http.StatusBadRequest, r.Results[0].Status)
+	down := uint64(math.MaxUint64 - 1000)
+	_, err = cache.SetTopicVotes(b, nil, &down, "test", "near overflow")
+	assert.Nil(t, err)
+	code, r = batch("/votes:batch", fmt.Sprintf(`{"mode": "best-effort", "votes": [{"uid": "%v", "direction": "down", "count": 1000}, {"uid": "%v", "direction": "down", "count": 1000}]}`, b, b))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, 1, r.Applied)
+	assert.Equal(t, "Vote count out of range", r.Results[1].Message)
+	assert.EqualValues(t, uint64(math.MaxUint64), cache.GetTopicDownvote(b))
+
+	// Batch votes need a service token
+	for _, header := range []string{"", "Bearer " + testAdminToken} {
+		req, _ := http.NewRequest("POST", "/votes:batch", bytes.NewBufferString(`{"votes": [`+valid+`]}`))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	}
+}
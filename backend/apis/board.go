@@ -0,0 +1,92 @@
+package apis
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+const maxBoardNameLen = 64
+
+// Board id is used in URLs, so keep it a lower case slug.
+var boardIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,63}$`)
+
+// getBoards returns all boards
+func getBoards(c *gin.Context) {
+	c.JSON(http.StatusOK, cache.ListBoards())
+	return
+}
+
+// createBoard implements the RESTful POST API.
+func createBoard(c *gin.Context) {
+	var b cache.Board
+	if err := c.ShouldBindJSON(&b); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+
+	if !boardIDPattern.MatchString(b.ID) {
+		glog.Errorf("Invalid board id: %v", b.ID)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid board id"})
+		return
+	}
+
+	// Board name should not exceed 64 characters.
+	if len(b.Name) > maxBoardNameLen {
+		glog.Errorf("Board name length exceeds length %d", maxBoardNameLen)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Board name over length"})
+		return
+	}
+	if b.Name == "" {
+		b.Name = b.ID
+	}
+
+	if err := cache.CreateBoard(b.ID, b.Name); err != nil {
+		glog.Errorf("Create board %v err: %v", b.ID, err)
+		c.JSON(http.StatusConflict, gin.H{"message": "Board already exist"})
+		return
+	}
+	recordAudit(c, audit.Entry{Action: "board.create", Target: b.ID, After: b})
+
+	c.JSON(http.StatusOK, b)
+	return
+}
+
+// getBoardTopTopic returns board's top 20 topics (sorted by upvotes, descending)
+// having all the tags given by the tag query parameters
+func getBoardTopTopic(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := cache.GetBoard(id); !ok {
+		glog.Errorf("Get board %v failed", id)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Board not exist"})
+		return
+	}
+
+	respondTopTopics(c, cache.InBoard(id), cache.WithTags(c.QueryArray("tag")...))
+}
+
+// createBoardTopic implements the RESTful POST API.
+func createBoardTopic(c *gin.Context) {
+	id := c.Param("id")
+	if _, ok := cache.GetBoard(id); !ok {
+		glog.Errorf("Get board %v failed", id)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Board not exist"})
+		return
+	}
+
+	var t cache.Topic
+	if err := c.ShouldBindJSON(&t); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+	t.Board = id
+
+	addTopic(c, t)
+}
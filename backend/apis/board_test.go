@@ -0,0 +1,103 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateBoard(t *testing.T) {
+	router := SetupRouter()
+
+	tests := []struct {
+		body    string
+		code    int
+		message string
+	}{
+		{`{"id": "planning", "name": "Planning"}`, http.StatusOK, ""},
+		{`{"id": "planning", "name": "Planning"}`, http.StatusConflict, "Board already exist"},
+		{`{"id": "Not A Slug"}`, http.StatusBadRequest, "Invalid board id"},
+	}
+
+	for _, test := range tests {
+		// Perform a POST request with that handler.
+		req, _ := http.NewRequest("POST", "/boards", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, test.code, resp.Code, test.body)
+		if test.message != "" {
+			var respBody map[string]string
+			err := json.Unmarshal([]byte(resp.Body.String()), &respBody)
+			assert.Nil(t, err)
+			assert.Equal(t, test.message, respBody["message"])
+		}
+	}
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/boards", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var respBody []cache.Board
+	err := json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Contains(t, respBody, cache.Board{ID: "planning", Name: "Planning"})
+}
+
+func TestBoardTopTopic(t *testing.T) {
+	router := SetupRouter()
+
+	err := cache.CreateBoard("infra", "Infra")
+	assert.Equal(t, nil, err, "Create board failed")
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/boards/infra/topics", bytes.NewBufferString(`{"name": "4-1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 200
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var topic cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &topic)
+	assert.Nil(t, err)
+	assert.Equal(t, "infra", topic.Board)
+
+	// Topic created outside of the board is not listed
+	_, err = cache.CreateTopic("4-2")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/boards/infra/toptopic", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var respBody []cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Equal(t, []cache.Topic{topic}, respBody)
+
+	// Perform requests against a board which does not exist.
+	req, _ = http.NewRequest("GET", "/boards/not-exist/toptopic", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	req, _ = http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "4-3", "board": "not-exist"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
@@ -0,0 +1,143 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/validation"
+)
+
+// correctionReasonRule validates the reason of a vote count correction
+var correctionReasonRule = validation.Rule{Field: "reason", Label: "Correction reason", Required: true, MaxLen: maxReportReasonLen, Trim: true, Multiline: true}
+
+// setTopicVotes sets the vote counts of the topic given by the uid path
+// parameter with the JSON body `{"upvote", "downvote", "reason"}`, an
+// absent count is kept
+func setTopicVotes(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Upvote   *uint64 `json:"upvote"`
+		Downvote *uint64 `json:"downvote"`
+		Reason   string  `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+	if body.Upvote == nil && body.Downvote == nil {
+		glog.Errorf("Set votes of topic %v without count", uid)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Upvote or downvote required"})
+		return
+	}
+
+	reason, ok := correctionReason(c, uid, body.Reason)
+	if !ok {
+		return
+	}
+
+	correction, err := cache.SetTopicVotes(uid, body.Upvote, body.Downvote, requestActor(c), reason)
+	respondCorrection(c, "topic.votes.set", uid, correction, err)
+}
+
+// adjustTopicVotes adds the signed deltas of the JSON body
+// `{"upvote", "downvote", "reason"}` to the vote counts of the topic given
+// by the uid path parameter
+func adjustTopicVotes(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Upvote   int64  `json:"upvote"`
+		Downvote int64  `json:"downvote"`
+		Reason   string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+	if body.Upvote == 0 && body.Downvote == 0 {
+		glog.Errorf("Adjust votes of topic %v without delta", uid)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Upvote or downvote required"})
+		return
+	}
+
+	reason, ok := correctionReason(c, uid, body.Reason)
+	if !ok {
+		return
+	}
+
+	correction, err := cache.AdjustTopicVotes(uid, body.Upvote, body.Downvote, requestActor(c), reason)
+	respondCorrection(c, "topic.votes.adjust", uid, correction, err)
+}
+
+// correctionReason validates the reason of a correction, it responds with
+// an error and returns false when the reason is invalid
+func correctionReason(c *gin.Context, uid uuid.UUID, input string) (string, bool) {
+	reason, fe := correctionReasonRule.Apply(input)
+	if fe != nil {
+		glog.Errorf("Invalid correction of topic %v: %v", uid, fe.Message)
+		respondInvalid(c, validation.Errors{*fe})
+		return "", false
+	}
+	return reason, true
+}
+
+// respondCorrection records the correction made by action in the audit
+// log and responds with the corrected topic and the correction
+func respondCorrection(c *gin.Context, action string, uid uuid.UUID, correction cache.CountCorrection, err error) {
+	switch err {
+	case nil:
+	case cache.ErrTopicNotFound:
+		glog.Errorf("Correct votes of topic %v err: %v", uid, err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Topic not exist"})
+		return
+	case cache.ErrCountOutOfRange:
+		glog.Errorf("Correct votes of topic %v err: %v", uid, err)
+		topic, _ := cache.GetTopic(uid)
+		c.JSON(http.StatusConflict, gin.H{"message": "Vote count out of range", "topic": topic})
+		return
+	default:
+		glog.Errorf("Correct votes of topic %v err: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Correct votes failed"})
+		return
+	}
+
+	glog.Infof("Votes of topic %v corrected by %v: upvote %d to %d, downvote %d to %d: %v", uid, correction.Actor,
+		correction.Upvote.From, correction.Upvote.To, correction.Downvote.From, correction.Downvote.To, correction.Reason)
+	recordAudit(c, audit.Entry{
+		Action: action,
+		Target: uid.String(),
+		Before: voteCounts{Upvote: correction.Upvote.From, Downvote: correction.Downvote.From},
+		After:  voteCounts{Upvote: correction.Upvote.To, Downvote: correction.Downvote.To},
+		Reason: correction.Reason,
+	})
+	topic, _ := cache.GetTopic(uid)
+	c.JSON(http.StatusOK, gin.H{"topic": topic, "correction": correction})
+	return
+}
+
+// listCorrections returns the vote count corrections of the topic given by
+// the uid path parameter, the oldest first. Corrections of deleted topics
+// are kept.
+func listCorrections(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, cache.GetTopicCorrections(uid))
+	return
+}
@@ -0,0 +1,78 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCorrectTopicVotes(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("22-1 Corrections")
+	assert.Equal(t, nil, err, "Create topic failed")
+	assert.Equal(t, nil, cache.IncTopicVotes(uid, true, 100))
+
+	correct := func(method, body string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest(method, fmt.Sprintf("/admin/topics/%v/votes", uid), bytes.NewBufferString(body))
+		asAdmin(req)
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var r map[string]interface{}
+		_ = json.Unmarshal([]byte(resp.Body.String()), &r)
+		return resp.Code, r
+	}
+
+	code, _ := correct("PATCH", `{"upvote": -90}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = correct("PATCH", `{"reason": "bots"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = correct("PUT", `{"reason": "bots"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, r := correct("PATCH", `{"upvote": -90, "downvote": 5, "reason": " Scripted upvotes "}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.EqualValues(t, 10, r["topic"].(map[string]interface{})["upvote"])
+	assert.Equal(t, "Scripted upvotes", r["correction"].(map[string]interface{})["reason"])
+
+	// Counts never go below zero
+	code, r = correct("PATCH", `{"downvote": -6, "reason": "too many"}`)
+	assert.Equal(t, http.StatusConflict, code)
+	assert.EqualValues(t, 5, r["topic"].(map[string]interface{})["downvote"])
+
+	code, r = correct("PUT", `{"downvote": 0, "reason": "reset"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.EqualValues(t, 10, r["topic"].(map[string]interface{})["upvote"])
+	assert.EqualValues(t, 0, r["topic"].(map[string]interface{})["downvote"])
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/admin/topics/%v/corrections", uid), nil)
+	asAdmin(req)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var corrections []cache.CountCorrection
+	err = json.Unmarshal([]byte(resp.Body.String()), &corrections)
+	assert.Equal(t, nil, err, "Get corrections failed")
+	assert.Len(t, corrections, 2)
+	assert.Equal(t, cache.CountChange{From: 100, To: 10}, corrections[0].Upvote)
+	assert.Equal(t, cache.CountChange{From: 5, To: 0}, corrections[1].Downvote)
+	assert.Equal(t, "token:test", corrections[1].Actor)
+
+	// Perform a PUT request with that handler.
+	req, _ = http.NewRequest("PUT", "/admin/topics/00000000-0000-0000-0000-000000000000/votes", bytes.NewBufferString(`{"upvote": 1, "reason": "r"}`))
+	asAdmin(req)
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
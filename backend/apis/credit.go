@@ -0,0 +1,110 @@
+package apis
+
+import (
+	"math"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+// voteCredits is the credit budget of each voter per board round, casting
+// k upvotes or downvotes on a topic costs k² credits. Zero disables the credits and
+// allows one vote per topic.
+var voteCredits uint64
+
+// SetVoteCredits sets the credit budget of each voter per board round,
+// zero disables the credits. It is not safe to call while serving.
+func SetVoteCredits(n uint64) {
+	voteCredits = n
+}
+
+// spendCredits charges the request voter for n upvotes or downvotes on
+// topic. It responds with an error and returns false when the voter is
+// unknown or can not afford the votes, else it returns a func refunding
+// the votes.
+func spendCredits(c *gin.Context, topic *cache.Topic, up bool, n uint64) (func(), bool) {
+	if topic.Restricted && !requireCompanyAccount(c) {
+		return nil, false
+	}
+
+	id := voterID(c)
+	if id == "" {
+		glog.Errorf("Vote on topic %v without voter identity from %v", topic.UID, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Voter identity required"})
+		return nil, false
+	}
+
+	balance, err := cache.SpendCredits(id, topic.UID, up, n, voteCredits)
+	if err == cache.ErrInsufficientCredits {
+		glog.Errorf("Voter %v can not afford %d votes on topic %v: %v", id, n, topic.UID, err)
+		c.JSON(http.StatusForbidden, gin.H{"message": "Insufficient credits", "balance": balance})
+		return nil, false
+	}
+	if err != nil {
+		glog.Errorf("Voter %v spend credits on topic %v err: %v", id, topic.UID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "UUID not exist"})
+		return nil, false
+	}
+
+	refund := func() {
+		cache.RefundCredits(id, topic.UID, up, n)
+	}
+	return refund, true
+}
+
+// maxCreditVotes returns the most votes a voter can afford at once, the
+// integer square root of the budget
+func maxCreditVotes() uint64 {
+	n := uint64(math.Sqrt(float64(voteCredits)))
+	// Correct the float rounding of large budgets
+	for n > 0 && (n > math.MaxUint32 || n*n > voteCredits) {
+		n--
+	}
+	for n < math.MaxUint32 && (n+1)*(n+1) <= voteCredits {
+		n++
+	}
+	return n
+}
+
+// getCredits returns the credit balance of the request voter in the current
+// round of the board query parameter, default the topics without board
+func getCredits(c *gin.Context) {
+	if voteCredits == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Vote credits not enabled"})
+		return
+	}
+
+	id := voterID(c)
+	if id == "" {
+		glog.Errorf("Get credits without voter identity from %v", c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Voter identity required"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cache.GetCreditBalance(c.Query("board"), id, voteCredits))
+	return
+}
+
+// resetCredits starts a new credit round of the board query parameter,
+// default the topics without board. The votes cast stay counted.
+func resetCredits(c *gin.Context) {
+	board := c.Query("board")
+	if board != "" {
+		if _, ok := cache.GetBoard(board); !ok {
+			glog.Errorf("Get board %v failed", board)
+			c.JSON(http.StatusNotFound, gin.H{"message": "Board not exist"})
+			return
+		}
+	}
+
+	cache.ResetCredits(board)
+	glog.Infof("Started a new credit round of board %q", board)
+	recordAudit(c, audit.Entry{Action: "credits.reset", Target: board})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Credit round started"})
+	return
+}
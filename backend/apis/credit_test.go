@@ -0,0 +1,130 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/voter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVoteCredits(t *testing.T) {
+	// The ranking below only holds the topics of this test
+	cache.Reset()
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("19-1 Quadratic votes")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	vote := func(path, cookie string, votes int) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("PUT", path, bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v", "votes": %d}`, uid, votes)))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: voter.CookieName, Value: cookie})
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var body map[string]interface{}
+		_ = json.Unmarshal([]byte(resp.Body.String()), &body)
+		return resp.Code, body
+	}
+
+	// Weighted votes need credits
+	code, _ := vote("/topic/upvote", "", 2)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	sessions, err := voter.New(nil)
+	assert.Nil(t, err)
+	SetVoterSessions(sessions)
+	defer SetVoterSessions(nil)
+	SetVoteCredits(25)
+	defer SetVoteCredits(0)
+
+	code, _ = vote("/topic/upvote", "", 1)
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// 4 votes cost 16 credits, a 5th one 9 more, a 6th one is refused
+	cookie := sessions.Sign("voter-q")
+	code, body := vote("/topic/upvote", cookie, 4)
+	assert.Equal(t, http.StatusOK, code)
+	assert.EqualValues(t, 4, body["upvote"])
+	code, _ = vote("/topic/upvote", cookie, 1)
+	assert.Equal(t, http.StatusOK, code)
+	code, body = vote("/topic/upvote", cookie, 1)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "Insufficient credits", body["message"])
+
+	// Downvotes do not refund the upvotes, which stay counted
+	code, body = vote("/topic/downvote", cookie, 1)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "Insufficient credits", body["message"])
+
+	// Votes whose cost overflows are refused
+	for _, votes := range []uint64{1 << 32, math.MaxUint64} {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v", "votes": %d}`, uid, votes)))
+		req.Header.Set("Content-Type", "application/json")
+		req.AddCookie(&http.Cookie{Name: voter.CookieName, Value: sessions.Sign("voter-r")})
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusForbidden, resp.Code)
+	}
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/credits", nil)
+	req.AddCookie(&http.Cookie{Name: voter.CookieName, Value: cookie})
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var balance cache.CreditBalance
+	err = json.Unmarshal([]byte(resp.Body.String()), &balance)
+	assert.Equal(t, nil, err, "Get credits failed")
+	assert.EqualValues(t, 25, balance.Spent)
+	assert.EqualValues(t, 0, balance.Balance)
+	assert.Equal(t, cache.CreditVotes{Upvote: 5}, balance.Votes[uid])
+
+	// Only admins start a new round
+	req, _ = http.NewRequest("POST", "/admin/credits/reset", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// A new round gives the budget back
+	req, _ = http.NewRequest("POST", "/admin/credits/reset", nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	code, _ = vote("/topic/downvote", cookie, 2)
+	assert.Equal(t, http.StatusOK, code)
+	code, body = vote("/topic/upvote", cookie, 4)
+	assert.Equal(t, http.StatusOK, code)
+	assert.EqualValues(t, 9, body["upvote"])
+	assert.EqualValues(t, 2, body["downvote"])
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/toptopic?order=effective", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var topics []cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &topics)
+	assert.Equal(t, nil, err, "Get top topic failed")
+	assert.Equal(t, uid, topics[0].UID)
+	assert.EqualValues(t, 7, topics[0].Effective())
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/toptopic?order=random", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
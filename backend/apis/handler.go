@@ -1,20 +1,63 @@
 package apis
 
 import (
+	"errors"
+	"fmt"
+	"net"
 	"net/http"
+	"reflect"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang/glog"
 	"github.com/google/uuid"
 
+	"github.com/jenting/voting-topic/backend/audit"
 	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/moderation"
+	"github.com/jenting/voting-topic/backend/validation"
 )
 
 const (
-	maxTopicNameLen = 255
-	maxTopTopics    = 20
+	maxTopicNameLen        = 255
+	maxTopicDescriptionLen = 4096
+	maxTopicURLLen         = 2048
+	maxTopicAuthorLen      = 64
+	maxTopTopics           = 20
+	maxTopicTags           = 10
+	maxTagLen              = 32
+	maxReportReasonLen     = 500
+	defaultReportThreshold = 5
+	maxBatchVotes          = 10000
+	maxBatchVoteCount      = 1000000
+	defaultAuditEntries    = 100000
+	defaultAuditQuery      = 100
+	maxAuditQuery          = 1000
+	maxAlerts              = 1000
+	maxAlertCallbacks      = 100
+	minPollOptions         = 2
+	maxPollOptions         = 20
+	maxPollOptionLen       = 100
 )
 
+// trustedProxies are the proxy IPs and CIDRs whose forwarding headers give
+// the client IP, nil trusts no proxy and uses the connection address
+var trustedProxies []string
+
+// SetTrustedProxies sets the proxies whose X-Forwarded-For and X-Real-IP
+// headers give the client IP, it returns an error for an invalid IP or CIDR.
+// It is not safe to call while serving.
+func SetTrustedProxies(proxies []string) error {
+	for _, proxy := range proxies {
+		if _, _, err := net.ParseCIDR(proxy); err != nil && net.ParseIP(proxy) == nil {
+			return fmt.Errorf("invalid trusted proxy %q", proxy)
+		}
+	}
+	trustedProxies = proxies
+	return nil
+}
+
 // SetupRouter returns the main gin-gonic http server
 func SetupRouter() *gin.Engine {
 	// Disable debug mode of gin framework.
@@ -26,13 +69,80 @@ func SetupRouter() *gin.Engine {
 	// Creates a gin router with default middleware:
 	// logger and recovery (crash-free) middleware
 	router := gin.Default()
+	// Forwarding headers are forged unless set by a trusted proxy
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		panic(err)
+	}
+	router.Use(requireOutbox)
 
 	// Create routes
-	router.GET("/toptopic", getTopTopic)               // get top topic
-	router.GET("/topic", getTopic)                     // get topic
-	router.POST("/topic", createTopic)                 // sumit a new topic
-	router.PUT("/topic/upvote", updateTopicUpvote)     // update topic's upvote
-	router.PUT("/topic/downvote", updateTopicDownvote) // update topic's downvote
+	router.GET("/toptopic", getTopTopic)                                              // get top topic
+	router.GET("/topic", getTopic)                                                    // get topic
+	router.POST("/topic", idempotent, createTopic)                                    // sumit a new topic
+	router.PUT("/topic", updateTopic)                                                 // edit topic's name, tags and details
+	router.PUT("/topic/upvote", idempotent, requireWork, updateTopicUpvote)           // update topic's upvote
+	router.PUT("/topic/downvote", idempotent, requireWork, updateTopicDownvote)       // update topic's downvote
+	router.POST("/topic/:uid/report", reportTopic)                                    // flag an abusive topic
+	router.GET("/tags", getTags)                                                      // get tag cloud
+	router.GET("/topics/similar", getSimilarTopics)                                   // get topics with similar name
+	router.GET("/topics/search", searchTopics)                                        // full-text search topics
+	router.GET("/challenge", getChallenge)                                            // get a proof of work challenge
+	router.GET("/credits", getCredits)                                                // get the voter credit balance
+	router.POST("/votes:batch", customMethod, requireService, idempotent, batchVotes) // add votes in bulk
+
+	// Polls
+	router.GET("/polls", getPolls)                                    // get polls with the most voters
+	router.POST("/polls", idempotent, createPoll)                     // submit a new poll
+	router.GET("/polls/:uid", getPoll)                                // get poll
+	router.GET("/polls/:uid/results", getPollResults)                 // get poll options ranked by votes
+	router.PUT("/polls/:uid/vote", idempotent, requireWork, votePoll) // vote on poll options
+
+	// Create login routes
+	router.GET("/login", login)            // log in at the identity provider
+	router.GET("/callback", loginCallback) // identity provider callback
+	router.POST("/logout", logout)         // log out
+	router.GET("/me", getMe)               // get the logged in identity
+
+	// Create board routes
+	router.GET("/boards", getBoards)                                // list boards
+	router.POST("/boards", createBoard)                             // submit a new board
+	router.GET("/boards/:id/toptopic", getBoardTopTopic)            // get board's top topic
+	router.POST("/boards/:id/topics", idempotent, createBoardTopic) // submit a new topic to board
+
+	// Create admin routes
+	admin := router.Group("/admin")
+	admin.GET("/export", requireAdmin, exportTopics)      // dump all topics
+	admin.POST("/import", requireAdmin, importTopics)     // load a topics dump
+	admin.GET("/audit", requireAdmin, listAudit)          // query the audit log
+	admin.GET("/audit/export", requireAdmin, exportAudit) // dump the audit log as JSON lines
+
+	// Create moderator routes
+	admin.GET("/topics", requireAdmin, listTopics)                       // list topics by state
+	admin.POST("/topics/:uid/approve", requireAdmin, approveTopic)       // publish a topic
+	admin.POST("/topics/:uid/reject", requireAdmin, rejectTopic)         // delete a topic
+	admin.POST("/topics/:uid/hide", requireAdmin, hideTopic)             // hide a topic
+	admin.PUT("/topics/:uid/votes", requireAdmin, setTopicVotes)         // set vote counts
+	admin.PATCH("/topics/:uid/votes", requireAdmin, adjustTopicVotes)    // adjust vote counts by signed deltas
+	admin.GET("/topics/:uid/corrections", requireAdmin, listCorrections) // list vote count corrections
+	admin.GET("/reports", requireAdmin, listReports)                     // list reported topics
+	admin.POST("/credits/reset", requireAdmin, resetCredits)             // start a new credit round
+
+	// Create anomaly routes
+	admin.GET("/anomalies", requireAdmin, listAnomalies)               // list suspicious voters
+	admin.POST("/anomalies/:id/release", requireAdmin, releaseAnomaly) // count quarantined votes
+	admin.POST("/anomalies/:id/dismiss", requireAdmin, dismissAnomaly) // drop quarantined votes
+
+	// Create alert routes
+	admin.GET("/alerts", requireAdmin, listAlerts)                   // list the latest alerts
+	admin.GET("/alerts/rules", requireAdmin, listAlertRules)         // list alert rules
+	admin.POST("/alerts/rules", requireAdmin, createAlertRule)       // create an alert rule
+	admin.GET("/alerts/rules/:id", requireAdmin, getAlertRule)       // get an alert rule
+	admin.PUT("/alerts/rules/:id", requireAdmin, updateAlertRule)    // replace an alert rule
+	admin.DELETE("/alerts/rules/:id", requireAdmin, deleteAlertRule) // delete an alert rule
+
+	// Create webhook routes
+	admin.GET("/webhooks/dead-letters", requireAdmin, listDeadLetters)                    // list failed webhook deliveries
+	admin.POST("/webhooks/dead-letters/:id/redeliver", requireAdmin, redeliverDeadLetter) // retry a failed webhook delivery
 
 	return router
 }
@@ -50,30 +160,45 @@ func getTopic(c *gin.Context) {
 	}
 
 	// Get topic
-	_, ok := cache.GetTopic(uid)
+	topic, ok := getVisibleTopic(uid)
 	if ok == false {
 		glog.Errorf("Get topic %v failed", uid)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Topic not exist"})
 		return
 	}
 
-	name := cache.GetTopicName(uid)
-	up := cache.GetTopicUpvote(uid)
-	down := cache.GetTopicDownvote(uid)
-
-	c.JSON(http.StatusOK, &cache.Topic{UID: uid, Name: name, Upvote: up, Downvote: down})
+	c.JSON(http.StatusOK, topic)
 	return
 }
 
 // getTopTopic returns top 20 topics (sorted by upvotes, descending)
+// having all the tags given by the tag query parameters
 func getTopTopic(c *gin.Context) {
-	topicUpvoteDescend := cache.GetTopicDescendUpvote()
-	if len(topicUpvoteDescend) > maxTopTopics {
-		c.JSON(http.StatusOK, topicUpvoteDescend[:maxTopTopics])
+	respondTopTopics(c, cache.WithTags(c.QueryArray("tag")...))
+}
+
+// respondTopTopics responds with the top visible topics matching all
+// filters, ordered by the order query parameter: upvote (default) or
+// effective votes, the upvotes less the downvotes
+func respondTopTopics(c *gin.Context, filters ...cache.TopicFilter) {
+	var topics []cache.Topic
+	switch order := c.DefaultQuery("order", "upvote"); order {
+	case "upvote":
+		topics = cache.GetTopicDescendUpvote(filters...)
+	case "effective":
+		topics = cache.GetTopicDescendEffective(filters...)
+	default:
+		glog.Errorf("Invalid input order: %v", order)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input order"})
+		return
+	}
+
+	if len(topics) > maxTopTopics {
+		c.JSON(http.StatusOK, topics[:maxTopTopics])
 		return
 	}
 
-	c.JSON(http.StatusOK, topicUpvoteDescend)
+	c.JSON(http.StatusOK, topics)
 	return
 }
 
@@ -86,15 +211,52 @@ func createTopic(c *gin.Context) {
 		return
 	}
 
-	// Topic should not exceed 255 characters.
-	if len(t.Name) > maxTopicNameLen {
-		glog.Errorf("Topic name length exceeds length %d", maxTopicNameLen)
-		c.JSON(http.StatusBadRequest, gin.H{"message": "Topic name over length"})
+	addTopic(c, t)
+}
+
+// addTopic validates and creates topic t, then responds with the new topic.
+func addTopic(c *gin.Context, t cache.Topic) {
+	if errs := validateTopic(&t, false); len(errs) > 0 {
+		glog.Errorf("Invalid topic %q: %v", t.Name, errs)
+		respondInvalid(c, errs)
 		return
 	}
 
+	// Attach the verified identity, restricted topics are for company accounts
+	t.CreatedBy = ""
+	if identity, ok := currentIdentity(c); ok {
+		t.CreatedBy = identity.String()
+	}
+	if t.Restricted && !requireCompanyAccount(c) {
+		return
+	}
+
+	result := topicModerator.Moderate(t)
+	switch result.Decision {
+	case moderation.Reject:
+		glog.Errorf("Topic %q rejected by moderation: %v", t.Name, result.Reason)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Topic rejected by moderation", "reason": result.Reason})
+		return
+	case moderation.Hold:
+		glog.Infof("Topic %q held for approval: %v", t.Name, result.Reason)
+		t.State = cache.StatePending
+	default:
+		t.State = cache.StateVisible
+	}
+
 	// Create new topic
-	uid, err := cache.CreateTopic(t.Name)
+	uid, err := cache.NewTopic(t)
+	if err == cache.ErrTopicExists {
+		glog.Errorf("Topic %v already exist as %v", t.Name, uid)
+		existing, _ := cache.GetTopic(uid)
+		c.JSON(http.StatusConflict, gin.H{"message": "Topic already exist", "topic": existing})
+		return
+	}
+	if err == cache.ErrBoardNotFound {
+		glog.Errorf("Board %v not exist", t.Board)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Board not exist"})
+		return
+	}
 	if err != nil {
 		glog.Errorf("Create topic %v err: %v", t.Name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Create topic failed"})
@@ -102,13 +264,34 @@ func createTopic(c *gin.Context) {
 	}
 
 	topic, _ := cache.GetTopic(uid)
+	recordAudit(c, audit.Entry{Action: "topic.create", Target: uid.String(), After: topic})
+
+	// Pending topics are accepted but not live yet
+	if topic.State == cache.StatePending {
+		c.JSON(http.StatusAccepted, topic)
+		return
+	}
+	publishCreated(topic)
 
 	c.JSON(http.StatusOK, topic)
 	return
 }
 
-// updateTopicUpvote implements the RESTful PUT API.
-func updateTopicUpvote(c *gin.Context) {
+var (
+	// errWindowForbidden aborts a voting window edit by another user than
+	// the topic creator or an admin
+	errWindowForbidden = errors.New("voting window edit forbidden")
+	// errModerationRejected aborts a topic edit rejected by moderation
+	errModerationRejected = errors.New("topic edit rejected by moderation")
+)
+
+// updateTopic implements the RESTful PUT API.
+// An empty name keeps the topic name, absent tags keep the topic tags,
+// an empty description and URL keep the topic details and absent window
+// bounds keep the voting window. The author is set on creation only.
+// Edited names, tags and details are moderated like new topics, the voting
+// window is only changed by the topic creator or an admin.
+func updateTopic(c *gin.Context) {
 	var t cache.Topic
 	if err := c.ShouldBindJSON(&t); err != nil {
 		glog.Error(err)
@@ -116,41 +299,214 @@ func updateTopicUpvote(c *gin.Context) {
 		return
 	}
 
-	_, ok := cache.GetTopic(t.UID)
-	if ok == false {
+	if errs := validateTopic(&t, true); len(errs) > 0 {
+		glog.Errorf("Invalid topic %v: %v", t.UID, errs)
+		respondInvalid(c, errs)
+		return
+	}
+
+	// The edit is checked and applied in one write
+	admin := isAdmin(c)
+	identity, loggedIn := currentIdentity(c)
+	var result moderation.Result
+	old, topic, err := cache.EditTopic(t.UID, func(v *cache.Topic) error {
+		if v.State != cache.StateVisible {
+			return cache.ErrTopicNotFound
+		}
+		if (t.OpensAt != nil || t.ClosesAt != nil) && !admin && !(loggedIn && v.CreatedBy == identity.String()) {
+			return errWindowForbidden
+		}
+
+		edited := *v
+		if t.Name != "" {
+			edited.Name = t.Name
+		}
+		if t.Tags != nil {
+			edited.Tags = cache.NormalizeTags(t.Tags)
+		}
+		if t.Description != "" {
+			edited.Description = t.Description
+		}
+		if t.URL != "" {
+			edited.URL = t.URL
+		}
+		if t.OpensAt != nil {
+			edited.OpensAt = t.OpensAt
+		}
+		if t.ClosesAt != nil {
+			edited.ClosesAt = t.ClosesAt
+		}
+
+		// Edited text passes the moderation of new topics, a held topic
+		// goes back to pending
+		if edited.Name != v.Name || edited.Description != v.Description || edited.URL != v.URL || !reflect.DeepEqual(edited.Tags, v.Tags) {
+			result = topicModerator.Moderate(edited)
+			switch result.Decision {
+			case moderation.Reject:
+				return errModerationRejected
+			case moderation.Hold:
+				edited.State = cache.StatePending
+			}
+		}
+		*v = edited
+		return nil
+	})
+	switch err {
+	case nil:
+	case cache.ErrTopicNotFound:
 		glog.Errorf("UUID %v not exist", t.UID)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "UUID not exist"})
 		return
+	case errWindowForbidden:
+		glog.Errorf("Voting window of topic %v edited by %v: %v", t.UID, c.ClientIP(), err)
+		c.JSON(http.StatusForbidden, gin.H{"message": "Only the topic creator or an admin may change the voting window"})
+		return
+	case errModerationRejected:
+		glog.Errorf("Topic %v edit rejected by moderation: %v", t.UID, result.Reason)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Topic rejected by moderation", "reason": result.Reason})
+		return
+	case cache.ErrInvalidWindow:
+		glog.Errorf("Invalid topic %v window: %v", t.UID, err)
+		respondInvalid(c, validation.Errors{{Field: "closesAt", Message: "Topic must close after it opens"}})
+		return
+	case cache.ErrTopicExists:
+		glog.Errorf("Topic %v already exist", t.Name)
+		existing, _ := cache.FindTopicByName(old.Board, t.Name)
+		c.JSON(http.StatusConflict, gin.H{"message": "Topic already exist", "topic": existing})
+		return
+	default:
+		glog.Errorf("Update topic %v err: %v", t.UID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Update topic failed"})
+		return
 	}
+	recordAudit(c, audit.Entry{Action: "topic.update", Target: t.UID.String(), Before: old, After: topic})
 
-	// Set data
-	_ = cache.IncTopicUpvote(t.UID)
-	topic, _ := cache.GetTopic(t.UID)
-
+	// Held topics are accepted but not live until approved again
+	if result.Decision == moderation.Hold {
+		c.JSON(http.StatusAccepted, topic)
+		return
+	}
 	c.JSON(http.StatusOK, topic)
 	return
 }
 
+// voteRequest is the JSON body of a topic vote
+type voteRequest struct {
+	UID uuid.UUID `json:"uid"`
+	// Votes is the number of votes cast at once, 1 by default. More votes
+	// need vote credits.
+	Votes uint64 `json:"votes"`
+}
+
+// updateTopicUpvote implements the RESTful PUT API.
+func updateTopicUpvote(c *gin.Context) {
+	updateTopicVote(c, true)
+}
+
 // updateTopicDownvote implements the RESTful PUT API.
 func updateTopicDownvote(c *gin.Context) {
-	var t cache.Topic
-	if err := c.ShouldBindJSON(&t); err != nil {
+	updateTopicVote(c, false)
+}
+
+// updateTopicVote counts the upvotes or downvotes of the JSON body, then
+// responds with the topic
+func updateTopicVote(c *gin.Context, up bool) {
+	var v voteRequest
+	if err := c.ShouldBindJSON(&v); err != nil {
 		glog.Error(err)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
 		return
 	}
+	if v.Votes == 0 {
+		v.Votes = 1
+	}
+	if v.Votes > 1 && voteCredits == 0 {
+		glog.Errorf("Weighted vote on topic %v without credits", v.UID)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Weighted votes require credits"})
+		return
+	}
+	if voteCredits > 0 && v.Votes > maxCreditVotes() {
+		glog.Errorf("%d votes on topic %v exceed the credits", v.Votes, v.UID)
+		c.JSON(http.StatusForbidden, gin.H{"message": "Insufficient credits"})
+		return
+	}
 
-	_, ok := cache.GetTopic(t.UID)
+	topic, ok := getVisibleTopic(v.UID)
 	if ok == false {
-		glog.Errorf("UUID %v not exist", t.UID)
+		glog.Errorf("UUID %v not exist", v.UID)
 		c.JSON(http.StatusBadRequest, gin.H{"message": "UUID not exist"})
 		return
 	}
 
+	if err := topic.CheckOpen(time.Now()); err != nil {
+		respondVoteRefused(c, topic, err)
+		return
+	}
+
+	// With credits the voter spends them, else votes once per topic
+	var refund func()
+	if voteCredits > 0 {
+		refund, ok = spendCredits(c, topic, up, v.Votes)
+	} else {
+		refund, ok = recordVoter(c, topic.UID, topic.Restricted, up)
+	}
+	if !ok {
+		return
+	}
+
 	// Set data
-	_ = cache.IncTopicDownvote(t.UID)
-	topic, _ := cache.GetTopic(t.UID)
+	before := countsOf(topic)
+	decision, err := countVote(c, v.UID, up, v.Votes)
+	if err != nil {
+		refund()
+		respondVoteRefused(c, topic, err)
+		return
+	}
+	// Held or dropped votes cost nothing and fire no event until released
+	if !counted(decision) {
+		refund()
+		c.JSON(http.StatusOK, topic)
+		return
+	}
+	topic, _ = cache.GetTopic(v.UID)
+
+	action := "topic.downvote"
+	if up {
+		action = "topic.upvote"
+	}
+	recordAudit(c, audit.Entry{Action: action, Target: v.UID.String(), Before: before, After: countsOf(topic)})
+	publishVoted(v.UID)
 
 	c.JSON(http.StatusOK, topic)
 	return
 }
+
+// respondVoteRefused responds with the reason a vote on topic was refused
+func respondVoteRefused(c *gin.Context, topic *cache.Topic, err error) {
+	glog.Errorf("Vote on topic %v refused: %v", topic.UID, err)
+	switch err {
+	case cache.ErrPollNotOpen:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Poll not open yet", "opensAt": topic.OpensAt})
+	case cache.ErrPollClosed:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Poll closed", "closesAt": topic.ClosesAt})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "UUID not exist"})
+	}
+}
+
+// queryLimit parses the limit query parameter, it responds with an error
+// and returns false when the limit is invalid
+func queryLimit(c *gin.Context, defaultLimit, maxLimit int) (int, bool) {
+	input := c.Query("limit")
+	if input == "" {
+		return defaultLimit, true
+	}
+
+	limit, err := strconv.Atoi(input)
+	if err != nil || limit < 1 || limit > maxLimit {
+		glog.Errorf("Invalid input limit: %v", input)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input limit"})
+		return 0, false
+	}
+	return limit, true
+}
@@ -192,7 +192,7 @@ func TestCreateTopicOverLen(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, resp.Code)
 
 	// Convert the JSON response to a map
-	var respBody map[string]string
+	var respBody map[string]interface{}
 	err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
 
 	// Grab the value & whether or not it exists
@@ -203,6 +203,7 @@ func TestCreateTopicOverLen(t *testing.T) {
 	assert.Nil(t, err)
 	assert.True(t, exist)
 	assert.Equal(t, expected["message"], actual)
+	assert.Equal(t, []interface{}{map[string]interface{}{"field": "name", "message": "Topic name over length"}}, respBody["errors"])
 }
 
 func TestUpdateUpvoteNotExist(t *testing.T) {
@@ -342,3 +343,117 @@ func TestUpdateDownvoteOK(t *testing.T) {
 	assert.Nil(t, err)
 	assert.EqualValues(t, 1, respBody.Downvote)
 }
+
+func TestUpdateTopic(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.NewTopic(cache.Topic{Name: "5-4", Tags: []string{"old"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	tests := []struct {
+		body     string
+		expected cache.Topic
+	}{
+		{fmt.Sprintf(`{"uid": "%v", "tags": ["New", "go"]}`, uid), cache.Topic{UID: uid, Name: "5-4", Tags: []string{"go", "new"}}},
+		{fmt.Sprintf(`{"uid": "%v", "name": "5-4-renamed"}`, uid), cache.Topic{UID: uid, Name: "5-4-renamed", Tags: []string{"go", "new"}}},
+		{fmt.Sprintf(`{"uid": "%v", "tags": []}`, uid), cache.Topic{UID: uid, Name: "5-4-renamed"}},
+		{fmt.Sprintf(`{"uid": "%v", "description": "**why**"}`, uid), cache.Topic{UID: uid, Name: "5-4-renamed", Description: "**why**"}},
+		{fmt.Sprintf(`{"uid": "%v", "url": "https://example.com"}`, uid), cache.Topic{UID: uid, Name: "5-4-renamed", Description: "**why**", URL: "https://example.com"}},
+	}
+
+	for _, test := range tests {
+		// Perform a PUT request with that handler.
+		req, _ := http.NewRequest("PUT", "/topic", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var respBody cache.Topic
+		err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, respBody)
+	}
+}
+
+func TestCreateTopicDetails(t *testing.T) {
+	router := SetupRouter()
+
+	reqBody := cache.Topic{Name: "1-2", Description: "# Agenda\n- item", URL: "https://example.com/1-2", Author: "jenting"}
+	b, err := json.Marshal(reqBody)
+	assert.Equal(t, nil, err, "JSON marshal failed")
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBuffer(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 200
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var respBody cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Equal(t, reqBody.Description, respBody.Description)
+	assert.Equal(t, reqBody.URL, respBody.URL)
+	assert.Equal(t, reqBody.Author, respBody.Author)
+}
+
+func TestCreateTopicInvalidDetails(t *testing.T) {
+	router := SetupRouter()
+
+	tests := []struct {
+		topic   cache.Topic
+		message string
+	}{
+		{cache.Topic{Name: "1-3", Description: randStringRunes(maxTopicDescriptionLen + 1)}, "Topic description over length"},
+		{cache.Topic{Name: "1-3", URL: "https://example.com/" + randStringRunes(maxTopicURLLen)}, "Topic URL over length"},
+		{cache.Topic{Name: "1-3", URL: "javascript:alert(1)"}, "Invalid topic URL"},
+		{cache.Topic{Name: "1-3", Author: randStringRunes(maxTopicAuthorLen + 1)}, "Topic author over length"},
+	}
+
+	for _, test := range tests {
+		b, err := json.Marshal(test.topic)
+		assert.Equal(t, nil, err, "JSON marshal failed")
+
+		// Perform a POST request with that handler.
+		req, _ := http.NewRequest("POST", "/topic", bytes.NewBuffer(b))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		// Assert we encoded correctly, the request gives a 400
+		assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+		var respBody map[string]interface{}
+		err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+		assert.Nil(t, err)
+		assert.Equal(t, test.message, respBody["message"])
+	}
+}
+
+func TestTrustedProxies(t *testing.T) {
+	clientIP := func() string {
+		router := SetupRouter()
+		router.GET("/client-ip", func(c *gin.Context) { c.String(http.StatusOK, c.ClientIP()) })
+
+		// Perform a GET request with that handler.
+		req, _ := http.NewRequest("GET", "/client-ip", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-Forwarded-For", "203.0.113.7")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Body.String()
+	}
+
+	// Forwarding headers are ignored by default
+	assert.Equal(t, "10.0.0.1", clientIP())
+
+	assert.Nil(t, SetTrustedProxies([]string{"10.0.0.0/8"}))
+	defer SetTrustedProxies(nil)
+	assert.Equal(t, "203.0.113.7", clientIP())
+
+	assert.NotNil(t, SetTrustedProxies([]string{"proxy"}))
+}
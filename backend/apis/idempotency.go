@@ -0,0 +1,131 @@
+package apis
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/idempotency"
+)
+
+const (
+	// IdempotencyHeader is the request header holding the idempotency key
+	IdempotencyHeader = "Idempotency-Key"
+	// ReplayedHeader is set on responses replayed for a retried request
+	ReplayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLen    = 255
+	defaultIdempotencyKeys  = 10000
+	defaultIdempotencyTTL   = 24 * time.Hour
+	maxIdempotentRequestLen = 4 << 20
+)
+
+// idempotencyStore keeps the responses of the requests with an idempotency key
+var idempotencyStore = idempotency.New(defaultIdempotencyKeys, defaultIdempotencyTTL)
+
+// SetIdempotencyStore sets the store of the responses by idempotency key.
+// It is not safe to call while serving.
+func SetIdempotencyStore(s *idempotency.Store) {
+	idempotencyStore = s
+}
+
+// recordingWriter keeps a copy of the response body
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotent replays the stored response of a request retried with the
+// same Idempotency-Key header instead of applying it again. Keys are
+// scoped by client, method and route. Reusing a key for another request
+// gets 422, retrying while the first request is applied gets 409. Server
+// errors and the rejections of the proof of work gate are not stored, so
+// that the request can be retried.
+func idempotent(c *gin.Context) {
+	key := c.GetHeader(IdempotencyHeader)
+	if key == "" {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLen {
+		glog.Errorf("Invalid idempotency key of length %d", len(key))
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid idempotency key"})
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxIdempotentRequestLen+1))
+	if err != nil {
+		glog.Errorf("Read request body err: %v", err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+		return
+	}
+	if len(body) > maxIdempotentRequestLen {
+		glog.Errorf("Request body with idempotency key %q too large", key)
+		c.AbortWithStatusJSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Request body too large"})
+		return
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	// Clients without voter identity are told apart by token or IP
+	client := voterID(c)
+	if client == "" {
+		client = requestActor(c)
+	}
+	scope := client + " " + c.Request.Method + " " + c.FullPath() + " " + key
+	sum := sha256.Sum256(append([]byte(c.Request.URL.Path+"\n"), body...))
+	fingerprint := hex.EncodeToString(sum[:])
+
+	stored, state := idempotencyStore.Begin(scope, fingerprint)
+	switch state {
+	case idempotency.InFlight:
+		glog.Errorf("Idempotency key %q in use", key)
+		c.AbortWithStatusJSON(http.StatusConflict, gin.H{"message": "Request in progress"})
+		return
+	case idempotency.Mismatch:
+		glog.Errorf("Idempotency key %q reused for another request", key)
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"message": "Idempotency key reused for another request"})
+		return
+	case idempotency.Replay:
+		glog.Infof("Replay response of idempotency key %q", key)
+		for name, values := range stored.Header {
+			c.Writer.Header()[name] = values
+		}
+		c.Header(ReplayedHeader, "true")
+		c.Writer.WriteHeader(stored.Status)
+		c.Writer.Write(stored.Body)
+		c.Abort()
+		return
+	}
+
+	w := &recordingWriter{ResponseWriter: c.Writer}
+	c.Writer = w
+	c.Next()
+
+	// The rejections of the gates after this middleware are not stored,
+	// so that a retry passing them is applied
+	if c.IsAborted() || w.Status() >= http.StatusInternalServerError {
+		idempotencyStore.Abort(scope)
+		return
+	}
+	idempotencyStore.Finish(scope, idempotency.Response{
+		Status: w.Status(),
+		Header: w.Header().Clone(),
+		Body:   w.body.Bytes(),
+	})
+}
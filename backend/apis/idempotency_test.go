@@ -0,0 +1,99 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotentVote(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("20-1 Idempotent vote")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	vote := func(key string, id interface{}) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, id)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyHeader, key)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	first := vote("vote-1", uid)
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Equal(t, "", first.Header().Get(ReplayedHeader))
+
+	// Retries replay the first response without counting again
+	for i := 0; i < 3; i++ {
+		retry := vote("vote-1", uid)
+		assert.Equal(t, http.StatusOK, retry.Code)
+		assert.Equal(t, "true", retry.Header().Get(ReplayedHeader))
+		assert.Equal(t, first.Body.String(), retry.Body.String())
+		assert.Equal(t, first.Header().Get("Content-Type"), retry.Header().Get("Content-Type"))
+	}
+	assert.EqualValues(t, 1, cache.GetTopicUpvote(uid))
+
+	// Another key counts again
+	assert.Equal(t, http.StatusOK, vote("vote-2", uid).Code)
+	assert.EqualValues(t, 2, cache.GetTopicUpvote(uid))
+
+	// The same key for another request is refused
+	other, err := cache.CreateTopic("20-2 Idempotent vote")
+	assert.Equal(t, nil, err, "Create topic failed")
+	assert.Equal(t, http.StatusUnprocessableEntity, vote("vote-1", other).Code)
+	assert.EqualValues(t, 0, cache.GetTopicUpvote(other))
+
+	// Anonymous clients do not share the keys
+	req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IdempotencyHeader, "vote-1")
+	req.RemoteAddr = "10.0.20.1:1234"
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "", resp.Header().Get(ReplayedHeader))
+	assert.EqualValues(t, 3, cache.GetTopicUpvote(uid))
+
+	// Errors are replayed as well
+	assert.Equal(t, http.StatusBadRequest, vote("vote-3", "not-a-uuid").Code)
+	assert.Equal(t, http.StatusBadRequest, vote("vote-3", "not-a-uuid").Code)
+
+	assert.Equal(t, http.StatusBadRequest, vote(strings.Repeat("k", 256), uid).Code)
+}
+
+func TestIdempotentCreateTopic(t *testing.T) {
+	router := SetupRouter()
+
+	create := func(key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "20-3 Idempotent create"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyHeader, key)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	first := create("create-1")
+	assert.Equal(t, http.StatusOK, first.Code)
+	retry := create("create-1")
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+
+	// Without the key the duplicate is detected by name
+	assert.Equal(t, http.StatusConflict, create("").Code)
+
+	var topic cache.Topic
+	err := json.Unmarshal([]byte(first.Body.String()), &topic)
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, ok := cache.GetTopic(topic.UID)
+	assert.Equal(t, true, ok, "The topic should exist")
+}
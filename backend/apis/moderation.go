@@ -0,0 +1,139 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/moderation"
+)
+
+// topicModerator decides whether new and edited topics go live, the zero
+// filter allows every topic.
+var topicModerator moderation.Moderator = &moderation.Filter{}
+
+// SetModerator sets the moderation hook applied to new and edited topics.
+// It is not safe to call while serving.
+func SetModerator(m moderation.Moderator) {
+	topicModerator = m
+}
+
+// getVisibleTopic gets a topic which is visible to the public APIs.
+func getVisibleTopic(uid uuid.UUID) (*cache.Topic, bool) {
+	topic, ok := cache.GetTopic(uid)
+	if !ok || topic.State != cache.StateVisible {
+		return nil, false
+	}
+	return topic, true
+}
+
+// listTopics returns all topics in the state query parameter, default pending
+func listTopics(c *gin.Context) {
+	state, err := cache.ParseTopicState(c.DefaultQuery("state", string(cache.StatePending)))
+	if err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input state"})
+		return
+	}
+
+	c.JSON(http.StatusOK, cache.ListTopics(cache.InState(state)))
+	return
+}
+
+// approveTopic makes a pending or hidden topic visible, dismissing its reports
+func approveTopic(c *gin.Context) {
+	if uid, ok := moderateTopic(c, cache.StateVisible); ok {
+		cache.ClearTopicReports(uid)
+	}
+}
+
+// hideTopic hides a topic from the public APIs
+func hideTopic(c *gin.Context) {
+	moderateTopic(c, cache.StateHidden)
+}
+
+// moderateTopic sets the state of the topic given by the uid path parameter,
+// it returns the topic uid and false when it responded with an error
+func moderateTopic(c *gin.Context, state cache.TopicState) (uuid.UUID, bool) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return uuid.Nil, false
+	}
+
+	old, ok := cache.GetTopic(uid)
+	if !ok {
+		glog.Errorf("Get topic %v failed", uid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Topic not exist"})
+		return uuid.Nil, false
+	}
+	if err := cache.SetTopicState(uid, state); err != nil {
+		glog.Errorf("Set topic %v state %q err: %v", uid, state, err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Topic not exist"})
+		return uuid.Nil, false
+	}
+	glog.Infof("Topic %v moderated to state %q", uid, state)
+
+	// The topic may be deleted meanwhile
+	topic, ok := cache.GetTopic(uid)
+	if !ok {
+		glog.Errorf("Get topic %v failed", uid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Topic not exist"})
+		return uuid.Nil, false
+	}
+	action := "topic.hide"
+	if state == cache.StateVisible {
+		action = "topic.approve"
+	}
+	recordAudit(c, audit.Entry{Action: action, Target: uid.String(), Before: old.State, After: topic.State})
+	if old.State == cache.StatePending && state == cache.StateVisible {
+		publishCreated(topic)
+	}
+
+	c.JSON(http.StatusOK, topic)
+	return uid, true
+}
+
+// rejectTopic deletes a topic
+func rejectTopic(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	topic, ok := cache.GetTopic(uid)
+	if !ok {
+		glog.Errorf("Get topic %v failed", uid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Topic not exist"})
+		return
+	}
+
+	cache.DeleteTopic(uid)
+	glog.Infof("Topic %v rejected", uid)
+	recordAudit(c, audit.Entry{Action: "topic.reject", Target: uid.String(), Before: topic})
+
+	c.JSON(http.StatusOK, topic)
+	return
+}
+
+// paramUID parses the uid path parameter, it responds with an error and
+// returns false when the uid is invalid
+func paramUID(c *gin.Context) (uuid.UUID, bool) {
+	return paramUUID(c, "uid")
+}
+
+// paramUUID parses the UUID path parameter name, it responds with an error
+// and returns false when the UUID is invalid
+func paramUUID(c *gin.Context, name string) (uuid.UUID, bool) {
+	input := c.Param(name)
+	id, err := uuid.Parse(input)
+	if err != nil {
+		glog.Errorf("Invalid input %v: %v", name, input)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input " + name})
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,191 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/moderation"
+	"github.com/stretchr/testify/assert"
+)
+
+func withModerator(t *testing.T, cfg moderation.Config) {
+	filter, err := moderation.NewFilter(cfg)
+	assert.Nil(t, err)
+
+	saved := topicModerator
+	SetModerator(filter)
+	t.Cleanup(func() { SetModerator(saved) })
+}
+
+func TestCreateTopicRejected(t *testing.T) {
+	router := SetupRouter()
+	withModerator(t, moderation.Config{Words: []string{"forbidden"}})
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "9-1 Forbidden topic"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 422
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Code)
+
+	var respBody map[string]string
+	err := json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Equal(t, "Topic rejected by moderation", respBody["message"])
+	assert.Equal(t, `blocklisted word "forbidden"`, respBody["reason"])
+
+	_, ok := cache.FindTopicByName("", "9-1 Forbidden topic")
+	assert.False(t, ok, "The topic should not be created")
+}
+
+func TestModerateTopic(t *testing.T) {
+	router := SetupRouter()
+	withModerator(t, moderation.Config{RequireApproval: true})
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "9-2 Needs approval", "state": ""}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 202
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	var topic cache.Topic
+	err := json.Unmarshal([]byte(resp.Body.String()), &topic)
+	assert.Nil(t, err)
+	assert.Equal(t, cache.StatePending, topic.State)
+
+	// Pending topics are not public
+	assertPublic := func(public bool) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/topic?uid=%v", topic.UID), nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if public {
+			assert.Equal(t, http.StatusOK, resp.Code)
+		} else {
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		}
+
+		req, _ = http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, topic.UID)))
+		req.Header.Set("Content-Type", "application/json")
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		if public {
+			assert.Equal(t, http.StatusOK, resp.Code)
+		} else {
+			assert.Equal(t, http.StatusBadRequest, resp.Code)
+		}
+
+		found := false
+		for _, v := range cache.GetTopicDescendUpvote() {
+			found = found || v.UID == topic.UID
+		}
+		assert.Equal(t, public, found)
+	}
+	assertPublic(false)
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/admin/topics?state=pending", nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var pending []cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &pending)
+	assert.Nil(t, err)
+	assert.Contains(t, pending, topic)
+
+	// Only admins moderate the topics
+	for _, action := range []string{"approve", "hide", "reject"} {
+		req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/topics/%v/%v", topic.UID, action), nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, action)
+	}
+	req, _ = http.NewRequest("GET", "/admin/topics?state=pending", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+	assertPublic(false)
+
+	for _, test := range []struct {
+		action string
+		state  cache.TopicState
+		public bool
+	}{
+		{"approve", cache.StateVisible, true},
+		{"hide", cache.StateHidden, false},
+		{"approve", cache.StateVisible, true},
+	} {
+		// Perform a POST request with that handler.
+		req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/topics/%v/%v", topic.UID, test.action), nil)
+		asAdmin(req)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		moderated, _ := cache.GetTopic(topic.UID)
+		assert.Equal(t, test.state, moderated.State)
+		assertPublic(test.public)
+	}
+
+	// Perform a POST request with that handler.
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/topics/%v/reject", topic.UID), nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	_, ok := cache.GetTopic(topic.UID)
+	assert.False(t, ok, "The rejected topic should be deleted")
+
+	for _, path := range []string{"/admin/topics/not-a-uid/hide", fmt.Sprintf("/admin/topics/%v/approve", topic.UID)} {
+		req, _ = http.NewRequest("POST", path, nil)
+		asAdmin(req)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.NotEqual(t, http.StatusOK, resp.Code, path)
+	}
+}
+
+func TestUpdateTopicModerated(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("9-3 Edited topic")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	update := func(body string) int {
+		// Perform a PUT request with that handler.
+		req, _ := http.NewRequest("PUT", "/topic", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	withModerator(t, moderation.Config{Words: []string{"forbidden"}, OnMatch: "reject"})
+	// Rejected renames and descriptions change nothing
+	assert.Equal(t, http.StatusUnprocessableEntity, update(fmt.Sprintf(`{"uid": "%v", "name": "9-3 Forbidden topic"}`, uid)))
+	assert.Equal(t, http.StatusUnprocessableEntity, update(fmt.Sprintf(`{"uid": "%v", "description": "A forbidden word"}`, uid)))
+	topic, _ := cache.GetTopic(uid)
+	assert.Equal(t, cache.Topic{UID: uid, Name: "9-3 Edited topic"}, *topic)
+
+	// Edits leaving the text alone are not moderated
+	withModerator(t, moderation.Config{RequireApproval: true})
+	assert.Equal(t, http.StatusOK, update(fmt.Sprintf(`{"uid": "%v", "name": "9-3 Edited topic"}`, uid)))
+
+	// A held edit is applied and waits for approval again
+	assert.Equal(t, http.StatusAccepted, update(fmt.Sprintf(`{"uid": "%v", "description": "Needs a look"}`, uid)))
+	topic, _ = cache.GetTopic(uid)
+	assert.Equal(t, "Needs a look", topic.Description)
+	assert.Equal(t, cache.StatePending, topic.State)
+}
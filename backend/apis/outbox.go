@@ -0,0 +1,38 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/outbox"
+)
+
+// changeOutbox publishes the topic changes, nil when they are not published
+var changeOutbox *outbox.Outbox
+
+// SetOutbox sets the outbox publishing the topic changes, the changes are
+// refused while it is full. It is not safe to call while serving.
+func SetOutbox(o *outbox.Outbox) {
+	changeOutbox = o
+}
+
+// requireOutbox aborts the requests which may change topics with 503
+// Service Unavailable while the outbox is full, so that no change goes
+// unpublished
+func requireOutbox(c *gin.Context) {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+		return
+	}
+	if changeOutbox == nil || !changeOutbox.Full() {
+		c.Next()
+		return
+	}
+
+	glog.Errorf("Refused %v %v from %v: outbox full", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+	c.Header("Retry-After", "1")
+	c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Too many unpublished changes"})
+}
@@ -0,0 +1,47 @@
+package apis
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/outbox"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOutboxBackpressure(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("28-1 Outbox")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	box := outbox.New(1)
+	SetOutbox(box)
+	defer SetOutbox(nil)
+
+	vote := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+	assert.Equal(t, http.StatusOK, vote().Code)
+
+	// A full outbox refuses the changes, not the reads
+	_, err = box.Append("voting.topic.voted", nil)
+	assert.Nil(t, err)
+	resp := vote()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get("Retry-After"))
+	assert.EqualValues(t, 1, cache.GetTopicUpvote(uid))
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/topic?uid=%v", uid), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+}
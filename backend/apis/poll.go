@@ -0,0 +1,295 @@
+package apis
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/moderation"
+	"github.com/jenting/voting-topic/backend/tally"
+	"github.com/jenting/voting-topic/backend/validation"
+)
+
+// pollRules validate the text fields of a poll
+var pollRules = validation.Rules{
+	"name":   {Field: "name", Label: "Poll name", Required: true, MaxLen: maxTopicNameLen, Trim: true},
+	"option": {Field: "options", Label: "Poll option", Required: true, MaxLen: maxPollOptionLen, Trim: true},
+}
+
+// pollRequest is the JSON body creating a poll, options are given by name
+type pollRequest struct {
+	Name       string         `json:"name"`
+	Mode       cache.PollMode `json:"mode"`
+	Method     tally.Method   `json:"method"`
+	MaxChoices int            `json:"maxChoices"`
+	Options    []string       `json:"options"`
+	Restricted bool           `json:"restricted"`
+	OpensAt    *time.Time     `json:"opensAt"`
+	ClosesAt   *time.Time     `json:"closesAt"`
+}
+
+// pollResults is the JSON body of the poll results
+type pollResults struct {
+	UID     uuid.UUID            `json:"uid"`
+	Name    string               `json:"name"`
+	Voters  uint64               `json:"voters"`
+	Closed  bool                 `json:"closed"`
+	Ranking cache.PollOptionList `json:"ranking"`
+	// Tally counts the ballots by the poll method
+	Tally tally.Result `json:"tally"`
+}
+
+// validatePoll checks the fields of poll request p and normalizes them in place
+func validatePoll(p *pollRequest) validation.Errors {
+	var errs validation.Errors
+
+	name, fe := pollRules["name"].Apply(p.Name)
+	if fe != nil {
+		errs = append(errs, *fe)
+	}
+	p.Name = name
+
+	mode, err := cache.ParsePollMode(string(p.Mode))
+	if err != nil {
+		errs.Add("mode", "Poll mode must be single, multi or ranked")
+	}
+	p.Mode = mode
+
+	if p.Method != "" {
+		method, err := tally.ParseMethod(string(p.Method))
+		if err != nil || method.Ranked() != (mode == cache.PollRanked) {
+			errs.Add("method", "Poll method must be irv, borda or schulze for ranked polls, approval otherwise")
+		}
+		p.Method = method
+	}
+
+	if len(p.Options) < minPollOptions || len(p.Options) > maxPollOptions {
+		errs.Add("options", "Poll must have 2 to 20 options")
+	}
+	seen := make(map[string]bool, len(p.Options))
+	for i, option := range p.Options {
+		v, fe := pollRules["option"].Apply(option)
+		if fe != nil {
+			errs = append(errs, *fe)
+			continue
+		}
+		key := cache.NormalizeName(v)
+		if seen[key] {
+			errs.Add("options", "Poll options must be unique")
+			continue
+		}
+		seen[key] = true
+		p.Options[i] = v
+	}
+
+	if p.MaxChoices < 0 || p.MaxChoices > len(p.Options) || (mode == cache.PollSingle && p.MaxChoices > 1) {
+		errs.Add("maxChoices", "Poll max choices out of range")
+	}
+	if err := cache.CheckWindow(p.OpensAt, p.ClosesAt); err != nil {
+		errs.Add("closesAt", "Poll must close after it opens")
+	}
+	return errs
+}
+
+// getPolls returns the polls with the most voters first
+func getPolls(c *gin.Context) {
+	limit, ok := queryLimit(c, maxTopTopics, maxTopTopics)
+	if !ok {
+		return
+	}
+
+	polls := cache.GetPollDescendVoters()
+	if len(polls) > limit {
+		c.JSON(http.StatusOK, polls[:limit])
+		return
+	}
+
+	c.JSON(http.StatusOK, polls)
+	return
+}
+
+// getPoll returns the poll given by the uid path parameter
+func getPoll(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	poll, ok := cache.GetPoll(uid)
+	if !ok {
+		glog.Errorf("Poll %v not exist", uid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Poll not exist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, poll)
+	return
+}
+
+// getPollResults returns the options of the poll given by the uid path
+// parameter ranked by votes, ties keep the option order, and the ballots
+// tallied by the poll method round by round
+func getPollResults(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	poll, ok := cache.GetPoll(uid)
+	ballots, _ := cache.GetPollBallots(uid)
+	if !ok {
+		glog.Errorf("Poll %v not exist", uid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Poll not exist"})
+		return
+	}
+
+	result, err := tally.Count(poll.Method, len(poll.Options), ballots)
+	if err != nil {
+		glog.Errorf("Tally poll %v err: %v", uid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Tally poll failed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pollResults{
+		UID:     poll.UID,
+		Name:    poll.Name,
+		Voters:  poll.Voters,
+		Closed:  poll.CheckOpen(time.Now()) == cache.ErrPollClosed,
+		Ranking: poll.Ranking(),
+		Tally:   result,
+	})
+	return
+}
+
+// createPoll implements the RESTful POST API of polls.
+// Polls have no pending state, so held polls are refused like rejected ones.
+func createPoll(c *gin.Context) {
+	var p pollRequest
+	if err := c.ShouldBindJSON(&p); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+
+	if errs := validatePoll(&p); len(errs) > 0 {
+		glog.Errorf("Invalid poll %q: %v", p.Name, errs)
+		respondInvalid(c, errs)
+		return
+	}
+
+	// Attach the verified identity, restricted polls are for company accounts
+	var createdBy string
+	if identity, ok := currentIdentity(c); ok {
+		createdBy = identity.String()
+	}
+	if p.Restricted && !requireCompanyAccount(c) {
+		return
+	}
+
+	result := topicModerator.Moderate(cache.Topic{Name: p.Name, Description: strings.Join(p.Options, "\n")})
+	if result.Decision != moderation.Allow {
+		glog.Errorf("Poll %q refused by moderation: %v", p.Name, result.Reason)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"message": "Poll rejected by moderation", "reason": result.Reason})
+		return
+	}
+
+	options := make([]cache.PollOption, len(p.Options))
+	for i, name := range p.Options {
+		options[i].Name = name
+	}
+	uid, err := cache.NewPoll(cache.Poll{
+		Name:       p.Name,
+		Mode:       p.Mode,
+		Method:     p.Method,
+		MaxChoices: p.MaxChoices,
+		Options:    options,
+		CreatedBy:  createdBy,
+		Restricted: p.Restricted,
+		OpensAt:    p.OpensAt,
+		ClosesAt:   p.ClosesAt,
+	})
+	if err != nil {
+		glog.Errorf("Create poll %v err: %v", p.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Create poll failed"})
+		return
+	}
+
+	poll, _ := cache.GetPoll(uid)
+	recordAudit(c, audit.Entry{Action: "poll.create", Target: uid.String(), After: poll})
+
+	c.JSON(http.StatusOK, poll)
+	return
+}
+
+// votePoll implements the RESTful PUT API voting on the options given by
+// id in the JSON body `{"choices"}`, the most preferred first for ranked
+// polls.
+func votePoll(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Choices []int `json:"choices"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+
+	poll, ok := cache.GetPoll(uid)
+	if !ok {
+		glog.Errorf("Poll %v not exist", uid)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Poll not exist"})
+		return
+	}
+
+	if err := poll.CheckOpen(time.Now()); err != nil {
+		respondPollVoteRefused(c, poll, err)
+		return
+	}
+	if err := poll.CheckChoices(body.Choices); err != nil {
+		respondPollVoteRefused(c, poll, err)
+		return
+	}
+
+	forget, ok := recordVoter(c, uid, poll.Restricted, true)
+	if !ok {
+		return
+	}
+
+	// Set data
+	if err := cache.VotePoll(uid, body.Choices); err != nil {
+		forget()
+		respondPollVoteRefused(c, poll, err)
+		return
+	}
+	poll, _ = cache.GetPoll(uid)
+	recordAudit(c, audit.Entry{Action: "poll.vote", Target: uid.String(), After: body.Choices})
+
+	c.JSON(http.StatusOK, poll)
+	return
+}
+
+// respondPollVoteRefused responds with the reason a vote on poll was refused
+func respondPollVoteRefused(c *gin.Context, poll *cache.Poll, err error) {
+	glog.Errorf("Vote on poll %v refused: %v", poll.UID, err)
+	switch err {
+	case cache.ErrPollNotOpen:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Poll not open yet", "opensAt": poll.OpensAt})
+	case cache.ErrPollClosed:
+		c.JSON(http.StatusForbidden, gin.H{"message": "Poll closed", "closesAt": poll.ClosesAt})
+	case cache.ErrInvalidChoice:
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid poll choices"})
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"message": "Poll not exist"})
+	}
+}
@@ -0,0 +1,182 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/tally"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreatePoll(t *testing.T) {
+	router := SetupRouter()
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"name": "16-1", "options": ["a"]}`, http.StatusBadRequest},
+		{`{"name": "16-2", "options": ["a", " A "]}`, http.StatusBadRequest},
+		{`{"name": "16-3", "mode": "weighted", "options": ["a", "b"]}`, http.StatusBadRequest},
+		{`{"name": "16-4", "maxChoices": 2, "options": ["a", "b"]}`, http.StatusBadRequest},
+		{`{"name": "", "options": ["a", "b"]}`, http.StatusBadRequest},
+		{`{"name": "16-5", "options": ["a", ""]}`, http.StatusBadRequest},
+		{`{"name": "16-6", "mode": "multi", "maxChoices": 2, "options": [" a ", "b", "c"]}`, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		req, _ := http.NewRequest("POST", "/polls", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, test.code, resp.Code, test.body)
+
+		if resp.Code != http.StatusOK {
+			continue
+		}
+		var poll cache.Poll
+		err := json.Unmarshal([]byte(resp.Body.String()), &poll)
+		assert.Equal(t, nil, err, "Create poll failed")
+		assert.Equal(t, cache.PollMulti, poll.Mode)
+		assert.Equal(t, []cache.PollOption{{ID: 0, Name: "a"}, {ID: 1, Name: "b"}, {ID: 2, Name: "c"}}, poll.Options)
+
+		// Perform a GET request with that handler.
+		req, _ = http.NewRequest("GET", fmt.Sprintf("/polls/%v", poll.UID), nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/polls/not-a-uuid", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
+
+func TestVotePoll(t *testing.T) {
+	// The ranking below only holds the polls of this test
+	cache.Reset()
+	router := SetupRouter()
+
+	create := func(body string) cache.Poll {
+		req, _ := http.NewRequest("POST", "/polls", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code, body)
+
+		var poll cache.Poll
+		_ = json.Unmarshal([]byte(resp.Body.String()), &poll)
+		return poll
+	}
+	vote := func(poll cache.Poll, choices string) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/polls/%v/vote", poll.UID), bytes.NewBufferString(`{"choices": `+choices+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var body map[string]interface{}
+		_ = json.Unmarshal([]byte(resp.Body.String()), &body)
+		return resp.Code, body
+	}
+
+	single := create(`{"name": "17-1 Lunch", "options": ["Pizza", "Sushi", "Tacos"]}`)
+	code, _ := vote(single, `[0, 1]`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = vote(single, `[3]`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	for _, choice := range []string{`[1]`, `[2]`, `[1]`} {
+		code, _ = vote(single, choice)
+		assert.Equal(t, http.StatusOK, code)
+	}
+
+	multi := create(`{"name": "17-2 Drinks", "mode": "multi", "options": ["Tea", "Coffee", "Juice"]}`)
+	code, body := vote(multi, `[0, 2]`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.EqualValues(t, 1, body["voters"])
+	code, _ = vote(multi, `[2, 2]`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	closed := create(fmt.Sprintf(`{"name": "17-3 Closed", "options": ["a", "b"], "closesAt": %q}`, past))
+	code, body = vote(closed, `[0]`)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "Poll closed", body["message"])
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/polls/%v/results", single.UID), nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var results pollResults
+	err := json.Unmarshal([]byte(resp.Body.String()), &results)
+	assert.Equal(t, nil, err, "Get poll results failed")
+	assert.EqualValues(t, 3, results.Voters)
+	assert.Equal(t, false, results.Closed)
+	assert.Equal(t, cache.PollOptionList{{ID: 1, Name: "Sushi", Votes: 2}, {ID: 2, Name: "Tacos", Votes: 1}, {ID: 0, Name: "Pizza", Votes: 0}}, results.Ranking)
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/polls", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var polls []cache.Poll
+	err = json.Unmarshal([]byte(resp.Body.String()), &polls)
+	assert.Equal(t, nil, err, "Get polls failed")
+	assert.NotEmpty(t, polls)
+	assert.Equal(t, single.UID, polls[0].UID)
+}
+
+func TestRankedPoll(t *testing.T) {
+	router := SetupRouter()
+
+	req, _ := http.NewRequest("POST", "/polls", bytes.NewBufferString(`{"name": "18-1", "mode": "ranked", "method": "approval", "options": ["a", "b"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	req, _ = http.NewRequest("POST", "/polls", bytes.NewBufferString(`{"name": "18-2 Roadmap", "mode": "ranked", "options": ["Search", "Export", "Themes"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var poll cache.Poll
+	err := json.Unmarshal([]byte(resp.Body.String()), &poll)
+	assert.Equal(t, nil, err, "Create poll failed")
+	assert.Equal(t, tally.IRV, poll.Method)
+
+	// Themes is eliminated first, its ballots elect Export
+	for _, choices := range []string{`[0, 1, 2]`, `[0]`, `[1, 0]`, `[1]`, `[2, 1]`} {
+		req, _ = http.NewRequest("PUT", fmt.Sprintf("/polls/%v/vote", poll.UID), bytes.NewBufferString(`{"choices": `+choices+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/polls/%v/results", poll.UID), nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var results pollResults
+	err = json.Unmarshal([]byte(resp.Body.String()), &results)
+	assert.Equal(t, nil, err, "Get poll results failed")
+	assert.Equal(t, 5, results.Tally.Ballots)
+	assert.Equal(t, 1, results.Tally.Winner)
+	assert.Equal(t, []int{1, 0, 2}, results.Tally.Ranking)
+	assert.Len(t, results.Tally.Rounds, 2)
+	assert.Equal(t, []uint64{2, 2, 1}, results.Tally.Rounds[0].Counts)
+}
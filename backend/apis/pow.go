@@ -0,0 +1,66 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/pow"
+)
+
+const (
+	// challengeHeader carries the challenge token of a vote
+	challengeHeader = "X-PoW-Challenge"
+	// nonceHeader carries the nonce solving the challenge of a vote
+	nonceHeader = "X-PoW-Nonce"
+)
+
+// voteGate requires a proof of work for each vote, nil disables it.
+var voteGate *pow.Gate
+
+// SetVoteGate sets the proof of work gate of the votes, nil disables it.
+// It is not safe to call while serving.
+func SetVoteGate(g *pow.Gate) {
+	voteGate = g
+}
+
+// getChallenge returns a new proof of work challenge
+func getChallenge(c *gin.Context) {
+	if voteGate == nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Challenge not required"})
+		return
+	}
+
+	challenge, err := voteGate.Issue()
+	if err != nil {
+		glog.Errorf("Issue challenge err: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Issue challenge failed"})
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, challenge)
+	return
+}
+
+// requireWork aborts requests without a solved challenge
+func requireWork(c *gin.Context) {
+	if voteGate == nil {
+		c.Next()
+		return
+	}
+
+	token, nonce := c.GetHeader(challengeHeader), c.GetHeader(nonceHeader)
+	if token == "" || nonce == "" {
+		c.AbortWithStatusJSON(http.StatusPreconditionRequired, gin.H{"message": "Proof of work required"})
+		return
+	}
+
+	if err := voteGate.Verify(token, nonce); err != nil {
+		glog.Errorf("Verify proof of work from %v err: %v", c.ClientIP(), err)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"message": "Invalid proof of work", "error": err.Error()})
+		return
+	}
+	c.Next()
+}
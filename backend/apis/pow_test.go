@@ -0,0 +1,90 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/pow"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProofOfWorkVote(t *testing.T) {
+	router := SetupRouter()
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/challenge", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+
+	gate, err := pow.New(pow.Config{Difficulty: 4, TTL: time.Minute, LoadWindow: time.Second})
+	assert.Nil(t, err)
+	SetVoteGate(gate)
+	defer SetVoteGate(nil)
+
+	uid, err := cache.CreateTopic("12-1 Proof of work")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	vote := func(path, token, nonce string) int {
+		req, _ := http.NewRequest("PUT", path, bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("X-PoW-Challenge", token)
+			req.Header.Set("X-PoW-Nonce", nonce)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusPreconditionRequired, vote("/topic/upvote", "", ""))
+	assert.Equal(t, http.StatusForbidden, vote("/topic/upvote", "forged.token", "0"))
+
+	for _, path := range []string{"/topic/upvote", "/topic/downvote"} {
+		// Perform a GET request with that handler.
+		req, _ = http.NewRequest("GET", "/challenge", nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code)
+		var challenge pow.Challenge
+		err = json.Unmarshal([]byte(resp.Body.String()), &challenge)
+		assert.Nil(t, err)
+		assert.Equal(t, 4, challenge.Difficulty)
+
+		nonce := pow.Solve(challenge)
+		assert.Equal(t, http.StatusOK, vote(path, challenge.Token, nonce))
+		assert.Equal(t, http.StatusForbidden, vote(path, challenge.Token, nonce), "A challenge is solved once")
+	}
+
+	topic, _ := cache.GetTopic(uid)
+	assert.Equal(t, uint64(1), topic.Upvote)
+	assert.Equal(t, uint64(1), topic.Downvote)
+
+	// A rejection is not replayed to the retry with an idempotency key
+	voteOnce := func(token, nonce string) int {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(IdempotencyHeader, "pow-1")
+		if token != "" {
+			req.Header.Set("X-PoW-Challenge", token)
+			req.Header.Set("X-PoW-Nonce", nonce)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	assert.Equal(t, http.StatusPreconditionRequired, voteOnce("", ""))
+	challenge, err := gate.Issue()
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, voteOnce(challenge.Token, pow.Solve(challenge)))
+	assert.Equal(t, http.StatusOK, voteOnce("", ""), "The vote is replayed")
+	topic, _ = cache.GetTopic(uid)
+	assert.Equal(t, uint64(2), topic.Upvote)
+}
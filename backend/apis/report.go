@@ -0,0 +1,93 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/validation"
+)
+
+// reportReasonRule validates the reason of a topic report
+var reportReasonRule = validation.Rule{Field: "reason", Label: "Report reason", Required: true, MaxLen: maxReportReasonLen, Trim: true, Multiline: true}
+
+// reportThreshold is the number of distinct reporters hiding a topic for
+// review, zero never hides a topic.
+var reportThreshold = defaultReportThreshold
+
+// SetReportThreshold sets the number of reports hiding a topic for review.
+// It is not safe to call while serving.
+func SetReportThreshold(n int) {
+	reportThreshold = n
+}
+
+// reportTopic flags the topic given by the uid path parameter as abusive
+func reportTopic(c *gin.Context) {
+	uid, ok := paramUID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		glog.Error(err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid JSON parameter"})
+		return
+	}
+
+	reason, fe := reportReasonRule.Apply(body.Reason)
+	if fe != nil {
+		glog.Errorf("Invalid report of topic %v: %v", uid, fe.Message)
+		respondInvalid(c, validation.Errors{*fe})
+		return
+	}
+
+	// Anonymous reports would let one client hide any topic
+	reporter := voterID(c)
+	if reporter == "" {
+		glog.Errorf("Anonymous report of topic %v from %v", uid, c.ClientIP())
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Login or voter cookie required"})
+		return
+	}
+	n, hidden, err := cache.ReportTopic(uid, reporter, reason, reportThreshold)
+	if err == cache.ErrAlreadyReported {
+		glog.Errorf("Report topic %v err: %v", uid, err)
+		c.JSON(http.StatusConflict, gin.H{"message": "Topic already reported"})
+		return
+	}
+	if err != nil {
+		glog.Errorf("Report topic %v err: %v", uid, err)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Topic not exist"})
+		return
+	}
+	if hidden {
+		glog.Infof("Topic %v hidden for review after %d reports", uid, n)
+	}
+	recordAudit(c, audit.Entry{Action: "topic.report", Target: uid.String(), Reason: reason, After: n})
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Topic reported"})
+	return
+}
+
+// listReports returns the reported topics in the state query parameter,
+// default all states, the most reported first
+func listReports(c *gin.Context) {
+	var filters []cache.TopicFilter
+	if input, ok := c.GetQuery("state"); ok {
+		state, err := cache.ParseTopicState(input)
+		if err != nil {
+			glog.Error(err)
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input state"})
+			return
+		}
+		filters = append(filters, cache.InState(state))
+	}
+
+	c.JSON(http.StatusOK, cache.ListTopicReports(filters...))
+	return
+}
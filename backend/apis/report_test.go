@@ -0,0 +1,102 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/voter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportTopic(t *testing.T) {
+	router := SetupRouter()
+
+	saved := reportThreshold
+	SetReportThreshold(2)
+	defer SetReportThreshold(saved)
+
+	uid, err := cache.CreateTopic("10-1 Reported topic")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	sessions, err := voter.New(nil)
+	assert.Nil(t, err)
+	SetVoterSessions(sessions)
+	defer SetVoterSessions(nil)
+
+	report := func(uid interface{}, body, reporter string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", fmt.Sprintf("/topic/%v/report", uid), bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if reporter != "" {
+			req.AddCookie(&http.Cookie{Name: voter.CookieName, Value: sessions.Sign(reporter)})
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Invalid requests
+	assert.Equal(t, http.StatusBadRequest, report("not-a-uid", `{"reason": "spam"}`, "reporter1").Code)
+	assert.Equal(t, http.StatusBadRequest, report(uid, `{"reason": "  "}`, "reporter1").Code)
+	assert.Equal(t, http.StatusBadRequest, report(uid, `{`, "reporter1").Code)
+	assert.Equal(t, http.StatusNotFound, report(uuid.New(), `{"reason": "spam"}`, "reporter1").Code)
+
+	// Anonymous reports are refused
+	assert.Equal(t, http.StatusUnauthorized, report(uid, `{"reason": "spam"}`, "").Code)
+
+	// The second reporter hides the topic for review, a reporter counts once
+	assert.Equal(t, http.StatusCreated, report(uid, `{"reason": "spam"}`, "reporter1").Code)
+	assert.Equal(t, http.StatusConflict, report(uid, `{"reason": "spam again"}`, "reporter1").Code)
+	topic, _ := cache.GetTopic(uid)
+	assert.Equal(t, cache.StateVisible, topic.State)
+
+	assert.Equal(t, http.StatusCreated, report(uid, `{"reason": " abusive "}`, "reporter2").Code)
+	topic, _ = cache.GetTopic(uid)
+	assert.Equal(t, cache.StateHidden, topic.State)
+	assert.Equal(t, http.StatusNotFound, report(uid, `{"reason": "spam"}`, "reporter3").Code)
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/admin/reports?state=hidden", nil)
+	asAdmin(req)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var list []cache.TopicReports
+	err = json.Unmarshal([]byte(resp.Body.String()), &list)
+	assert.Nil(t, err)
+	var reports []cache.Report
+	for _, v := range list {
+		if v.Topic.UID == uid {
+			reports = v.Reports
+		}
+	}
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "abusive", reports[1].Reason)
+
+	// Only admins list the reports
+	req, _ = http.NewRequest("GET", "/admin/reports", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+
+	// Approving the topic dismisses its reports
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/topics/%v/approve", uid), nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Empty(t, cache.GetTopicReports(uid))
+
+	req, _ = http.NewRequest("GET", "/admin/reports?state=unknown", nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+}
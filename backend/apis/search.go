@@ -0,0 +1,48 @@
+package apis
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+const (
+	// Default and maximum number of search results
+	defaultSearchResults = 20
+	maxSearchResults     = 100
+	// Search query should not exceed 255 characters.
+	maxSearchQueryLen = 255
+)
+
+// searchTopics returns the topics matching the q query parameter, optionally
+// restricted to a board and to the topics having all the given tags
+func searchTopics(c *gin.Context) {
+	q := c.Query("q")
+	if strings.TrimSpace(q) == "" || len(q) > maxSearchQueryLen {
+		glog.Errorf("Invalid input query: %v", q)
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input query"})
+		return
+	}
+
+	limit, ok := queryLimit(c, defaultSearchResults, maxSearchResults)
+	if !ok {
+		return
+	}
+
+	filters := []cache.TopicFilter{cache.WithTags(c.QueryArray("tag")...)}
+	if board, ok := c.GetQuery("board"); ok {
+		filters = append(filters, cache.InBoard(board))
+	}
+
+	results := cache.SearchTopics(q, filters...)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+
+	c.JSON(http.StatusOK, results)
+	return
+}
@@ -0,0 +1,53 @@
+package apis
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchTopics(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.NewTopic(cache.Topic{Name: "7-1 Zanzibar authorization", Tags: []string{"security"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for _, query := range []string{"q=zanzibar", "q=zanz", "q=zanzibar&tag=security", "q=ZANZIBAR+auth&limit=1"} {
+		// Perform a GET request with that handler.
+		req, _ := http.NewRequest("GET", "/topics/search?"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		// Assert we encoded correctly, the request gives a 200
+		assert.Equal(t, http.StatusOK, resp.Code, query)
+
+		var respBody []cache.SearchResult
+		err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+		assert.Nil(t, err)
+		assert.Len(t, respBody, 1, query)
+		assert.Equal(t, uid, respBody[0].Topic.UID, query)
+	}
+
+	for _, query := range []string{"q=zanzibar&tag=other", "q=zanzibar&board=other", "q=!!"} {
+		// Perform a GET request with that handler.
+		req, _ := http.NewRequest("GET", "/topics/search?"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusOK, resp.Code, query)
+		assert.Equal(t, "[]", resp.Body.String(), query)
+	}
+
+	for _, query := range []string{"", "q=+", "q=x&limit=1000"} {
+		// Perform a GET request with that handler.
+		req, _ := http.NewRequest("GET", "/topics/search?"+query, nil)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+}
@@ -0,0 +1,42 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+const (
+	// Minimum trigram similarity of a suggested topic name
+	minSimilarScore = 0.3
+	// Default and maximum number of suggested topics
+	defaultSimilarTopics = 5
+	maxSimilarTopics     = 20
+)
+
+// getSimilarTopics returns the topics of a board whose name is similar to
+// the name query parameter, to suggest them before creating a new topic
+func getSimilarTopics(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" {
+		glog.Error("Missing input name")
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid input name"})
+		return
+	}
+
+	limit, ok := queryLimit(c, defaultSimilarTopics, maxSimilarTopics)
+	if !ok {
+		return
+	}
+
+	similar := cache.GetSimilarTopics(name, minSimilarScore, cache.InBoard(c.Query("board")))
+	if len(similar) > limit {
+		similar = similar[:limit]
+	}
+
+	c.JSON(http.StatusOK, similar)
+	return
+}
@@ -0,0 +1,78 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateTopicDuplicate(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("6-1 Duplicate")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": " 6-1  DUPLICATE"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 409
+	assert.Equal(t, http.StatusConflict, resp.Code)
+
+	var respBody struct {
+		Message string      `json:"message"`
+		Topic   cache.Topic `json:"topic"`
+	}
+	err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Equal(t, "Topic already exist", respBody.Message)
+	assert.Equal(t, uid, respBody.Topic.UID)
+
+	// Renaming another topic to the same name is refused too
+	other, err := cache.CreateTopic("6-1 Other")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	req, _ = http.NewRequest("PUT", "/topic", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v", "name": "6-1 duplicate"}`, other)))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Equal(t, "6-1 Other", cache.GetTopicName(other))
+}
+
+func TestGetSimilarTopics(t *testing.T) {
+	router := SetupRouter()
+
+	uid, err := cache.CreateTopic("6-2 Adopt structured logging")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/topics/similar?name=adopt+structured+logs", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 200
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var respBody []cache.SimilarTopic
+	err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, respBody)
+	assert.Equal(t, uid, respBody[0].Topic.UID)
+
+	for _, query := range []string{"", "?name=x&limit=0", "?name=x&limit=abc"} {
+		req, _ = http.NewRequest("GET", "/topics/similar"+query, nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusBadRequest, resp.Code, query)
+	}
+}
@@ -0,0 +1,38 @@
+package apis
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+// Tags are compared lower-cased, and must not contain whitespace so that
+// they survive the space separated CSV export.
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9+#._-]*$`)
+
+// validateTags checks the number of tags and each tag's length and characters.
+func validateTags(tags []string) error {
+	tags = cache.NormalizeTags(tags)
+	if len(tags) > maxTopicTags {
+		return fmt.Errorf("topic tags exceed count %d", maxTopicTags)
+	}
+	for _, tag := range tags {
+		if len(tag) > maxTagLen {
+			return fmt.Errorf("tag %q exceeds length %d", tag, maxTagLen)
+		}
+		if !tagPattern.MatchString(tag) {
+			return fmt.Errorf("tag %q has invalid characters", tag)
+		}
+	}
+	return nil
+}
+
+// getTags returns all tags sorted by usage, descending
+func getTags(c *gin.Context) {
+	c.JSON(http.StatusOK, cache.GetTagCounts())
+	return
+}
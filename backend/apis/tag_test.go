@@ -0,0 +1,73 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTopTopicWithTags(t *testing.T) {
+	router := SetupRouter()
+
+	uid1, err := cache.NewTopic(cache.Topic{Name: "5-1", Tags: []string{"tag-go", "tag-infra"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, err = cache.NewTopic(cache.Topic{Name: "5-2", Tags: []string{"tag-go"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// Perform a GET request with that handler.
+	req, _ := http.NewRequest("GET", "/toptopic?tag=tag-go&tag=tag-infra", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var respBody []cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Len(t, respBody, 1)
+	assert.Equal(t, uid1, respBody[0].UID)
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/tags", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var tags []cache.TagCount
+	err = json.Unmarshal([]byte(resp.Body.String()), &tags)
+	assert.Nil(t, err)
+	assert.Contains(t, tags, cache.TagCount{Tag: "tag-go", Count: 2})
+	assert.Contains(t, tags, cache.TagCount{Tag: "tag-infra", Count: 1})
+}
+
+func TestCreateTopicInvalidTags(t *testing.T) {
+	router := SetupRouter()
+
+	tests := []string{
+		`{"name": "5-3", "tags": ["has space"]}`,
+		`{"name": "5-3", "tags": ["` + strings.Repeat("a", maxTagLen+1) + `"]}`,
+		`{"name": "5-3", "tags": ["1","2","3","4","5","6","7","8","9","10","11"]}`,
+	}
+
+	for _, test := range tests {
+		// Perform a POST request with that handler.
+		req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(test))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, http.StatusBadRequest, resp.Code, test)
+
+		var respBody map[string]interface{}
+		err := json.Unmarshal([]byte(resp.Body.String()), &respBody)
+		assert.Nil(t, err)
+		assert.Equal(t, "Invalid topic tags", respBody["message"])
+	}
+}
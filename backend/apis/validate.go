@@ -0,0 +1,68 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/markdown"
+	"github.com/jenting/voting-topic/backend/validation"
+)
+
+// topicRules validate the text fields of a topic, lengths count
+// user-perceived characters rather than bytes.
+var topicRules = validation.Rules{
+	"name":        {Field: "name", Label: "Topic name", Required: true, MaxLen: maxTopicNameLen, Trim: true},
+	"description": {Field: "description", Label: "Topic description", MaxLen: maxTopicDescriptionLen, Multiline: true},
+	"url":         {Field: "url", Label: "Topic URL", MaxLen: maxTopicURLLen, Trim: true},
+	"author":      {Field: "author", Label: "Topic author", MaxLen: maxTopicAuthorLen, Trim: true},
+}
+
+// SetTopicRules overrides the validation rules of the given topic fields.
+// Rules of unknown fields are ignored. It is not safe to call while serving.
+func SetTopicRules(rules validation.Rules) {
+	for field, rule := range rules {
+		if _, ok := topicRules[field]; ok {
+			topicRules[field] = rule
+		}
+	}
+}
+
+// validateTopic checks the fields of topic t and normalizes them in place.
+// With partial, an empty name is allowed as it keeps the current name.
+func validateTopic(t *cache.Topic, partial bool) validation.Errors {
+	var errs validation.Errors
+
+	apply := func(field string, value *string) {
+		rule := topicRules[field]
+		if partial {
+			rule.Required = false
+		}
+		v, fe := rule.Apply(*value)
+		if fe != nil {
+			errs = append(errs, *fe)
+		}
+		*value = v
+	}
+	apply("name", &t.Name)
+	apply("description", &t.Description)
+	apply("url", &t.URL)
+	apply("author", &t.Author)
+
+	if err := validateTags(t.Tags); err != nil {
+		errs.Add("tags", "Invalid topic tags")
+	}
+	if _, ok := markdown.SafeURL(t.URL); t.URL != "" && !ok {
+		errs.Add("url", "Invalid topic URL")
+	}
+	if err := cache.CheckWindow(t.OpensAt, t.ClosesAt); err != nil {
+		errs.Add("closesAt", "Topic must close after it opens")
+	}
+	return errs
+}
+
+// respondInvalid responds with the first error message and all field errors.
+func respondInvalid(c *gin.Context, errs validation.Errors) {
+	c.JSON(http.StatusBadRequest, gin.H{"message": errs[0].Message, "errors": errs})
+}
@@ -0,0 +1,93 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/validation"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateTopicUnicodeName(t *testing.T) {
+	router := SetupRouter()
+
+	// 255 characters but 765 bytes
+	name := strings.Repeat("議", maxTopicNameLen)
+	b, err := json.Marshal(cache.Topic{Name: "  " + name + "  "})
+	assert.Equal(t, nil, err, "JSON marshal failed")
+
+	// Perform a POST request with that handler.
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBuffer(b))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	// Assert we encoded correctly, the request gives a 200
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var respBody cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &respBody)
+	assert.Nil(t, err)
+	assert.Equal(t, name, respBody.Name, "The name should be trimmed")
+}
+
+func TestCreateTopicInvalidFields(t *testing.T) {
+	router := SetupRouter()
+
+	tests := []struct {
+		body     string
+		expected validation.Errors
+	}{
+		{`{"name": ""}`, validation.Errors{{Field: "name", Message: "Topic name is required"}}},
+		{`{"name": "   "}`, validation.Errors{{Field: "name", Message: "Topic name is required"}}},
+		{`{"name": "bell\u0007"}`, validation.Errors{{Field: "name", Message: "Topic name has invalid characters"}}},
+		{
+			`{"name": "", "url": "ftp://example.com", "tags": ["a b"]}`,
+			validation.Errors{
+				{Field: "name", Message: "Topic name is required"},
+				{Field: "tags", Message: "Invalid topic tags"},
+				{Field: "url", Message: "Invalid topic URL"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		// Perform a POST request with that handler.
+		req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(test.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		// Assert we encoded correctly, the request gives a 400
+		assert.Equal(t, http.StatusBadRequest, resp.Code, test.body)
+
+		var respBody struct {
+			Message string            `json:"message"`
+			Errors  validation.Errors `json:"errors"`
+		}
+		err := json.Unmarshal([]byte(resp.Body.String()), &respBody)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected[0].Message, respBody.Message, test.body)
+		assert.Equal(t, test.expected, respBody.Errors, test.body)
+	}
+}
+
+func TestSetTopicRules(t *testing.T) {
+	saved := topicRules["author"]
+	defer func() { topicRules["author"] = saved }()
+
+	SetTopicRules(validation.Rules{
+		"author":  {Field: "author", Label: "Topic author", Required: true, MaxLen: 3},
+		"unknown": {Field: "unknown", Required: true},
+	})
+	_, ok := topicRules["unknown"]
+	assert.False(t, ok, "Unknown rules should be ignored")
+
+	errs := validateTopic(&cache.Topic{Name: "8-1", Author: "abcd"}, false)
+	assert.Equal(t, validation.Errors{{Field: "author", Message: "Topic author over length"}}, errs)
+}
@@ -0,0 +1,68 @@
+package apis
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/voter"
+)
+
+// voterSessions identifies the voters by cookie to allow one vote per
+// topic, nil allows anonymous unlimited votes.
+var voterSessions *voter.Sessions
+
+// SetVoterSessions sets the voter cookie sessions, nil disables them.
+// It is not safe to call while serving.
+func SetVoterSessions(s *voter.Sessions) {
+	voterSessions = s
+}
+
+// recordVoter records the vote of the request voter on a topic or poll, it
+// responds with an error and returns false when the voter is unknown or
+// already voted, else it returns a func forgetting the vote when it is not
+// counted. A logged in user votes with the verified identity, which is
+// required by restricted topics and polls.
+func recordVoter(c *gin.Context, uid uuid.UUID, restricted, up bool) (func(), bool) {
+	if restricted && !requireCompanyAccount(c) {
+		return nil, false
+	}
+
+	id := voterID(c)
+	if id == "" {
+		if voterSessions != nil {
+			glog.Errorf("Vote on %v without voter cookie from %v", uid, c.ClientIP())
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Voter cookie required"})
+			return nil, false
+		}
+		return func() {}, true
+	}
+
+	if err := cache.RecordVote(id, uid, up); err != nil {
+		glog.Errorf("Voter %v vote on %v err: %v", id, uid, err)
+		c.JSON(http.StatusConflict, gin.H{"message": "Already voted"})
+		return nil, false
+	}
+
+	forget := func() {
+		cache.ForgetVote(id, uid)
+	}
+	return forget, true
+}
+
+// voterID returns the id of the request voter: the verified identity of a
+// logged in user, else the voter cookie. It is empty for anonymous voters.
+func voterID(c *gin.Context) string {
+	if identity, ok := currentIdentity(c); ok {
+		return "user:" + identity.Subject
+	}
+	if voterSessions != nil {
+		if id, ok := voterSessions.Get(c); ok {
+			return id
+		}
+	}
+	return ""
+}
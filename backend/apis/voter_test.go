@@ -0,0 +1,49 @@
+package apis
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/voter"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOneVotePerVoter(t *testing.T) {
+	router := SetupRouter()
+
+	sessions, err := voter.New(nil)
+	assert.Nil(t, err)
+	SetVoterSessions(sessions)
+	defer SetVoterSessions(nil)
+
+	uid, err := cache.CreateTopic("13-1 One vote per voter")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	vote := func(path, cookie string) int {
+		req, _ := http.NewRequest("PUT", path, bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, uid)))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != "" {
+			req.AddCookie(&http.Cookie{Name: voter.CookieName, Value: cookie})
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, vote("/topic/upvote", ""))
+	assert.Equal(t, http.StatusUnauthorized, vote("/topic/upvote", "forged.random.sig"))
+
+	assert.Equal(t, http.StatusOK, vote("/topic/upvote", sessions.Sign("voter1")))
+	assert.Equal(t, http.StatusConflict, vote("/topic/upvote", sessions.Sign("voter1")))
+	assert.Equal(t, http.StatusConflict, vote("/topic/downvote", sessions.Sign("voter1")))
+	assert.Equal(t, http.StatusOK, vote("/topic/downvote", sessions.Sign("voter2")))
+
+	topic, _ := cache.GetTopic(uid)
+	assert.Equal(t, uint64(1), topic.Upvote)
+	assert.Equal(t, uint64(1), topic.Downvote)
+	assert.Equal(t, false, cache.GetVoterVotes("voter2")[uid])
+}
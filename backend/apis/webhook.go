@@ -0,0 +1,93 @@
+package apis
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+	"github.com/jenting/voting-topic/backend/webhook"
+)
+
+// webhooks delivers the published events to the outgoing webhooks, there
+// are none by default.
+var webhooks = mustDispatcher(webhook.New(webhook.DefaultConfig()))
+
+func mustDispatcher(d *webhook.Dispatcher, err error) *webhook.Dispatcher {
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func init() {
+	events.Subscribe(func(e events.Event) {
+		webhooks.Handle(e)
+	})
+}
+
+// SetWebhooks sets the dispatcher of the outgoing webhooks, the caller runs it.
+// It is not safe to call while serving.
+func SetWebhooks(d *webhook.Dispatcher) {
+	webhooks = d
+}
+
+// publishCreated publishes a TopicCreated event of a live topic
+func publishCreated(topic *cache.Topic) {
+	events.Publish(events.New(events.TopicCreated, topic.UID, topic))
+}
+
+// publishVotedMu orders the TopicVoted events of a topic as the topic is
+// read, so that the events of concurrent votes carry growing counts. Topics
+// are spread over the mutexes, the votes of other topics seldom wait.
+var publishVotedMu [64]sync.Mutex
+
+// publishVoted publishes a TopicVoted event with the topic uid after its
+// votes are counted
+func publishVoted(uid uuid.UUID) {
+	mu := &publishVotedMu[int(uid[len(uid)-1])%len(publishVotedMu)]
+	mu.Lock()
+	defer mu.Unlock()
+
+	if topic, ok := cache.GetTopic(uid); ok {
+		events.Publish(events.New(events.TopicVoted, uid, topic))
+	}
+}
+
+// listDeadLetters returns the webhook deliveries which failed for good, the
+// newest first
+func listDeadLetters(c *gin.Context) {
+	c.JSON(http.StatusOK, webhooks.DeadLetters())
+	return
+}
+
+// redeliverDeadLetter queues a dead letter again
+func redeliverDeadLetter(c *gin.Context) {
+	id, ok := paramUUID(c, "id")
+	if !ok {
+		return
+	}
+
+	letter, err := webhooks.Redeliver(id)
+	switch err {
+	case nil:
+	case webhook.ErrDeadLetterNotFound:
+		glog.Errorf("Dead letter %v not exist", id)
+		c.JSON(http.StatusNotFound, gin.H{"message": "Dead letter not exist"})
+		return
+	default:
+		glog.Errorf("Redeliver dead letter %v err: %v", id, err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "Delivery queue full"})
+		return
+	}
+	glog.Infof("Redelivering %v event %v to %v", letter.Event.Type, letter.Event.ID, letter.URL)
+	recordAudit(c, audit.Entry{Action: "webhook.redeliver", Target: id.String(), Before: letter})
+
+	c.JSON(http.StatusAccepted, letter)
+	return
+}
@@ -0,0 +1,162 @@
+package apis
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+	"github.com/jenting/voting-topic/backend/webhook"
+)
+
+func TestWebhooks(t *testing.T) {
+	router := SetupRouter()
+
+	received := make(chan events.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(t, webhook.Sign("secret", req.Header.Get(webhook.TimestampHeader), body), req.Header.Get(webhook.SignatureHeader))
+
+		var e events.Event
+		_ = json.Unmarshal(body, &e)
+		received <- e
+	}))
+	defer receiver.Close()
+
+	cfg := webhook.DefaultConfig()
+	cfg.Hooks = []webhook.Hook{
+		{URL: receiver.URL, Secret: "secret", Thresholds: []uint64{2}},
+		// Nothing listens there
+		{URL: "http://127.0.0.1:1/hook", Secret: "secret", Events: []string{events.TopicCreated}},
+	}
+	cfg.MaxAttempts = 1
+	d, err := webhook.New(cfg)
+	assert.Nil(t, err)
+	saved := webhooks
+	SetWebhooks(d)
+	defer SetWebhooks(saved)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(`{"name": "24-1 Announced"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var topic cache.Topic
+	err = json.Unmarshal([]byte(resp.Body.String()), &topic)
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for i := 0; i < 3; i++ {
+		req, _ = http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, topic.UID)))
+		req.Header.Set("Content-Type", "application/json")
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+	}
+
+	// Events of other tests may be delivered as well
+	seen := map[string]bool{}
+	timeout := time.After(5 * time.Second)
+	for !seen[events.TopicCreated] || !seen[webhook.TopicThreshold] {
+		select {
+		case e := <-received:
+			if e.Topic == topic.UID {
+				assert.False(t, seen[e.Type], e.Type)
+				seen[e.Type] = true
+			}
+		case <-timeout:
+			t.Fatalf("Timed out waiting for the webhooks, got %v", seen)
+		}
+	}
+
+	// The failed delivery is dead-lettered
+	var dead []webhook.DeadLetter
+	for deadline := time.Now().Add(5 * time.Second); len(dead) == 0 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+		dead = d.DeadLetters()
+	}
+	assert.NotEmpty(t, dead)
+
+	// Perform a GET request with that handler.
+	req, _ = http.NewRequest("GET", "/admin/webhooks/dead-letters", nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+
+	var letters []webhook.DeadLetter
+	err = json.Unmarshal([]byte(resp.Body.String()), &letters)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, letters)
+	assert.Equal(t, "http://127.0.0.1:1/hook", letters[0].URL)
+
+	// Only admins read and redeliver the failed deliveries
+	for _, route := range []struct{ method, path string }{
+		{"GET", "/admin/webhooks/dead-letters"},
+		{"POST", fmt.Sprintf("/admin/webhooks/dead-letters/%v/redeliver", letters[0].ID)},
+	} {
+		req, _ = http.NewRequest(route.method, route.path, nil)
+		resp = httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusUnauthorized, resp.Code, route.path)
+	}
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/webhooks/dead-letters/%v/redeliver", letters[0].ID), nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusAccepted, resp.Code)
+
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/admin/webhooks/dead-letters/%v/redeliver", letters[0].ID), nil)
+	asAdmin(req)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+}
+
+func TestPublishVotedOrder(t *testing.T) {
+	uid, err := cache.CreateTopic("29-4 Ordered votes")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	var mu sync.Mutex
+	var counts []uint64
+	events.Subscribe(func(e events.Event) {
+		if e.Type != events.TopicVoted || e.Topic != uid {
+			return
+		}
+		mu.Lock()
+		counts = append(counts, e.Data.(*cache.Topic).Upvote)
+		mu.Unlock()
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, cache.IncTopicUpvote(uid))
+			publishVoted(uid)
+		}()
+	}
+	wg.Wait()
+
+	// The events of a topic never go back
+	assert.Len(t, counts, 50)
+	for i := 1; i < len(counts); i++ {
+		assert.LessOrEqual(t, counts[i-1], counts[i])
+	}
+	assert.EqualValues(t, 50, counts[len(counts)-1])
+}
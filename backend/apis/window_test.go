@@ -0,0 +1,81 @@
+package apis
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollWindowVote(t *testing.T) {
+	router := SetupRouter()
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+
+	create := func(body string) (int, cache.Topic) {
+		req, _ := http.NewRequest("POST", "/topic", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var topic cache.Topic
+		_ = json.Unmarshal([]byte(resp.Body.String()), &topic)
+		return resp.Code, topic
+	}
+
+	code, _ := create(fmt.Sprintf(`{"name": "15-1 Invalid window", "opensAt": %q, "closesAt": %q}`, future, past))
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, notOpen := create(fmt.Sprintf(`{"name": "15-2 Not open", "opensAt": %q}`, future))
+	assert.Equal(t, http.StatusOK, code)
+	code, closed := create(fmt.Sprintf(`{"name": "15-3 Closed", "closesAt": %q}`, past))
+	assert.Equal(t, http.StatusOK, code)
+
+	vote := func(topic cache.Topic) (int, map[string]interface{}) {
+		req, _ := http.NewRequest("PUT", "/topic/upvote", bytes.NewBufferString(fmt.Sprintf(`{"uid": "%v"}`, topic.UID)))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+
+		var body map[string]interface{}
+		_ = json.Unmarshal([]byte(resp.Body.String()), &body)
+		return resp.Code, body
+	}
+
+	code, body := vote(notOpen)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "Poll not open yet", body["message"])
+	assert.Equal(t, future, body["opensAt"])
+
+	code, body = vote(closed)
+	assert.Equal(t, http.StatusForbidden, code)
+	assert.Equal(t, "Poll closed", body["message"])
+
+	// Reopen the closed poll, anonymous users may not
+	update := func(body string, admin bool) int {
+		req, _ := http.NewRequest("PUT", "/topic", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		if admin {
+			asAdmin(req)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	assert.Equal(t, http.StatusForbidden, update(fmt.Sprintf(`{"uid": "%v", "name": "15-3 Reopened", "closesAt": %q}`, closed.UID, future), false))
+	assert.Equal(t, http.StatusBadRequest, update(fmt.Sprintf(`{"uid": "%v", "opensAt": %q}`, closed.UID, future), true))
+	assert.Equal(t, http.StatusOK, update(fmt.Sprintf(`{"uid": "%v", "closesAt": %q}`, closed.UID, future), true))
+
+	code, _ = vote(closed)
+	assert.Equal(t, http.StatusOK, code)
+	topic, _ := cache.GetTopic(closed.UID)
+	assert.EqualValues(t, 1, topic.Upvote)
+	assert.Equal(t, "15-3 Closed", topic.Name)
+}
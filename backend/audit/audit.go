@@ -0,0 +1,131 @@
+// Package audit keeps an append-only log of the mutating operations: who
+// did what to which target, with the values before and after.
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Entry is a recorded operation
+type Entry struct {
+	ID   uint64    `json:"id"`
+	Time time.Time `json:"time"`
+	// Actor is the logged in identity, else the client IP
+	Actor string `json:"actor"`
+	IP    string `json:"ip,omitempty"`
+	// Action names the operation, like topic.create or topic.upvote
+	Action string `json:"action"`
+	// Target is the topic uid, or the id of the poll or board
+	Target string      `json:"target,omitempty"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+	Reason string      `json:"reason,omitempty"`
+}
+
+// Query selects entries, zero fields match all entries
+type Query struct {
+	Actor  string
+	Action string
+	Target string
+	// Since and Until bound the entry time, Until is excluded
+	Since time.Time
+	Until time.Time
+	// Limit is the maximum number of entries returned, the newest ones
+	Limit int
+}
+
+// Match reports whether e is selected by q
+func (q Query) Match(e Entry) bool {
+	switch {
+	case q.Actor != "" && e.Actor != q.Actor:
+		return false
+	case q.Action != "" && e.Action != q.Action:
+		return false
+	case q.Target != "" && e.Target != q.Target:
+		return false
+	case !q.Since.IsZero() && e.Time.Before(q.Since):
+		return false
+	case !q.Until.IsZero() && !e.Time.Before(q.Until):
+		return false
+	}
+	return true
+}
+
+// Log keeps the latest entries in memory and appends every entry as a JSON
+// line to an optional sink. It is safe for concurrent use.
+type Log struct {
+	// Now returns the current time, it is replaced by tests
+	Now func() time.Time
+
+	mu      sync.Mutex
+	max     int
+	entries []Entry // oldest first
+	nextID  uint64
+	sink    io.Writer
+	enc     *json.Encoder
+}
+
+// New returns a log keeping the latest max entries in memory, sink receives
+// every entry as a JSON line when not nil
+func New(max int, sink io.Writer) *Log {
+	l := &Log{Now: time.Now, max: max, nextID: 1, sink: sink}
+	if sink != nil {
+		l.enc = json.NewEncoder(sink)
+	}
+	return l
+}
+
+// Record appends e with the next id and the current time, then returns it.
+// The sink error is returned after the entry is kept in memory.
+func (l *Log) Record(e Entry) (Entry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	e.ID = l.nextID
+	l.nextID++
+	e.Time = l.Now().UTC()
+
+	l.entries = append(l.entries, e)
+	if len(l.entries) > l.max {
+		// Drop the oldest entries, keeping the backing array bounded
+		l.entries = append(l.entries[:0], l.entries[len(l.entries)-l.max:]...)
+	}
+
+	if l.enc != nil {
+		return e, l.enc.Encode(e)
+	}
+	return e, nil
+}
+
+// Query returns the entries selected by q, the newest first
+func (l *Log) Query(q Query) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []Entry{}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if q.Limit > 0 && len(entries) == q.Limit {
+			break
+		}
+		if q.Match(l.entries[i]) {
+			entries = append(entries, l.entries[i])
+		}
+	}
+	return entries
+}
+
+// WriteJSONL writes the entries selected by q as JSON lines, the oldest first
+func (l *Log) WriteJSONL(w io.Writer, q Query) error {
+	entries := l.Query(q)
+
+	enc := json.NewEncoder(w)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if err := enc.Encode(entries[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
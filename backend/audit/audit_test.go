@@ -0,0 +1,88 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newLog(max int, sink *bytes.Buffer) (*Log, *time.Time) {
+	now := epoch
+	var l *Log
+	if sink != nil {
+		l = New(max, sink)
+	} else {
+		// A nil *bytes.Buffer is not a nil io.Writer
+		l = New(max, nil)
+	}
+	l.Now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestRecordQuery(t *testing.T) {
+	l, now := newLog(100, nil)
+
+	for i, action := range []string{"topic.create", "topic.upvote", "topic.upvote", "topic.hide"} {
+		*now = epoch.Add(time.Duration(i) * time.Minute)
+		e, err := l.Record(Entry{Actor: "ip:1.2.3.4", Action: action, Target: "t1"})
+		assert.Equal(t, nil, err)
+		assert.EqualValues(t, i+1, e.ID)
+		assert.Equal(t, *now, e.Time)
+	}
+	_, err := l.Record(Entry{Actor: "alice@example.com", Action: "topic.upvote", Target: "t2"})
+	assert.Equal(t, nil, err)
+
+	ids := func(entries []Entry) []uint64 {
+		list := []uint64{}
+		for _, e := range entries {
+			list = append(list, e.ID)
+		}
+		return list
+	}
+
+	assert.Equal(t, []uint64{5, 4, 3, 2, 1}, ids(l.Query(Query{})))
+	assert.Equal(t, []uint64{5, 3, 2}, ids(l.Query(Query{Action: "topic.upvote"})))
+	assert.Equal(t, []uint64{5, 3}, ids(l.Query(Query{Action: "topic.upvote", Limit: 2})))
+	assert.Equal(t, []uint64{5}, ids(l.Query(Query{Actor: "alice@example.com"})))
+	assert.Equal(t, []uint64{4, 3, 2, 1}, ids(l.Query(Query{Target: "t1"})))
+	assert.Equal(t, []uint64{3, 2}, ids(l.Query(Query{Target: "t1", Since: epoch.Add(time.Minute), Until: epoch.Add(3 * time.Minute)})))
+	assert.Equal(t, []uint64{}, ids(l.Query(Query{Action: "topic.delete"})))
+}
+
+func TestBounded(t *testing.T) {
+	l, _ := newLog(3, nil)
+	for i := 0; i < 10; i++ {
+		l.Record(Entry{Action: "topic.upvote"})
+	}
+
+	entries := l.Query(Query{})
+	assert.Len(t, entries, 3)
+	assert.EqualValues(t, 10, entries[0].ID)
+	assert.EqualValues(t, 8, entries[2].ID)
+}
+
+func TestJSONL(t *testing.T) {
+	var sink bytes.Buffer
+	l, _ := newLog(1, &sink)
+
+	l.Record(Entry{Actor: "a", Action: "topic.create", Target: "t1", After: map[string]string{"name": "x"}})
+	l.Record(Entry{Actor: "a", Action: "topic.upvote", Target: "t1", Before: 0, After: 1})
+
+	// The sink keeps the entries dropped from memory
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	assert.Len(t, lines, 2)
+	var e Entry
+	assert.Equal(t, nil, json.Unmarshal([]byte(lines[0]), &e))
+	assert.Equal(t, "topic.create", e.Action)
+	assert.Equal(t, map[string]interface{}{"name": "x"}, e.After)
+
+	var out bytes.Buffer
+	assert.Equal(t, nil, l.WriteJSONL(&out, Query{}))
+	assert.Equal(t, lines[1]+"\n", out.String())
+}
@@ -0,0 +1,355 @@
+// Package auth implements an OpenID Connect login with the authorization
+// code flow and PKCE, and keeps the logged in identities in server-side
+// sessions.
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockSkew is the leeway allowed when checking token times
+const clockSkew = time.Minute
+
+// maxResponseSize bounds the responses read from the identity provider
+const maxResponseSize = 1 << 20
+
+// ErrInvalidToken means the ID token failed verification
+var ErrInvalidToken = errors.New("invalid id token")
+
+// Config defines the OIDC client
+type Config struct {
+	// Issuer is the identity provider URL, its discovery document is read
+	// from Issuer + "/.well-known/openid-configuration"
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback URL registered with the identity provider
+	RedirectURL string
+	// Scopes are requested in addition to "openid"
+	Scopes []string
+	// Client is the HTTP client talking to the identity provider,
+	// http.DefaultClient when nil
+	Client *http.Client
+}
+
+// Identity is the verified identity of a logged in user
+type Identity struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"emailVerified,omitempty"`
+	Name          string `json:"name,omitempty"`
+}
+
+// String returns the email of the identity, or its subject without email
+func (id Identity) String() string {
+	if id.Email != "" {
+		return id.Email
+	}
+	return id.Subject
+}
+
+// InDomains reports whether the identity has a verified email in one of
+// the domains, any identity matches no domains
+func (id Identity) InDomains(domains []string) bool {
+	if len(domains) == 0 {
+		return true
+	}
+	i := strings.LastIndexByte(id.Email, '@')
+	if !id.EmailVerified || i < 0 {
+		return false
+	}
+	for _, domain := range domains {
+		if strings.EqualFold(id.Email[i+1:], domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// Provider is an OIDC identity provider discovered from its issuer URL.
+// It is safe for concurrent use.
+type Provider struct {
+	cfg      Config
+	client   *http.Client
+	metadata struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+
+	// Now returns the current time, tests may replace it
+	Now func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+}
+
+// Discover reads the discovery document of the issuer
+func Discover(ctx context.Context, cfg Config) (*Provider, error) {
+	p := &Provider{cfg: cfg, client: cfg.Client, Now: time.Now}
+	if p.client == nil {
+		p.client = http.DefaultClient
+	}
+
+	issuer := strings.TrimSuffix(cfg.Issuer, "/")
+	if err := p.getJSON(ctx, issuer+"/.well-known/openid-configuration", &p.metadata); err != nil {
+		return nil, fmt.Errorf("discover %v: %v", issuer, err)
+	}
+	if p.metadata.Issuer != issuer {
+		return nil, fmt.Errorf("discover %v: issuer mismatch %q", issuer, p.metadata.Issuer)
+	}
+	if p.metadata.AuthorizationEndpoint == "" || p.metadata.TokenEndpoint == "" || p.metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discover %v: missing endpoints", issuer)
+	}
+	return p, nil
+}
+
+// AuthCodeURL returns the URL of the identity provider login page.
+// The challenge of the PKCE verifier is sent with the S256 method.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+
+	v := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.metadata.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange redeems an authorization code and returns the verified identity
+// of its ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := p.doJSON(req, &token); err != nil {
+		return nil, fmt.Errorf("token exchange: %v", err)
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("token exchange: no id token")
+	}
+	return p.Verify(ctx, token.IDToken, nonce)
+}
+
+// Verify checks the RS256 signature and the claims of an ID token
+func (p *Provider) Verify(ctx context.Context, raw, nonce string) (*Identity, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "RS256" {
+		return nil, ErrInvalidToken
+	}
+
+	key, err := p.key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	sum := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], sig); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims struct {
+		Issuer        string          `json:"iss"`
+		Audience      audience        `json:"aud"`
+		Expiry        int64           `json:"exp"`
+		IssuedAt      int64           `json:"iat"`
+		Nonce         string          `json:"nonce"`
+		Subject       string          `json:"sub"`
+		Email         string          `json:"email"`
+		EmailVerified json.RawMessage `json:"email_verified"`
+		Name          string          `json:"name"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	now := p.Now()
+	switch {
+	case claims.Issuer != p.metadata.Issuer:
+		return nil, fmt.Errorf("%v: issuer %q", ErrInvalidToken, claims.Issuer)
+	case !claims.Audience.contains(p.cfg.ClientID):
+		return nil, fmt.Errorf("%v: audience %q", ErrInvalidToken, claims.Audience)
+	case now.After(time.Unix(claims.Expiry, 0).Add(clockSkew)):
+		return nil, fmt.Errorf("%v: expired", ErrInvalidToken)
+	case now.Add(clockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return nil, fmt.Errorf("%v: issued in the future", ErrInvalidToken)
+	case claims.Nonce != nonce:
+		return nil, fmt.Errorf("%v: nonce mismatch", ErrInvalidToken)
+	case claims.Subject == "":
+		return nil, fmt.Errorf("%v: no subject", ErrInvalidToken)
+	}
+
+	return &Identity{
+		Subject: claims.Subject,
+		Email:   claims.Email,
+		// Some providers send the boolean as a string
+		EmailVerified: string(claims.EmailVerified) == "true" || string(claims.EmailVerified) == `"true"`,
+		Name:          claims.Name,
+	}, nil
+}
+
+// key returns the signing key kid, the key set is read again once when
+// the key is unknown to follow the provider's key rotation
+func (p *Provider) key(ctx context.Context, kid string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.metadata.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("read key set: %v", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		n, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		e, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil || len(e) == 0 || len(e) > 4 {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+	}
+	p.keys = keys
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%v: unknown key %q", ErrInvalidToken, kid)
+	}
+	return key, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.doJSON(req, v)
+}
+
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%v: %s", resp.Status, body)
+	}
+	return json.Unmarshal(body, v)
+}
+
+// audience is the aud claim, a string or an array of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = audience{s}
+		return nil
+	}
+	return json.Unmarshal(b, (*[]string)(a))
+}
+
+func (a audience) contains(s string) bool {
+	for _, v := range a {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// RandomString returns a random URL-safe string, for states, nonces and
+// PKCE verifiers
+func RandomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jenting/voting-topic/backend/auth/authtest"
+	"github.com/stretchr/testify/assert"
+)
+
+const redirectURL = "http://voting.example/callback"
+
+func discover(t *testing.T, idp *authtest.Provider) *Provider {
+	p, err := Discover(context.Background(), Config{
+		Issuer:      idp.URL,
+		ClientID:    authtest.ClientID,
+		RedirectURL: redirectURL,
+		Scopes:      []string{"email", "profile"},
+	})
+	assert.Nil(t, err)
+	return p
+}
+
+// authorize follows the login page redirect and returns the callback query
+func authorize(t *testing.T, authURL string) url.Values {
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	assert.Nil(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	u, err := url.Parse(resp.Header.Get("Location"))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(u.String(), redirectURL))
+	return u.Query()
+}
+
+func TestLoginFlow(t *testing.T) {
+	idp := authtest.NewProvider(authtest.Claims{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"})
+	defer idp.Close()
+	p := discover(t, idp)
+
+	authURL := p.AuthCodeURL("state1", "nonce1", "verifier1")
+	u, _ := url.Parse(authURL)
+	assert.Equal(t, "openid email profile", u.Query().Get("scope"))
+	assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+	assert.NotContains(t, authURL, "verifier1")
+
+	callback := authorize(t, authURL)
+	assert.Equal(t, "state1", callback.Get("state"))
+
+	// A wrong verifier is refused by the provider
+	_, err := p.Exchange(context.Background(), callback.Get("code"), "verifier2", "nonce1")
+	assert.NotNil(t, err)
+
+	callback = authorize(t, authURL)
+	id, err := p.Exchange(context.Background(), callback.Get("code"), "verifier1", "nonce1")
+	assert.Nil(t, err)
+	assert.Equal(t, &Identity{Subject: "alice", Email: "alice@example.com", EmailVerified: true, Name: "Alice"}, id)
+
+	// A code is redeemed once
+	_, err = p.Exchange(context.Background(), callback.Get("code"), "verifier1", "nonce1")
+	assert.NotNil(t, err)
+}
+
+func TestVerify(t *testing.T) {
+	idp := authtest.NewProvider(authtest.Claims{})
+	defer idp.Close()
+	p := discover(t, idp)
+	ctx := context.Background()
+	now := time.Now()
+
+	claims := authtest.Claims{Subject: "bob"}
+	id, err := p.Verify(ctx, idp.IDToken(claims, "n", now), "n")
+	assert.Nil(t, err)
+	assert.Equal(t, "bob", id.Subject)
+
+	valid := func(overrides map[string]interface{}) string {
+		c := map[string]interface{}{"iss": idp.URL, "aud": authtest.ClientID, "iat": now.Unix(), "exp": now.Add(time.Hour).Unix(), "nonce": "n", "sub": "bob"}
+		for k, v := range overrides {
+			c[k] = v
+		}
+		return idp.Sign(c)
+	}
+
+	_, err = p.Verify(ctx, valid(map[string]interface{}{"aud": []string{"other", authtest.ClientID}}), "n")
+	assert.Nil(t, err)
+
+	parts := strings.Split(idp.IDToken(claims, "n", now), ".")
+	tampered := strings.Split(valid(map[string]interface{}{"sub": "mallory"}), ".")[1]
+	for name, raw := range map[string]string{
+		"wrong nonce":  idp.IDToken(claims, "other", now),
+		"expired":      idp.IDToken(claims, "n", now.Add(-2*time.Hour)),
+		"future":       idp.IDToken(claims, "n", now.Add(time.Hour)),
+		"wrong issuer": valid(map[string]interface{}{"iss": "https://evil.example"}),
+		"wrong aud":    valid(map[string]interface{}{"aud": "other"}),
+		"no subject":   valid(map[string]interface{}{"sub": ""}),
+		"tampered":     parts[0] + "." + tampered + "." + parts[2],
+		"alg none":     "eyJhbGciOiJub25lIn0." + parts[1] + ".",
+		"not a jwt":    "abc",
+		"foreign key":  authtest.NewProvider(claims).IDToken(claims, "n", now),
+	} {
+		_, err := p.Verify(ctx, raw, "n")
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestDiscoverIssuerMismatch(t *testing.T) {
+	idp := authtest.NewProvider(authtest.Claims{})
+	defer idp.Close()
+
+	_, err := Discover(context.Background(), Config{Issuer: idp.URL + "/other"})
+	assert.NotNil(t, err)
+	_, err = Discover(context.Background(), Config{Issuer: strings.Replace(idp.URL, "127.0.0.1", "localhost", 1)})
+	assert.NotNil(t, err)
+}
+
+func TestInDomains(t *testing.T) {
+	id := Identity{Subject: "alice", Email: "alice@Example.com", EmailVerified: true}
+	assert.True(t, id.InDomains(nil))
+	assert.True(t, id.InDomains([]string{"other.com", "example.com"}))
+	assert.False(t, id.InDomains([]string{"other.com"}))
+
+	id.EmailVerified = false
+	assert.False(t, id.InDomains([]string{"example.com"}))
+	assert.Equal(t, "alice@Example.com", id.String())
+	assert.Equal(t, "bob", Identity{Subject: "bob"}.String())
+}
+
+func TestSessions(t *testing.T) {
+	s := NewSessions(time.Hour)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.Now = func() time.Time { return now }
+
+	s.StartLogin("state1", Login{Verifier: "v", Nonce: "n", ReturnTo: "/"})
+	l, ok := s.FinishLogin("state1")
+	assert.True(t, ok)
+	assert.Equal(t, "v", l.Verifier)
+	_, ok = s.FinishLogin("state1")
+	assert.False(t, ok, "A login is finished once")
+
+	s.StartLogin("state2", Login{})
+	now = now.Add(loginTTL + time.Second)
+	_, ok = s.FinishLogin("state2")
+	assert.False(t, ok, "A login expires")
+
+	// The logins in progress are bounded, the oldest is forgotten first
+	for i := 0; i <= maxLogins; i++ {
+		s.StartLogin(fmt.Sprint("flood", i), Login{})
+		now = now.Add(time.Millisecond)
+	}
+	assert.Len(t, s.logins, maxLogins)
+	_, ok = s.FinishLogin("flood0")
+	assert.False(t, ok, "The oldest login is forgotten")
+	_, ok = s.FinishLogin(fmt.Sprint("flood", maxLogins))
+	assert.True(t, ok)
+
+	sid, err := s.Create(Identity{Subject: "alice"})
+	assert.Nil(t, err)
+	id, ok := s.Get(sid)
+	assert.True(t, ok)
+	assert.Equal(t, "alice", id.Subject)
+
+	now = now.Add(2 * time.Hour)
+	_, ok = s.Get(sid)
+	assert.False(t, ok, "A session expires")
+
+	sid, _ = s.Create(Identity{Subject: "alice"})
+	s.Delete(sid)
+	_, ok = s.Get(sid)
+	assert.False(t, ok)
+}
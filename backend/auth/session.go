@@ -0,0 +1,150 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// loginTTL is how long a user may take to log in at the identity provider
+	loginTTL = 10 * time.Minute
+	// maxLogins bounds the logins in progress, the oldest is forgotten first
+	maxLogins = 10000
+)
+
+// Login is a login in progress, waiting for the identity provider callback
+type Login struct {
+	Verifier string
+	Nonce    string
+	// ReturnTo is the local path the user is sent back to
+	ReturnTo string
+
+	expiresAt time.Time
+}
+
+type session struct {
+	identity  Identity
+	expiresAt time.Time
+}
+
+// Sessions keeps the logins in progress and the logged in identities in
+// memory. It is safe for concurrent use.
+type Sessions struct {
+	ttl time.Duration
+
+	// Now returns the current time, tests may replace it
+	Now func() time.Time
+
+	mu        sync.Mutex
+	logins    map[string]Login
+	sessions  map[string]session
+	lastSweep time.Time
+}
+
+// NewSessions creates Sessions which expire ttl after login
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{
+		ttl:      ttl,
+		Now:      time.Now,
+		logins:   make(map[string]Login),
+		sessions: make(map[string]session),
+	}
+}
+
+// StartLogin records a login in progress by its state, forgetting the
+// oldest login when there are too many
+func (s *Sessions) StartLogin(state string, l Login) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	s.sweep(now)
+	if _, ok := s.logins[state]; !ok && len(s.logins) >= maxLogins {
+		s.forgetOldestLogin(now)
+	}
+	l.expiresAt = now.Add(loginTTL)
+	s.logins[state] = l
+}
+
+// forgetOldestLogin forgets the expired logins, or the oldest login when
+// none expired. The caller must hold the lock.
+func (s *Sessions) forgetOldestLogin(now time.Time) {
+	oldest := ""
+	for state, l := range s.logins {
+		if now.After(l.expiresAt) {
+			delete(s.logins, state)
+		} else if oldest == "" || l.expiresAt.Before(s.logins[oldest].expiresAt) {
+			oldest = state
+		}
+	}
+	if len(s.logins) >= maxLogins {
+		delete(s.logins, oldest)
+	}
+}
+
+// FinishLogin returns and forgets the login in progress of the state
+func (s *Sessions) FinishLogin(state string) (Login, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, ok := s.logins[state]
+	delete(s.logins, state)
+	if !ok || s.Now().After(l.expiresAt) {
+		return Login{}, false
+	}
+	return l, true
+}
+
+// Create starts a session of the identity and returns its id
+func (s *Sessions) Create(id Identity) (string, error) {
+	sid, err := RandomString()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[sid] = session{identity: id, expiresAt: s.Now().Add(s.ttl)}
+	return sid, nil
+}
+
+// Get returns the identity of a live session
+func (s *Sessions) Get(sid string) (Identity, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.sessions[sid]
+	if !ok || s.Now().After(v.expiresAt) {
+		return Identity{}, false
+	}
+	return v.identity, true
+}
+
+// Delete ends a session
+func (s *Sessions) Delete(sid string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sid)
+}
+
+// sweep forgets the expired logins and sessions, at most once per login
+// TTL. The caller must hold the lock.
+func (s *Sessions) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < loginTTL {
+		return
+	}
+	s.lastSweep = now
+
+	for state, l := range s.logins {
+		if now.After(l.expiresAt) {
+			delete(s.logins, state)
+		}
+	}
+	for sid, v := range s.sessions {
+		if now.After(v.expiresAt) {
+			delete(s.sessions, sid)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// Tokens are named bearer tokens of API clients
+type Tokens []Token
+
+// Token is a bearer token, the name identifies its holder in the logs
+type Token struct {
+	Name   string
+	Secret string
+}
+
+// ParseTokens parses comma separated "name:secret" pairs
+func ParseTokens(s string) (Tokens, error) {
+	var tokens Tokens
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.IndexByte(pair, ':')
+		if i <= 0 || i == len(pair)-1 {
+			return nil, fmt.Errorf("token %q is not a name:secret pair", pair)
+		}
+		tokens = append(tokens, Token{Name: pair[:i], Secret: pair[i+1:]})
+	}
+	return tokens, nil
+}
+
+// Lookup returns the name of the token with the secret. It compares with
+// every token in constant time.
+func (t Tokens) Lookup(secret string) (string, bool) {
+	name, found := "", false
+	for _, token := range t {
+		if subtle.ConstantTimeCompare([]byte(token.Secret), []byte(secret)) == 1 && !found {
+			name, found = token.Name, true
+		}
+	}
+	return name, found
+}
+
+// BearerToken returns the token of an "Authorization: Bearer" header value
+func BearerToken(header string) (string, bool) {
+	const prefix = "Bearer "
+	if len(header) <= len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", false
+	}
+	return strings.TrimSpace(header[len(prefix):]), true
+}
@@ -0,0 +1,34 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokens(t *testing.T) {
+	tokens, err := ParseTokens(" alice:s3cret, ci:other:part ,")
+	assert.Nil(t, err)
+	assert.Equal(t, Tokens{{Name: "alice", Secret: "s3cret"}, {Name: "ci", Secret: "other:part"}}, tokens)
+
+	name, ok := tokens.Lookup("other:part")
+	assert.True(t, ok)
+	assert.Equal(t, "ci", name)
+	_, ok = tokens.Lookup("s3cre")
+	assert.False(t, ok)
+	_, ok = Tokens(nil).Lookup("")
+	assert.False(t, ok)
+
+	for _, input := range []string{"secret", ":secret", "name:"} {
+		_, err := ParseTokens(input)
+		assert.NotNil(t, err, input)
+	}
+
+	token, ok := BearerToken("bearer abc")
+	assert.True(t, ok)
+	assert.Equal(t, "abc", token)
+	for _, header := range []string{"", "Bearer ", "Basic abc"} {
+		_, ok := BearerToken(header)
+		assert.False(t, ok, header)
+	}
+}
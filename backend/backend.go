@@ -2,17 +2,65 @@ package backend
 
 import (
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/golang/glog"
+	"github.com/jenting/voting-topic/backend/anomaly"
 	"github.com/jenting/voting-topic/backend/apis"
+	"github.com/jenting/voting-topic/backend/audit"
+	"github.com/jenting/voting-topic/backend/auth"
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+	"github.com/jenting/voting-topic/backend/idempotency"
+	"github.com/jenting/voting-topic/backend/moderation"
+	"github.com/jenting/voting-topic/backend/outbox"
+	"github.com/jenting/voting-topic/backend/pow"
+	"github.com/jenting/voting-topic/backend/scheduler"
+	"github.com/jenting/voting-topic/backend/validation"
+	"github.com/jenting/voting-topic/backend/voter"
+	"github.com/jenting/voting-topic/backend/webhook"
 	"github.com/jenting/voting-topic/frontend"
 )
 
+var (
+	fixtures        = flag.String("fixtures", "", "JSON file of topics to seed the in-memory cache with")
+	validationRules = flag.String("validation-rules", "", "JSON file of topic field validation rules overriding the defaults")
+	moderationRules = flag.String("moderation", "", "JSON file of the new topic moderation blocklist and approval settings")
+	anomalyRules    = flag.String("anomaly", "", "JSON file of the vote anomaly detector settings overriding the defaults")
+	powDifficulty   = flag.Int("pow-difficulty", 0, "Leading zero bits of the proof of work required to vote, 0 disables it")
+	powMaxDiff      = flag.Int("pow-max-difficulty", 20, "Leading zero bits of the proof of work required to vote under load")
+	powLoad         = flag.Int("pow-load", 100, "Challenges per second above which the proof of work difficulty rises, 0 keeps it fixed")
+	voterCookies    = flag.Bool("voter-cookies", false, "Identify voters by signed cookie and allow one vote per topic")
+	oidcIssuer      = flag.String("oidc-issuer", "", "OpenID Connect issuer URL enabling the login, the client secret is read from OIDC_CLIENT_SECRET")
+	oidcClientID    = flag.String("oidc-client-id", "", "OpenID Connect client id")
+	oidcRedirectURL = flag.String("oidc-redirect-url", "", "OpenID Connect callback URL, ending with /callback")
+	companyDomains  = flag.String("company-domains", "", "Comma separated email domains allowed to vote on restricted topics, empty allows every login")
+	admins          = flag.String("admins", "", "Comma separated login emails allowed on the /admin routes, the admin bearer tokens are read from ADMIN_TOKENS")
+	sessionTTL      = flag.Duration("session-ttl", 24*time.Hour, "Lifetime of a login session")
+	reportThreshold = flag.Int("report-threshold", 5, "Number of distinct users whose reports hide a topic for review, 0 disables it")
+	idempotencyKeys = flag.Int("idempotency-keys", 10000, "Number of Idempotency-Key responses kept, the least recently used is forgotten first")
+	idempotencyTTL  = flag.Duration("idempotency-ttl", 24*time.Hour, "Lifetime of a stored Idempotency-Key response")
+	auditFile       = flag.String("audit-log", "", "JSON lines file appended with every audit log entry, empty keeps the entries in memory only")
+	auditEntries    = flag.Int("audit-entries", 100000, "Number of audit log entries kept in memory for queries, the oldest is dropped first")
+	webhookConfig   = flag.String("webhooks", "", "JSON file of the outgoing webhooks and their delivery settings")
+	outboxNATS      = flag.String("outbox-nats", "", "NATS server URL nats://[user:pass@|token@]host[:port] the topic changes are published to")
+	outboxJetStream = flag.Bool("outbox-jetstream", true, "Wait for a JetStream stream to store each topic change published to NATS, false publishes at most once")
+	outboxFile      = flag.String("outbox-file", "", "JSON lines file the topic changes are published to instead of NATS, for offline testing")
+	outboxSubject   = flag.String("outbox-subject", "voting", "Subject prefix of the published topic changes")
+	outboxSize      = flag.Int("outbox-size", 1000000, "Number of topic changes kept until published, further changes are refused with 503 until they are")
+	outboxFlush     = flag.Duration("outbox-flush", 10*time.Second, "Time allowed to publish the pending topic changes on shutdown")
+	proxies         = flag.String("trusted-proxies", "", "Comma separated proxy IPs and CIDRs whose X-Forwarded-For header gives the client IP, empty trusts none")
+	alertHosts      = flag.String("alert-callback-hosts", "", "Comma separated hosts the alert rule callbacks may post to, empty disables the callbacks")
+	voteCredits     = flag.Uint64("vote-credits", 0, "Credits of each voter per board round, k votes on a topic cost k² credits, 0 disables them")
+)
+
 // StartServer starts backend server
 func StartServer(signalCh <-chan os.Signal) {
 	port := os.Getenv("PORT")
@@ -21,6 +69,217 @@ func StartServer(signalCh <-chan os.Signal) {
 		log.Fatal("$PORT must be set")
 	}
 
+	// Seed data, the cache starts empty by default
+	if *fixtures != "" {
+		uids, err := cache.LoadFixtureFile(*fixtures)
+		if err != nil {
+			glog.Fatalf("Load fixtures %v err: %v", *fixtures, err)
+		}
+		glog.Infof("Loaded %d topics from fixtures %v", len(uids), *fixtures)
+	}
+
+	if *validationRules != "" {
+		rules, err := validation.LoadRuleFile(*validationRules)
+		if err != nil {
+			glog.Fatalf("Load validation rules %v err: %v", *validationRules, err)
+		}
+		apis.SetTopicRules(rules)
+	}
+
+	if *moderationRules != "" {
+		filter, err := moderation.LoadFilterFile(*moderationRules)
+		if err != nil {
+			glog.Fatalf("Load moderation rules %v err: %v", *moderationRules, err)
+		}
+		apis.SetModerator(filter)
+	}
+
+	apis.SetReportThreshold(*reportThreshold)
+	apis.SetVoteCredits(*voteCredits)
+	apis.SetIdempotencyStore(idempotency.New(*idempotencyKeys, *idempotencyTTL))
+
+	var auditSink io.Writer
+	if *auditFile != "" {
+		file, err := os.OpenFile(*auditFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			glog.Fatalf("Open audit log %v err: %v", *auditFile, err)
+		}
+		auditSink = file
+	}
+	apis.SetAuditLog(audit.New(*auditEntries, auditSink))
+
+	if *anomalyRules != "" {
+		detector, err := anomaly.LoadFile(*anomalyRules)
+		if err != nil {
+			glog.Fatalf("Load anomaly rules %v err: %v", *anomalyRules, err)
+		}
+		detector.Errorf = glog.Errorf
+		apis.SetVoteDetector(detector)
+	}
+
+	if *powDifficulty > 0 {
+		// Challenges of another instance are rejected unless they share POW_SECRET
+		gate, err := pow.New(pow.Config{
+			Secret:        []byte(os.Getenv("POW_SECRET")),
+			Difficulty:    *powDifficulty,
+			MaxDifficulty: *powMaxDiff,
+			TTL:           2 * time.Minute,
+			LoadWindow:    time.Second,
+			LoadThreshold: *powLoad,
+		})
+		if err != nil {
+			glog.Fatalf("Create proof of work gate err: %v", err)
+		}
+		apis.SetVoteGate(gate)
+	}
+
+	if *voterCookies {
+		// VOTER_KEYS lists "id:secret" pairs, the first one signs new cookies
+		keys, err := voter.ParseKeys(os.Getenv("VOTER_KEYS"))
+		if err != nil {
+			glog.Fatalf("Parse VOTER_KEYS err: %v", err)
+		}
+		sessions, err := voter.New(keys)
+		if err != nil {
+			glog.Fatalf("Create voter sessions err: %v", err)
+		}
+		apis.SetVoterSessions(sessions)
+		frontend.SetVoterSessions(sessions)
+	}
+
+	if *oidcIssuer != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		provider, err := auth.Discover(ctx, auth.Config{
+			Issuer:       *oidcIssuer,
+			ClientID:     *oidcClientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  *oidcRedirectURL,
+			Scopes:       []string{"email", "profile"},
+		})
+		cancel()
+		if err != nil {
+			glog.Fatalf("Discover OIDC provider err: %v", err)
+		}
+
+		var domains []string
+		for _, domain := range strings.Split(*companyDomains, ",") {
+			if domain = strings.TrimSpace(domain); domain != "" {
+				domains = append(domains, domain)
+			}
+		}
+		apis.SetAuth(provider, auth.NewSessions(*sessionTTL), domains)
+	}
+
+	// ADMIN_TOKENS lists "name:secret" pairs, without them and -admins every
+	// /admin request is refused
+	adminTokens, err := auth.ParseTokens(os.Getenv("ADMIN_TOKENS"))
+	if err != nil {
+		glog.Fatalf("Parse ADMIN_TOKENS err: %v", err)
+	}
+	var adminIdentities []string
+	for _, identity := range strings.Split(*admins, ",") {
+		if identity = strings.TrimSpace(identity); identity != "" {
+			adminIdentities = append(adminIdentities, identity)
+		}
+	}
+	apis.SetAdmins(adminTokens, adminIdentities)
+
+	// SERVICE_TOKENS lists the "name:secret" pairs of the services adding
+	// batch votes, without them every batch is refused
+	serviceTokens, err := auth.ParseTokens(os.Getenv("SERVICE_TOKENS"))
+	if err != nil {
+		glog.Fatalf("Parse SERVICE_TOKENS err: %v", err)
+	}
+	apis.SetServiceTokens(serviceTokens)
+
+	var trustedProxies []string
+	for _, proxy := range strings.Split(*proxies, ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	if err := apis.SetTrustedProxies(trustedProxies); err != nil {
+		glog.Fatalf("Set trusted proxies err: %v", err)
+	}
+
+	var callbackHosts []string
+	for _, host := range strings.Split(*alertHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			callbackHosts = append(callbackHosts, host)
+		}
+	}
+	apis.SetAlertCallbackHosts(callbackHosts)
+
+	// Fire the poll closed events
+	events.Subscribe(func(e events.Event) {
+		if e.Type != events.TopicVoted {
+			glog.Infof("Event %v of topic %v", e.Type, e.Topic)
+		}
+	})
+	schedulerCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go scheduler.New(events.Default, time.Second).Run(schedulerCtx)
+
+	if *webhookConfig != "" {
+		dispatcher, err := webhook.LoadFile(*webhookConfig)
+		if err != nil {
+			glog.Fatalf("Load webhooks %v err: %v", *webhookConfig, err)
+		}
+		apis.SetWebhooks(dispatcher)
+		go dispatcher.Run(schedulerCtx)
+		glog.Infof("Delivering events to %d webhooks", dispatcher.Hooks())
+	}
+
+	// Publish the topic changes from now on, at least once
+	var publisher outbox.Publisher
+	switch {
+	case *outboxNATS != "" && *outboxFile != "":
+		glog.Fatalf("Set only one of -outbox-nats and -outbox-file")
+	case *outboxNATS != "":
+		nats, err := outbox.NewNATS(*outboxNATS, 10*time.Second)
+		if err != nil {
+			glog.Fatalf("Outbox NATS %v err: %v", *outboxNATS, err)
+		}
+		nats.JetStream = *outboxJetStream
+		publisher = nats
+	case *outboxFile != "":
+		sink, err := outbox.NewFileSink(*outboxFile)
+		if err != nil {
+			glog.Fatalf("Open outbox file %v err: %v", *outboxFile, err)
+		}
+		publisher = sink
+	}
+	flushOutbox := func() {}
+	if publisher != nil {
+		defer publisher.Close()
+
+		box := outbox.New(*outboxSize)
+		box.Errorf = glog.Warningf
+		cache.SetMutationRecorder(func(m cache.Mutation) {
+			if _, err := box.Append(*outboxSubject+"."+string(m.Type), m); err != nil {
+				glog.Errorf("Record %v of topic %v err: %v", m.Type, m.UID, err)
+			}
+		})
+		apis.SetOutbox(box)
+
+		relayCtx, stopRelay := context.WithCancel(context.Background())
+		relayDone := make(chan struct{})
+		go func() {
+			box.Relay(relayCtx, publisher)
+			close(relayDone)
+		}()
+		// Publish the changes left once the server stopped
+		flushOutbox = func() {
+			stopRelay()
+			<-relayDone
+			ctx, cancel := context.WithTimeout(context.Background(), *outboxFlush)
+			defer cancel()
+			if err := box.Flush(ctx, publisher); err != nil {
+				glog.Errorf("Flush outbox err: %v", err)
+			}
+		}
+	}
+
 	router := apis.SetupRouter()
 	frontend.SetupFrontend(router)
 
@@ -47,7 +306,8 @@ func StartServer(signalCh <-chan os.Signal) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
-		glog.Fatalf("server shutdown: %v", err)
+		glog.Errorf("server shutdown: %v", err)
 	}
+	flushOutbox()
 	glog.Info("Shutdown server Done")
 }
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrBatchAborted is returned for the valid votes of an atomic batch which
+// was not applied because of another vote
+var ErrBatchAborted = errors.New("batch aborted")
+
+// TopicVotes are votes to add to a topic counts
+type TopicVotes struct {
+	UID   uuid.UUID
+	Up    bool
+	Count uint64
+}
+
+// IncTopicVotesBatch adds the votes of the batch to the visible topics. It
+// returns the error of each vote, nil when it was added: ErrTopicNotFound,
+// ErrPollNotOpen and ErrPollClosed outside of the voting window, or
+// ErrCountOutOfRange when the count would overflow. An
+// atomic batch adds no vote unless all of them can be added, the valid
+// votes of a failed atomic batch get ErrBatchAborted.
+func IncTopicVotesBatch(batch []TopicVotes, atomic bool) []error {
+	// No topic changes state between the checks and the adds
+	lock.Lock()
+	defer lock.Unlock()
+
+	now := time.Now()
+	errs := make([]error, len(batch))
+	failed := false
+	// The counts of the topics once the valid votes are added
+	counts := make(map[uuid.UUID]*[2]uint64)
+	for i, tv := range batch {
+		v, ok := topicKV[tv.UID]
+		if !ok || v.State != StateVisible {
+			errs[i] = ErrTopicNotFound
+		} else {
+			errs[i] = v.CheckOpen(now)
+		}
+		if errs[i] == nil {
+			count, ok := counts[tv.UID]
+			if !ok {
+				count = &[2]uint64{v.Upvote, v.Downvote}
+				counts[tv.UID] = count
+			}
+			n := &count[1]
+			if tv.Up {
+				n = &count[0]
+			}
+			if tv.Count > math.MaxUint64-*n {
+				errs[i] = ErrCountOutOfRange
+			} else {
+				*n += tv.Count
+			}
+		}
+		failed = failed || errs[i] != nil
+	}
+
+	if atomic && failed {
+		for i := range errs {
+			if errs[i] == nil {
+				errs[i] = ErrBatchAborted
+			}
+		}
+		return errs
+	}
+
+	for i, tv := range batch {
+		if errs[i] == nil {
+			addVotes(topicKV[tv.UID], tv.Up, tv.Count)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncTopicVotesBatch(t *testing.T) {
+	Reset()
+	past := time.Now().Add(-time.Hour)
+	a, err := CreateTopic("22-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	b, err := CreateTopic("22-2")
+	assert.Equal(t, nil, err, "Create topic failed")
+	closed, err := NewTopic(Topic{Name: "22-3", ClosesAt: &past})
+	assert.Equal(t, nil, err, "Create topic failed")
+	hidden, err := NewTopic(Topic{Name: "22-4", State: StateHidden})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	batch := []TopicVotes{
+		{UID: a, Up: true, Count: 3},
+		{UID: b, Up: false, Count: 2},
+		{UID: closed, Up: true, Count: 1},
+		{UID: hidden, Up: true, Count: 1},
+		{UID: uuid.New(), Up: true, Count: 1},
+	}
+	expected := []error{ErrBatchAborted, ErrBatchAborted, ErrPollClosed, ErrTopicNotFound, ErrTopicNotFound}
+
+	// An atomic batch adds nothing when a vote fails
+	assert.Equal(t, expected, IncTopicVotesBatch(batch, true))
+	assert.EqualValues(t, 0, GetTopicUpvote(a))
+	assert.EqualValues(t, 0, GetTopicDownvote(b))
+
+	// A best-effort batch adds the valid votes
+	expected[0], expected[1] = nil, nil
+	assert.Equal(t, expected, IncTopicVotesBatch(batch, false))
+	assert.EqualValues(t, 3, GetTopicUpvote(a))
+	assert.EqualValues(t, 2, GetTopicDownvote(b))
+	assert.EqualValues(t, 0, GetTopicUpvote(hidden))
+
+	assert.Equal(t, []error{nil, nil}, IncTopicVotesBatch(batch[:2], true))
+	assert.EqualValues(t, 6, GetTopicUpvote(a))
+}
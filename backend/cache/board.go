@@ -0,0 +1,57 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+)
+
+// Board defines a group of topics with its own leaderboard
+type Board struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// ErrBoardExists is returned when creating a board whose id is taken
+var ErrBoardExists = errors.New("board already exists")
+
+// Keeps the boards in-memory data cache
+// Key: Board id ; Value: Board
+var boardKV map[string]*Board
+
+// CreateBoard creates a new Board
+func CreateBoard(id, name string) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if _, ok := boardKV[id]; ok {
+		return ErrBoardExists
+	}
+
+	boardKV[id] = &Board{ID: id, Name: name}
+	return nil
+}
+
+// GetBoard gets Board accords id
+func GetBoard(id string) (*Board, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if v, ok := boardKV[id]; ok {
+		b := *v
+		return &b, true
+	}
+	return nil, false
+}
+
+// ListBoards gets all boards ordered by id
+func ListBoards() []Board {
+	lock.RLock()
+	boards := make([]Board, 0, len(boardKV))
+	for _, v := range boardKV {
+		boards = append(boards, *v)
+	}
+	lock.RUnlock()
+
+	sort.Slice(boards, func(i, j int) bool { return boards[i].ID < boards[j].ID })
+	return boards
+}
@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateBoard(t *testing.T) {
+	err := CreateBoard("board-1", "Board 1")
+	assert.Equal(t, nil, err, "Create board failed")
+
+	err = CreateBoard("board-1", "Board 1 again")
+	assert.Equal(t, ErrBoardExists, err, "Create board should failed")
+
+	board, exist := GetBoard("board-1")
+	assert.Equal(t, true, exist, "The board should exist")
+	assert.Equal(t, Board{ID: "board-1", Name: "Board 1"}, *board)
+
+	_, exist = GetBoard("board-not-exist")
+	assert.Equal(t, false, exist, "The board should not exist")
+
+	assert.Contains(t, ListBoards(), Board{ID: "board-1", Name: "Board 1"})
+}
+
+func TestNewTopicInBoard(t *testing.T) {
+	_, err := NewTopic(Topic{Name: "9-1", Board: "board-not-exist"})
+	assert.Equal(t, ErrBoardNotFound, err, "Create topic should failed")
+
+	err = CreateBoard("board-2", "Board 2")
+	assert.Equal(t, nil, err, "Create board failed")
+
+	uid1, err := NewTopic(Topic{Name: "9-1", Board: "board-2"})
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid2, err := NewTopic(Topic{Name: "9-2", Board: "board-2"})
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, err = CreateTopic("9-3")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	IncTopicUpvote(uid2)
+
+	topics := GetTopicDescendUpvote(InBoard("board-2"))
+	assert.Equal(t, TopicListUpvote{
+		{UID: uid2, Name: "9-2", Upvote: 1, Board: "board-2"},
+		{UID: uid1, Name: "9-1", Board: "board-2"},
+	}, topics)
+
+	assert.Empty(t, GetTopicDescendDownvote(InBoard("board-empty")))
+}
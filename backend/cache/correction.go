@@ -0,0 +1,121 @@
+package cache
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrCountOutOfRange is returned when a correction would take a vote count
+// below zero or beyond the uint64 range
+var ErrCountOutOfRange = errors.New("vote count out of range")
+
+// CountChange is a vote count before and after a correction
+type CountChange struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// CountCorrection records an administrative change of the vote counts of a topic
+type CountCorrection struct {
+	Topic    uuid.UUID   `json:"topic"`
+	Time     time.Time   `json:"time"`
+	Actor    string      `json:"actor"`
+	Reason   string      `json:"reason"`
+	Upvote   CountChange `json:"upvote"`
+	Downvote CountChange `json:"downvote"`
+}
+
+// Keeps the count corrections of each topic in order, guarded by lock. They
+// stay after the topic is deleted.
+// Key: Topic id ; Value: corrections
+var correctionKV map[uuid.UUID][]CountCorrection
+
+// SetTopicVotes sets the vote counts of a topic, nil keeps a count. It
+// returns ErrTopicNotFound.
+func SetTopicVotes(uid uuid.UUID, upvote, downvote *uint64, actor, reason string) (CountCorrection, error) {
+	return correctTopicVotes(uid, actor, reason, func(up, down uint64) (uint64, uint64, error) {
+		if upvote != nil {
+			up = *upvote
+		}
+		if downvote != nil {
+			down = *downvote
+		}
+		return up, down, nil
+	})
+}
+
+// AdjustTopicVotes adds signed deltas to the vote counts of a topic. It
+// returns ErrTopicNotFound, or ErrCountOutOfRange and leaves the counts
+// unchanged when a count would underflow or overflow.
+func AdjustTopicVotes(uid uuid.UUID, upDelta, downDelta int64, actor, reason string) (CountCorrection, error) {
+	return correctTopicVotes(uid, actor, reason, func(up, down uint64) (uint64, uint64, error) {
+		up, ok := addDelta(up, upDelta)
+		if !ok {
+			return 0, 0, ErrCountOutOfRange
+		}
+		down, ok = addDelta(down, downDelta)
+		if !ok {
+			return 0, 0, ErrCountOutOfRange
+		}
+		return up, down, nil
+	})
+}
+
+// addDelta returns n plus delta, false when out of the uint64 range
+func addDelta(n uint64, delta int64) (uint64, bool) {
+	if delta >= 0 {
+		if uint64(delta) > math.MaxUint64-n {
+			return 0, false
+		}
+		return n + uint64(delta), true
+	}
+
+	// -delta overflows for math.MinInt64
+	abs := uint64(-(delta + 1)) + 1
+	if abs > n {
+		return 0, false
+	}
+	return n - abs, true
+}
+
+// correctTopicVotes replaces the vote counts of a topic by the counts
+// returned by correct and records the correction
+func correctTopicVotes(uid uuid.UUID, actor, reason string, correct func(up, down uint64) (uint64, uint64, error)) (CountCorrection, error) {
+	// The write lock keeps the votes counted under the read lock out
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return CountCorrection{}, ErrTopicNotFound
+	}
+
+	up, down, err := correct(v.Upvote, v.Downvote)
+	if err != nil {
+		return CountCorrection{}, err
+	}
+
+	c := CountCorrection{
+		Topic:    uid,
+		Time:     time.Now().UTC(),
+		Actor:    actor,
+		Reason:   reason,
+		Upvote:   CountChange{From: v.Upvote, To: up},
+		Downvote: CountChange{From: v.Downvote, To: down},
+	}
+	v.Upvote, v.Downvote = up, down
+	correctionKV[uid] = append(correctionKV[uid], c)
+	recordMutation(TopicCorrected, v, 0, 0)
+	return c, nil
+}
+
+// GetTopicCorrections gets the count corrections of a topic, the oldest first
+func GetTopicCorrections(uid uuid.UUID) []CountCorrection {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return append([]CountCorrection{}, correctionKV[uid]...)
+}
@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddDelta(t *testing.T) {
+	tests := []struct {
+		n        uint64
+		delta    int64
+		expected uint64
+		ok       bool
+	}{
+		{5, 3, 8, true},
+		{5, -5, 0, true},
+		{5, -6, 0, false},
+		{0, math.MinInt64, 0, false},
+		{math.MaxUint64, math.MinInt64, math.MaxUint64 - 1<<63, true},
+		{math.MaxUint64 - 1, 1, math.MaxUint64, true},
+		{math.MaxUint64, 1, 0, false},
+	}
+
+	for _, test := range tests {
+		n, ok := addDelta(test.n, test.delta)
+		assert.Equal(t, test.ok, ok, "%d%+d", test.n, test.delta)
+		assert.Equal(t, test.expected, n, "%d%+d", test.n, test.delta)
+	}
+}
+
+func TestCorrectTopicVotes(t *testing.T) {
+	uid, err := CreateTopic("23-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	assert.Equal(t, nil, IncTopicVotes(uid, true, 10))
+
+	_, err = AdjustTopicVotes(uuid.New(), 1, 0, "admin", "typo")
+	assert.Equal(t, ErrTopicNotFound, err)
+
+	c, err := AdjustTopicVotes(uid, -7, 2, "admin", "bot votes")
+	assert.Equal(t, nil, err, "Adjust topic votes failed")
+	assert.Equal(t, CountChange{From: 10, To: 3}, c.Upvote)
+	assert.Equal(t, CountChange{From: 0, To: 2}, c.Downvote)
+
+	// Underflow leaves the counts unchanged
+	_, err = AdjustTopicVotes(uid, 1, -3, "admin", "too many")
+	assert.Equal(t, ErrCountOutOfRange, err)
+
+	zero := uint64(0)
+	c, err = SetTopicVotes(uid, nil, &zero, "admin", "reset downvotes")
+	assert.Equal(t, nil, err, "Set topic votes failed")
+	assert.Equal(t, CountChange{From: 3, To: 3}, c.Upvote)
+	assert.Equal(t, CountChange{From: 2, To: 0}, c.Downvote)
+
+	topic, _ := GetTopic(uid)
+	assert.EqualValues(t, 3, topic.Upvote)
+	assert.EqualValues(t, 0, topic.Downvote)
+
+	// The corrections stay after the topic is deleted
+	DeleteTopic(uid)
+	corrections := GetTopicCorrections(uid)
+	assert.Len(t, corrections, 2)
+	assert.Equal(t, "bot votes", corrections[0].Reason)
+	assert.Equal(t, "reset downvotes", corrections[1].Reason)
+	assert.Equal(t, []CountCorrection{}, GetTopicCorrections(uuid.New()))
+}
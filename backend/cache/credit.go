@@ -0,0 +1,174 @@
+package cache
+
+import (
+	"errors"
+	"math/bits"
+
+	"github.com/google/uuid"
+)
+
+// ErrInsufficientCredits is returned when a voter can not afford the votes
+var ErrInsufficientCredits = errors.New("insufficient credits")
+
+// CreditVotes are the votes a voter cast on a topic in a round
+type CreditVotes struct {
+	Upvote   uint64 `json:"upvote"`
+	Downvote uint64 `json:"downvote"`
+}
+
+// cost returns the credits spent on the votes, k upvotes and l downvotes
+// cost k² + l² credits. It returns false when the cost overflows.
+func (v CreditVotes) cost() (uint64, bool) {
+	hi, up := bits.Mul64(v.Upvote, v.Upvote)
+	if hi != 0 {
+		return 0, false
+	}
+	hi, down := bits.Mul64(v.Downvote, v.Downvote)
+	if hi != 0 {
+		return 0, false
+	}
+	sum, carry := bits.Add64(up, down, 0)
+	return sum, carry == 0
+}
+
+// CreditBalance is the credit ledger of a voter in a board round. Casting
+// k upvotes or downvotes on a topic costs k² credits, the downvotes do not
+// refund the upvotes as both stay counted.
+type CreditBalance struct {
+	Board   string `json:"board"`
+	Budget  uint64 `json:"budget"`
+	Spent   uint64 `json:"spent"`
+	Balance uint64 `json:"balance"`
+	// Votes are the votes cast per topic
+	Votes map[uuid.UUID]CreditVotes `json:"votes"`
+}
+
+// Keeps the credit ledgers of the current round of each board, guarded by lock
+// Key: Board id ; Value: votes cast per topic per voter
+var ledgerKV map[string]map[string]map[uuid.UUID]CreditVotes
+
+// spent returns the credits spent on the votes, it returns false when they
+// overflow
+func spent(votes map[uuid.UUID]CreditVotes) (uint64, bool) {
+	var total uint64
+	for _, v := range votes {
+		c, ok := v.cost()
+		if !ok {
+			return 0, false
+		}
+		var carry uint64
+		if total, carry = bits.Add64(total, c, 0); carry != 0 {
+			return 0, false
+		}
+	}
+	return total, true
+}
+
+// balance returns the ledger of voter in board.
+// The caller must hold at least the read lock.
+func balance(board, voter string, budget uint64) CreditBalance {
+	b := CreditBalance{Board: board, Budget: budget, Votes: make(map[uuid.UUID]CreditVotes)}
+	for uid, v := range ledgerKV[board][voter] {
+		b.Votes[uid] = v
+	}
+	// The ledger only holds affordable votes
+	b.Spent, _ = spent(b.Votes)
+	if b.Spent < budget {
+		b.Balance = budget - b.Spent
+	}
+	return b
+}
+
+// GetCreditBalance gets the ledger of voter in the current round of board
+func GetCreditBalance(board, voter string, budget uint64) CreditBalance {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return balance(board, voter, budget)
+}
+
+// SpendCredits adds n upvotes or downvotes of voter on a topic to the ledger
+// of the topic board. It returns ErrTopicNotFound, or ErrInsufficientCredits
+// when the votes of the voter would cost more than budget, then the ledger
+// is unchanged.
+func SpendCredits(voter string, uid uuid.UUID, up bool, n, budget uint64) (CreditBalance, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return CreditBalance{}, ErrTopicNotFound
+	}
+
+	b := balance(v.Board, voter, budget)
+	votes := b.Votes[uid]
+	count := &votes.Downvote
+	if up {
+		count = &votes.Upvote
+	}
+	var carry uint64
+	if *count, carry = bits.Add64(*count, n, 0); carry != 0 {
+		return b, ErrInsufficientCredits
+	}
+	b.Votes[uid] = votes
+	if total, ok := spent(b.Votes); !ok || total > budget {
+		return balance(v.Board, voter, budget), ErrInsufficientCredits
+	}
+
+	setCreditVotes(v.Board, voter, uid, votes)
+	return balance(v.Board, voter, budget), nil
+}
+
+// RefundCredits removes n upvotes or downvotes of voter on a topic from the
+// ledger of the topic board, such as the votes of SpendCredits which were
+// not counted
+func RefundCredits(voter string, uid uuid.UUID, up bool, n uint64) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return
+	}
+
+	votes := ledgerKV[v.Board][voter][uid]
+	count := &votes.Downvote
+	if up {
+		count = &votes.Upvote
+	}
+	if *count < n {
+		*count = 0
+	} else {
+		*count -= n
+	}
+	setCreditVotes(v.Board, voter, uid, votes)
+}
+
+// setCreditVotes sets the votes of voter on a topic of board.
+// The caller must hold the lock.
+func setCreditVotes(board, voter string, uid uuid.UUID, v CreditVotes) {
+	voters, ok := ledgerKV[board]
+	if !ok {
+		voters = make(map[string]map[uuid.UUID]CreditVotes)
+		ledgerKV[board] = voters
+	}
+	votes, ok := voters[voter]
+	if !ok {
+		votes = make(map[uuid.UUID]CreditVotes)
+		voters[voter] = votes
+	}
+	if v == (CreditVotes{}) {
+		delete(votes, uid)
+	} else {
+		votes[uid] = v
+	}
+}
+
+// ResetCredits starts a new round of board, all voters get their budget back.
+// The votes already cast stay counted.
+func ResetCredits(board string) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	delete(ledgerKV, board)
+}
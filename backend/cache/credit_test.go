@@ -0,0 +1,94 @@
+package cache
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendCredits(t *testing.T) {
+	Reset()
+	err := CreateBoard("q", "Quarter")
+	assert.Equal(t, nil, err, "Create board failed")
+	a, err := NewTopic(Topic{Name: "20-1", Board: "q"})
+	assert.Equal(t, nil, err, "Create topic failed")
+	b, err := NewTopic(Topic{Name: "20-2", Board: "q"})
+	assert.Equal(t, nil, err, "Create topic failed")
+	other, err := CreateTopic("20-3")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// 3 votes cost 9 credits, a 4th one 7 more
+	balance, err := SpendCredits("v1", a, true, 3, 20)
+	assert.Equal(t, nil, err)
+	assert.EqualValues(t, 9, balance.Spent)
+	assert.EqualValues(t, 11, balance.Balance)
+
+	balance, err = SpendCredits("v1", a, true, 1, 20)
+	assert.Equal(t, nil, err)
+	assert.EqualValues(t, 16, balance.Spent)
+
+	// 2 downvotes on b cost 4 credits, more than the 4 left is refused
+	balance, err = SpendCredits("v1", b, false, 2, 20)
+	assert.Equal(t, nil, err)
+	assert.EqualValues(t, 0, balance.Balance)
+	balance, err = SpendCredits("v1", b, false, 1, 20)
+	assert.Equal(t, ErrInsufficientCredits, err)
+	assert.Equal(t, map[uuid.UUID]CreditVotes{a: {Upvote: 4}, b: {Downvote: 2}}, balance.Votes)
+
+	// Reversing the direction costs credits instead of refunding them
+	balance, err = SpendCredits("v1", a, false, 1, 20)
+	assert.Equal(t, ErrInsufficientCredits, err)
+	assert.EqualValues(t, 20, balance.Spent)
+
+	// Votes whose cost overflows are refused
+	for _, n := range []uint64{1 << 32, math.MaxUint64} {
+		balance, err = SpendCredits("v3", a, true, n, math.MaxUint64)
+		assert.Equal(t, ErrInsufficientCredits, err, n)
+		assert.EqualValues(t, 0, balance.Spent)
+	}
+	_, err = SpendCredits("v3", a, true, math.MaxUint32, math.MaxUint64)
+	assert.Equal(t, nil, err)
+	_, err = SpendCredits("v3", a, false, math.MaxUint32, math.MaxUint64)
+	assert.Equal(t, ErrInsufficientCredits, err)
+
+	// Uncounted votes are refunded
+	RefundCredits("v1", a, true, 4)
+	balance = GetCreditBalance("q", "v1", 20)
+	assert.EqualValues(t, 4, balance.Spent)
+	assert.Equal(t, map[uuid.UUID]CreditVotes{b: {Downvote: 2}}, balance.Votes)
+
+	// Boards and voters have separate ledgers
+	assert.EqualValues(t, 0, GetCreditBalance("", "v1", 20).Spent)
+	assert.EqualValues(t, 0, GetCreditBalance("q", "v2", 20).Spent)
+	_, err = SpendCredits("v1", other, true, 4, 20)
+	assert.Equal(t, nil, err)
+	assert.EqualValues(t, 16, GetCreditBalance("", "v1", 20).Spent)
+
+	// A new round gives the budget back
+	ResetCredits("q")
+	assert.EqualValues(t, 20, GetCreditBalance("q", "v1", 20).Balance)
+	assert.EqualValues(t, 16, GetCreditBalance("", "v1", 20).Spent)
+
+	// Deleting a topic refunds its credits
+	DeleteTopic(other)
+	assert.EqualValues(t, 0, GetCreditBalance("", "v1", 20).Spent)
+}
+
+func TestGetTopicDescendEffective(t *testing.T) {
+	Reset()
+	a, err := CreateTopic("21-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	b, err := CreateTopic("21-2")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	assert.Equal(t, nil, IncTopicVotes(a, true, 5))
+	assert.Equal(t, nil, IncTopicVotes(a, false, 4))
+	assert.Equal(t, nil, IncTopicVotes(b, true, 3))
+
+	list := GetTopicDescendEffective()
+	assert.Len(t, list, 2)
+	assert.Equal(t, b, list[0].UID)
+	assert.EqualValues(t, 1, list[1].Effective())
+}
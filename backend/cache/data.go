@@ -1,10 +1,15 @@
 package cache
 
 import (
+	"errors"
 	"sort"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/tally"
 )
 
 // Topic defines the Topic voting information for database
@@ -13,71 +18,250 @@ type Topic struct {
 	Name     string    `json:"name"`
 	Upvote   uint64    `json:"upvote"`
 	Downvote uint64    `json:"downvote"`
+	Board    string    `json:"board,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+
+	// Description is Markdown, it is sanitized when rendered
+	Description string `json:"description,omitempty"`
+	URL         string `json:"url,omitempty"`
+	Author      string `json:"author,omitempty"`
+
+	// State is empty for visible topics
+	State TopicState `json:"state,omitempty"`
+
+	// CreatedBy is the verified identity of the creator, empty when anonymous
+	CreatedBy string `json:"createdBy,omitempty"`
+	// Restricted topics are only voted on by identified company accounts
+	Restricted bool `json:"restricted,omitempty"`
+
+	// OpensAt and ClosesAt bound the voting window, nil means unbounded
+	OpensAt  *time.Time `json:"opensAt,omitempty"`
+	ClosesAt *time.Time `json:"closesAt,omitempty"`
 }
 
+// ErrBoardNotFound is returned when a topic refers to a board which does not exist
+var ErrBoardNotFound = errors.New("board not found")
+
 // Keeps the topics in-memory data cache
 // Key: Topic id ; Value: Topic
 var topicKV map[uuid.UUID]*Topic
 
+// Guards topicKV, boardKV and the nameKV, termKV and sortedTerms indexes. Vote counters are updated atomically under the read lock,
+// the write lock is only needed when adding, removing or replacing topics.
+var lock sync.RWMutex
+
 func init() {
 	topicKV = make(map[uuid.UUID]*Topic)
+	boardKV = make(map[string]*Board)
+	nameKV = make(map[string]uuid.UUID)
+	termKV = make(map[string]map[uuid.UUID]int)
+	sortedTerms = nil
+	reportKV = make(map[uuid.UUID][]Report)
+	voterKV = make(map[string]map[uuid.UUID]bool)
+	pollKV = make(map[uuid.UUID]*Poll)
+	ballotKV = make(map[uuid.UUID][]tally.Ballot)
+	ledgerKV = make(map[string]map[string]map[uuid.UUID]CreditVotes)
+	correctionKV = make(map[uuid.UUID][]CountCorrection)
+}
+
+// snapshot returns a copy of v that is safe to use without holding the lock.
+// The caller must hold at least the read lock.
+func snapshot(v *Topic) Topic {
+	return Topic{
+		UID:      v.UID,
+		Name:     v.Name,
+		Upvote:   atomic.LoadUint64(&v.Upvote),
+		Downvote: atomic.LoadUint64(&v.Downvote),
+		Board:    v.Board,
+		Tags:     append([]string(nil), v.Tags...),
+
+		Description: v.Description,
+		URL:         v.URL,
+		Author:      v.Author,
+
+		State: v.State,
 
-	// Set init data
-	uid1, _ := CreateTopic("I'm-Topic-1")
-	uid2, _ := CreateTopic("I'm-Topic-2")
-	uid3, _ := CreateTopic("I'm-Topic-3")
+		CreatedBy:  v.CreatedBy,
+		Restricted: v.Restricted,
 
-	// upvote=2 downvote=1
-	IncTopicUpvote(uid1)
-	IncTopicUpvote(uid1)
-	IncTopicDownvote(uid1)
+		OpensAt:  v.OpensAt,
+		ClosesAt: v.ClosesAt,
+	}
+}
 
-	// upvote=3 downvote=2
-	IncTopicUpvote(uid2)
-	IncTopicUpvote(uid2)
-	IncTopicUpvote(uid2)
-	IncTopicDownvote(uid2)
-	IncTopicDownvote(uid2)
+// addIndexes adds v to the name and text indexes.
+// The caller must hold the write lock.
+func addIndexes(v *Topic) {
+	indexName(v)
+	indexTerms(v)
+}
 
-	// upvote=1 downvote=3
-	IncTopicUpvote(uid3)
-	IncTopicDownvote(uid3)
-	IncTopicDownvote(uid3)
-	IncTopicDownvote(uid3)
+// removeIndexes removes v from the name and text indexes.
+// The caller must hold the write lock.
+func removeIndexes(v *Topic) {
+	unindexName(v)
+	unindexTerms(v)
 }
 
 // CreateTopic creates a new Topic
 func CreateTopic(topicName string) (uuid.UUID, error) {
+	return NewTopic(Topic{Name: topicName})
+}
+
+// NewTopic creates a new Topic from t, the uid and vote counts of t are ignored.
+// When the board already has a topic with the same normalized name, it
+// returns that topic's uid and ErrTopicExists.
+func NewTopic(t Topic) (uuid.UUID, error) {
 	uid, err := uuid.NewRandom()
 	if err != nil {
 		return uuid.Nil, err
 	}
 
-	topicKV[uid] = &Topic{UID: uid, Name: topicName}
+	lock.Lock()
+	defer lock.Unlock()
+
+	if t.Board != "" {
+		if _, ok := boardKV[t.Board]; !ok {
+			return uuid.Nil, ErrBoardNotFound
+		}
+	}
+
+	if existing, ok := nameKV[nameKey(t.Board, t.Name)]; ok {
+		return existing, ErrTopicExists
+	}
+
+	v := &Topic{
+		UID:         uid,
+		Name:        t.Name,
+		Board:       t.Board,
+		Tags:        NormalizeTags(t.Tags),
+		Description: t.Description,
+		URL:         t.URL,
+		Author:      t.Author,
+		State:       t.State,
+		CreatedBy:   t.CreatedBy,
+		Restricted:  t.Restricted,
+		OpensAt:     utcTime(t.OpensAt),
+		ClosesAt:    utcTime(t.ClosesAt),
+	}
+	topicKV[uid] = v
+	addIndexes(v)
+	recordMutation(TopicCreated, v, 0, 0)
 	return uid, nil
 }
 
 // GetTopic get Topic accords uuid
 func GetTopic(uid uuid.UUID) (*Topic, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
 	if v, ok := topicKV[uid]; ok {
-		return v, true
+		t := snapshot(v)
+		return &t, true
 	}
 	return nil, false
 }
 
 // DeleteTopic deletes a Topic
 func DeleteTopic(uid uuid.UUID) bool {
-	if _, ok := topicKV[uid]; !ok {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
 		// Not exists
 		return true
 	}
 
+	removeIndexes(v)
 	delete(topicKV, uid)
+	delete(reportKV, uid)
+	recordMutation(TopicDeleted, v, 0, 0)
+	// Refund the credits spent on the topic
+	for _, votes := range ledgerKV[v.Board] {
+		delete(votes, uid)
+	}
 	return true
 }
 
+// RenameTopic sets Topic name. It returns ErrTopicExists when another topic
+// of the board already has the same normalized name.
+func RenameTopic(uid uuid.UUID, topicName string) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return ErrTopicNotFound
+	}
+
+	if existing, ok := nameKV[nameKey(v.Board, topicName)]; ok && existing != uid {
+		return ErrTopicExists
+	}
+
+	removeIndexes(v)
+	v.Name = topicName
+	addIndexes(v)
+	return nil
+}
+
+// EditTopic changes the topic of uid in one write: edit gets a copy of the
+// topic and may change its name, tags, details, voting window and state,
+// the other fields are kept. An error of edit aborts the edit. It returns
+// the topic before and after the edit, or ErrTopicNotFound, ErrTopicExists
+// and ErrInvalidWindow, leaving the topic unchanged.
+func EditTopic(uid uuid.UUID, edit func(t *Topic) error) (Topic, Topic, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return Topic{}, Topic{}, ErrTopicNotFound
+	}
+	before := snapshot(v)
+
+	t := snapshot(v)
+	if err := edit(&t); err != nil {
+		return before, before, err
+	}
+	if err := CheckWindow(t.OpensAt, t.ClosesAt); err != nil {
+		return before, before, err
+	}
+	if existing, ok := nameKV[nameKey(v.Board, t.Name)]; ok && existing != uid {
+		return before, before, ErrTopicExists
+	}
+
+	removeIndexes(v)
+	v.Name = t.Name
+	v.Tags = NormalizeTags(t.Tags)
+	v.Description = t.Description
+	v.URL = t.URL
+	v.OpensAt, v.ClosesAt = utcTime(t.OpensAt), utcTime(t.ClosesAt)
+	v.State = t.State
+	addIndexes(v)
+	return before, snapshot(v), nil
+}
+
+// SetTopicDetails sets Topic description and URL
+func SetTopicDetails(uid uuid.UUID, description, url string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if v, ok := topicKV[uid]; ok {
+		removeIndexes(v)
+		v.Description = description
+		v.URL = url
+		addIndexes(v)
+		return true
+	}
+	return false
+}
+
 // GetTopicName gets Topic name
 func GetTopicName(uid uuid.UUID) string {
+	lock.RLock()
+	defer lock.RUnlock()
+
 	if v, ok := topicKV[uid]; ok {
 		return v.Name
 	}
@@ -86,36 +270,88 @@ func GetTopicName(uid uuid.UUID) string {
 
 // GetTopicUpvote gets Topic upvote counts
 func GetTopicUpvote(uid uuid.UUID) uint64 {
+	lock.RLock()
+	defer lock.RUnlock()
+
 	if v, ok := topicKV[uid]; ok {
-		return v.Upvote
+		return atomic.LoadUint64(&v.Upvote)
 	}
 	return 0
 }
 
 // GetTopicDownvote gets Topic downvote counts
 func GetTopicDownvote(uid uuid.UUID) uint64 {
+	lock.RLock()
+	defer lock.RUnlock()
+
 	if v, ok := topicKV[uid]; ok {
-		return v.Downvote
+		return atomic.LoadUint64(&v.Downvote)
 	}
 	return 0
 }
 
-// IncTopicUpvote sets Topic upvote counts
-func IncTopicUpvote(uid uuid.UUID) bool {
-	if v, ok := topicKV[uid]; ok {
-		atomic.AddUint64(&v.Upvote, 1)
-		return true
+// IncTopicUpvote sets Topic upvote counts. It returns ErrTopicNotFound,
+// or ErrPollNotOpen and ErrPollClosed outside of the voting window.
+func IncTopicUpvote(uid uuid.UUID) error {
+	return IncTopicVotes(uid, true, 1)
+}
+
+// IncTopicDownvote sets Topic downvote counts. It returns ErrTopicNotFound,
+// or ErrPollNotOpen and ErrPollClosed outside of the voting window.
+func IncTopicDownvote(uid uuid.UUID) error {
+	return IncTopicVotes(uid, false, 1)
+}
+
+// IncTopicVotes adds n upvotes or downvotes to Topic counts. It returns
+// ErrTopicNotFound, or ErrPollNotOpen and ErrPollClosed outside of the
+// voting window.
+func IncTopicVotes(uid uuid.UUID, up bool, n uint64) error {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return ErrTopicNotFound
 	}
-	return false
+	if err := v.CheckOpen(time.Now()); err != nil {
+		return err
+	}
+
+	addVotes(v, up, n)
+	return nil
 }
 
-// IncTopicDownvote sets Topic downvote counts
-func IncTopicDownvote(uid uuid.UUID) bool {
-	if v, ok := topicKV[uid]; ok {
-		atomic.AddUint64(&v.Downvote, 1)
-		return true
+// addVotes adds n upvotes or downvotes to v counts.
+// The caller must hold at least the read lock.
+func addVotes(v *Topic, up bool, n uint64) {
+	if up {
+		atomic.AddUint64(&v.Upvote, n)
+		recordMutation(TopicVoted, v, n, 0)
+	} else {
+		atomic.AddUint64(&v.Downvote, n)
+		recordMutation(TopicVoted, v, 0, n)
 	}
-	return false
+}
+
+// AddTopicVotes adds up upvotes and down downvotes to Topic counts. It
+// returns ErrTopicNotFound, or ErrPollNotOpen and ErrPollClosed outside of
+// the voting window.
+func AddTopicVotes(uid uuid.UUID, up, down uint64) error {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return ErrTopicNotFound
+	}
+	if err := v.CheckOpen(time.Now()); err != nil {
+		return err
+	}
+
+	atomic.AddUint64(&v.Upvote, up)
+	atomic.AddUint64(&v.Downvote, down)
+	recordMutation(TopicVoted, v, up, down)
+	return nil
 }
 
 // TopicListUpvote defines the Topic array with upvote
@@ -132,32 +368,82 @@ func (l TopicListDownvote) Len() int           { return len(l) }
 func (l TopicListDownvote) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l TopicListDownvote) Less(i, j int) bool { return l[i].Downvote < l[j].Downvote }
 
-// GetTopicDescendUpvote gets topics with desceding upvote order
-func GetTopicDescendUpvote() TopicListUpvote {
-	// Transfer map to array
-	uvList := make(TopicListUpvote, len(topicKV))
-	// Variable default value is 0
-	var index int
-	for k, v := range topicKV {
-		uvList[index] = Topic{UID: k, Name: v.Name, Upvote: v.Upvote, Downvote: v.Downvote}
-		index++
+// Effective returns the upvotes less the downvotes of the topic
+func (t *Topic) Effective() int64 {
+	return int64(t.Upvote) - int64(t.Downvote)
+}
+
+// TopicListEffective defines the Topic array with effective votes
+type TopicListEffective []Topic
+
+func (l TopicListEffective) Len() int           { return len(l) }
+func (l TopicListEffective) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l TopicListEffective) Less(i, j int) bool { return l[i].Effective() < l[j].Effective() }
+
+// TopicFilter reports whether a topic is included in a ranking
+type TopicFilter func(t *Topic) bool
+
+// InBoard includes only the topics of the given board
+func InBoard(board string) TopicFilter {
+	return func(t *Topic) bool { return t.Board == board }
+}
+
+// WithTags includes only the topics having all the given tags
+func WithTags(tags ...string) TopicFilter {
+	tags = NormalizeTags(tags)
+	return func(t *Topic) bool {
+		for _, tag := range tags {
+			if !hasTag(t.Tags, tag) {
+				return false
+			}
+		}
+		return true
 	}
+}
+
+// filterTopics returns a copy of the topics matching all filters.
+// The caller must hold at least the read lock.
+func filterTopics(filters []TopicFilter) []Topic {
+	topics := make([]Topic, 0, len(topicKV))
+next:
+	for _, v := range topicKV {
+		t := snapshot(v)
+		for _, filter := range filters {
+			if !filter(&t) {
+				continue next
+			}
+		}
+		topics = append(topics, t)
+	}
+	return topics
+}
+
+// GetTopicDescendUpvote gets visible topics matching all filters with desceding upvote order
+func GetTopicDescendUpvote(filters ...TopicFilter) TopicListUpvote {
+	lock.RLock()
+	uvList := TopicListUpvote(filterTopics(visibleOnly(filters)))
+	lock.RUnlock()
 
 	sort.Sort(sort.Reverse(TopicListUpvote(uvList)))
 	return uvList
 }
 
-// GetTopicDescendDownvote gets topics with desceding downvote order
-func GetTopicDescendDownvote() TopicListDownvote {
-	// Transfer map to array
-	dvList := make(TopicListDownvote, len(topicKV))
-	// Variable default value is 0
-	var index int
-	for k, v := range topicKV {
-		dvList[index] = Topic{UID: k, Name: v.Name, Upvote: v.Upvote, Downvote: v.Downvote}
-		index++
-	}
+// GetTopicDescendDownvote gets visible topics matching all filters with desceding downvote order
+func GetTopicDescendDownvote(filters ...TopicFilter) TopicListDownvote {
+	lock.RLock()
+	dvList := TopicListDownvote(filterTopics(visibleOnly(filters)))
+	lock.RUnlock()
 
 	sort.Sort(sort.Reverse(TopicListDownvote(dvList)))
 	return dvList
 }
+
+// GetTopicDescendEffective gets visible topics matching all filters with desceding effective votes order
+func GetTopicDescendEffective(filters ...TopicFilter) TopicListEffective {
+	lock.RLock()
+	evList := TopicListEffective(filterTopics(visibleOnly(filters)))
+	lock.RUnlock()
+
+	sort.Sort(sort.Reverse(evList))
+	return evList
+}
@@ -1,6 +1,7 @@
 package cache
 
 import (
+	"strings"
 	"sync"
 	"testing"
 
@@ -35,8 +36,8 @@ func TestGetTopicUpvote(t *testing.T) {
 	uid, err = CreateTopic("3")
 	assert.Equal(t, nil, err, "Create topic failed")
 
-	ok := IncTopicUpvote(uid)
-	assert.Equal(t, true, ok, "Set topic upvote failed")
+	err = IncTopicUpvote(uid)
+	assert.Equal(t, nil, err, "Set topic upvote failed")
 
 	vote = GetTopicUpvote(uid)
 	assert.EqualValues(t, 1, vote, "The upvote should be one")
@@ -52,8 +53,8 @@ func TestGetTopicDownvote(t *testing.T) {
 	uid, err = CreateTopic("4")
 	assert.Equal(t, nil, err, "Create topic failed")
 
-	ok := IncTopicDownvote(uid)
-	assert.Equal(t, true, ok, "Set topic downvote failed")
+	err = IncTopicDownvote(uid)
+	assert.Equal(t, nil, err, "Set topic downvote failed")
 
 	vote = GetTopicDownvote(uid)
 	assert.EqualValues(t, 1, vote, "The downvote should be one")
@@ -63,8 +64,8 @@ func TestSetTopicUpvote(t *testing.T) {
 	uid, err := uuid.NewRandom()
 	assert.Equal(t, nil, err, "New random failed")
 
-	ok := IncTopicUpvote(uid)
-	assert.Equal(t, false, ok, "Set topic upvote should failed")
+	err = IncTopicUpvote(uid)
+	assert.Equal(t, ErrTopicNotFound, err, "Set topic upvote should failed")
 
 	uid, err = CreateTopic("5")
 	assert.Equal(t, nil, err, "Create topic failed")
@@ -74,8 +75,8 @@ func TestSetTopicUpvote(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			ok := IncTopicUpvote(uid)
-			assert.Equal(t, true, ok, "Set topic upvote failed")
+			err := IncTopicUpvote(uid)
+			assert.Equal(t, nil, err, "Set topic upvote failed")
 		}()
 	}
 	wg.Wait()
@@ -88,8 +89,8 @@ func TestSetTopicDownvote(t *testing.T) {
 	uid, err := uuid.NewRandom()
 	assert.Equal(t, nil, err, "New random failed")
 
-	ok := IncTopicDownvote(uid)
-	assert.Equal(t, false, ok, "Set topic downvote should failed")
+	err = IncTopicDownvote(uid)
+	assert.Equal(t, ErrTopicNotFound, err, "Set topic downvote should failed")
 
 	uid, err = CreateTopic("6")
 	assert.Equal(t, nil, err, "Create topic failed")
@@ -99,8 +100,8 @@ func TestSetTopicDownvote(t *testing.T) {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			ok := IncTopicDownvote(uid)
-			assert.Equal(t, true, ok, "Set topic downvote failed")
+			err := IncTopicDownvote(uid)
+			assert.Equal(t, nil, err, "Set topic downvote failed")
 		}()
 	}
 	wg.Wait()
@@ -110,57 +111,82 @@ func TestSetTopicDownvote(t *testing.T) {
 }
 
 func TestGetTopicDescendUpvote(t *testing.T) {
-	tests := make(TopicListUpvote, 5)
-	tests[0] = Topic{Name: "7-5", Upvote: 9, Downvote: 0}
-	tests[1] = Topic{Name: "7-2", Upvote: 7, Downvote: 0}
-	tests[2] = Topic{Name: "7-1", Upvote: 5, Downvote: 0}
-	tests[3] = Topic{Name: "7-3", Upvote: 3, Downvote: 0}
-	tests[4] = Topic{Name: "7-4", Upvote: 1, Downvote: 0}
-
-	for idx := range tests {
-		uid, err := CreateTopic(tests[idx].Name)
-		assert.Equal(t, nil, err, "Create topic failed")
-
-		wg := sync.WaitGroup{}
-		for j := 0; j < int(tests[idx].Downvote); j++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				ok := IncTopicUpvote(uid)
-				assert.Equal(t, true, ok, "Set topic upvote failed")
-			}()
-		}
-		wg.Wait()
+	Reset()
+	uids, err := LoadFixtures(strings.NewReader(`[
+		{"name": "7-1", "upvote": 5},
+		{"name": "7-2", "upvote": 7},
+		{"name": "7-3", "upvote": 3},
+		{"name": "7-4", "upvote": 1},
+		{"name": "7-5", "upvote": 9}
+	]`))
+	assert.Equal(t, nil, err, "Load fixtures failed")
+
+	tests := TopicListUpvote{
+		{UID: uids[4], Name: "7-5", Upvote: 9},
+		{UID: uids[1], Name: "7-2", Upvote: 7},
+		{UID: uids[0], Name: "7-1", Upvote: 5},
+		{UID: uids[2], Name: "7-3", Upvote: 3},
+		{UID: uids[3], Name: "7-4", Upvote: 1},
 	}
 
 	topicListUpvote := GetTopicDescendUpvote()
-	assert.ObjectsAreEqual(topicListUpvote, tests)
+	assert.Equal(t, tests, topicListUpvote)
 }
 
 func TestGetTopicDescendDownvote(t *testing.T) {
-	tests := make(TopicListDownvote, 5)
-	tests[0] = Topic{Name: "8-5", Upvote: 0, Downvote: 9}
-	tests[1] = Topic{Name: "8-2", Upvote: 0, Downvote: 7}
-	tests[2] = Topic{Name: "8-1", Upvote: 0, Downvote: 5}
-	tests[3] = Topic{Name: "8-3", Upvote: 0, Downvote: 3}
-	tests[4] = Topic{Name: "8-4", Upvote: 0, Downvote: 1}
-
-	for idx := range tests {
-		uid, err := CreateTopic(tests[idx].Name)
-		assert.Equal(t, nil, err, "Create topic failed")
-
-		wg := sync.WaitGroup{}
-		for j := 0; j < int(tests[idx].Downvote); j++ {
-			wg.Add(1)
-			go func() {
-				defer wg.Done()
-				ok := IncTopicDownvote(uid)
-				assert.Equal(t, true, ok, "Set topic downvote failed")
-			}()
-		}
-		wg.Wait()
+	Reset()
+	uids, err := LoadFixtures(strings.NewReader(`[
+		{"name": "8-1", "downvote": 5},
+		{"name": "8-2", "downvote": 7},
+		{"name": "8-3", "downvote": 3},
+		{"name": "8-4", "downvote": 1},
+		{"name": "8-5", "downvote": 9}
+	]`))
+	assert.Equal(t, nil, err, "Load fixtures failed")
+
+	tests := TopicListDownvote{
+		{UID: uids[4], Name: "8-5", Downvote: 9},
+		{UID: uids[1], Name: "8-2", Downvote: 7},
+		{UID: uids[0], Name: "8-1", Downvote: 5},
+		{UID: uids[2], Name: "8-3", Downvote: 3},
+		{UID: uids[3], Name: "8-4", Downvote: 1},
 	}
 
 	topicListDownvote := GetTopicDescendDownvote()
-	assert.ObjectsAreEqual(topicListDownvote, tests)
+	assert.Equal(t, tests, topicListDownvote)
+}
+
+func TestEditTopic(t *testing.T) {
+	uid, err := CreateTopic("29-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, err = CreateTopic("29-2")
+	assert.Equal(t, nil, err, "Create topic failed")
+	IncTopicUpvote(uid)
+
+	before, after, err := EditTopic(uid, func(v *Topic) error {
+		v.Name, v.Tags, v.Description = "29-3", []string{"Go"}, "Edited"
+		v.Upvote = 100
+		return nil
+	})
+	assert.Equal(t, nil, err, "Edit topic failed")
+	assert.Equal(t, Topic{UID: uid, Name: "29-1", Upvote: 1}, before)
+	assert.Equal(t, Topic{UID: uid, Name: "29-3", Upvote: 1, Tags: []string{"go"}, Description: "Edited"}, after)
+
+	// A failed edit changes nothing
+	_, _, err = EditTopic(uid, func(v *Topic) error {
+		v.Description = "Lost"
+		v.Name = "29-2"
+		return nil
+	})
+	assert.Equal(t, ErrTopicExists, err)
+	_, _, err = EditTopic(uid, func(v *Topic) error {
+		v.Description = "Lost"
+		return ErrTopicNotFound
+	})
+	assert.Equal(t, ErrTopicNotFound, err)
+	topic, _ := GetTopic(uid)
+	assert.Equal(t, after, *topic)
+
+	_, _, err = EditTopic(uuid.New(), func(*Topic) error { return nil })
+	assert.Equal(t, ErrTopicNotFound, err)
 }
@@ -0,0 +1,65 @@
+package cache
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/tally"
+)
+
+// LoadFixtures seeds the cache from a JSON array of topics.
+// Topics without uid get a random one, topics with an existing uid are
+// overwritten. It returns the uids in fixture order.
+func LoadFixtures(r io.Reader) ([]uuid.UUID, error) {
+	var topics []Topic
+	if err := json.NewDecoder(r).Decode(&topics); err != nil {
+		return nil, err
+	}
+
+	uids := make([]uuid.UUID, len(topics))
+	for i := range topics {
+		if topics[i].UID == uuid.Nil {
+			uid, err := uuid.NewRandom()
+			if err != nil {
+				return nil, err
+			}
+			topics[i].UID = uid
+		}
+		uids[i] = topics[i].UID
+	}
+
+	ImportTopics(topics, ConflictOverwrite)
+	return uids, nil
+}
+
+// LoadFixtureFile seeds the cache from a JSON fixture file
+func LoadFixtureFile(path string) ([]uuid.UUID, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadFixtures(f)
+}
+
+// Reset removes all topics and boards from the cache
+func Reset() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	topicKV = make(map[uuid.UUID]*Topic)
+	boardKV = make(map[string]*Board)
+	nameKV = make(map[string]uuid.UUID)
+	termKV = make(map[string]map[uuid.UUID]int)
+	sortedTerms = nil
+	reportKV = make(map[uuid.UUID][]Report)
+	voterKV = make(map[string]map[uuid.UUID]bool)
+	pollKV = make(map[uuid.UUID]*Poll)
+	ballotKV = make(map[uuid.UUID][]tally.Ballot)
+	ledgerKV = make(map[string]map[string]map[uuid.UUID]CreditVotes)
+	correctionKV = make(map[uuid.UUID][]CountCorrection)
+}
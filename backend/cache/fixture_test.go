@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadFixtures(t *testing.T) {
+	Reset()
+	assert.Empty(t, ExportTopics(), "The cache should be empty after reset")
+
+	uid := uuid.New()
+	uids, err := LoadFixtures(strings.NewReader(`[
+		{"uid": "` + uid.String() + `", "name": "fixture-1", "upvote": 2, "downvote": 1},
+		{"name": "fixture-2"}
+	]`))
+	assert.Equal(t, nil, err, "Load fixtures failed")
+	assert.Len(t, uids, 2)
+	assert.Equal(t, uid, uids[0])
+	assert.NotEqual(t, uuid.Nil, uids[1])
+
+	topic, exist := GetTopic(uid)
+	assert.Equal(t, true, exist, "The topic should exist")
+	assert.Equal(t, Topic{UID: uid, Name: "fixture-1", Upvote: 2, Downvote: 1}, *topic)
+
+	_, err = LoadFixtures(strings.NewReader(`{"name": "not-an-array"}`))
+	assert.NotNil(t, err, "Load fixtures should failed")
+}
+
+func TestLoadFixtureFile(t *testing.T) {
+	Reset()
+	uids, err := LoadFixtureFile("../../fixtures/topics.json")
+	assert.Equal(t, nil, err, "Load fixture file failed")
+	assert.Len(t, uids, 3)
+
+	topics := GetTopicDescendUpvote()
+	assert.Equal(t, "I'm-Topic-2", topics[0].Name)
+
+	_, err = LoadFixtureFile("not-exist.json")
+	assert.NotNil(t, err, "Load fixture file should failed")
+}
@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MutationType is the kind of change of a topic
+type MutationType string
+
+// Mutation types
+const (
+	// TopicCreated topics are created
+	TopicCreated MutationType = "topic.created"
+	// TopicUpdated topics are overwritten by an import
+	TopicUpdated MutationType = "topic.updated"
+	// TopicVoted topics got votes
+	TopicVoted MutationType = "topic.voted"
+	// TopicCorrected topics got their vote counts corrected
+	TopicCorrected MutationType = "topic.corrected"
+	// TopicDeleted topics are deleted
+	TopicDeleted MutationType = "topic.deleted"
+)
+
+// Mutation is a change of a topic
+type Mutation struct {
+	Type MutationType `json:"type"`
+	UID  uuid.UUID    `json:"uid"`
+	Time time.Time    `json:"time"`
+	// Topic is the topic after a TopicCreated, TopicUpdated or TopicCorrected
+	// mutation
+	Topic *Topic `json:"topic,omitempty"`
+	// Upvote and Downvote are the votes added by a TopicVoted mutation
+	Upvote   uint64 `json:"upvote,omitempty"`
+	Downvote uint64 `json:"downvote,omitempty"`
+}
+
+// mutationRecorder records the mutations, nil records none
+var mutationRecorder func(Mutation)
+
+// SetMutationRecorder sets the function recording the topic mutations, such
+// as an outbox. It is called while the change is made, under the lock, so
+// that no change is missed, and must not block. Concurrent votes may be
+// recorded in any order.
+// It is not safe to call while serving.
+func SetMutationRecorder(f func(Mutation)) {
+	mutationRecorder = f
+}
+
+// recordMutation records a mutation of type typ of v.
+// The caller must hold at least the read lock.
+func recordMutation(typ MutationType, v *Topic, upvote, downvote uint64) {
+	if mutationRecorder == nil {
+		return
+	}
+
+	m := Mutation{Type: typ, UID: v.UID, Time: time.Now().UTC(), Upvote: upvote, Downvote: downvote}
+	if typ == TopicCreated || typ == TopicUpdated || typ == TopicCorrected {
+		t := snapshot(v)
+		m.Topic = &t
+	}
+	mutationRecorder(m)
+}
@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutationRecorder(t *testing.T) {
+	Reset()
+
+	var mutations []Mutation
+	SetMutationRecorder(func(m Mutation) { mutations = append(mutations, m) })
+	defer SetMutationRecorder(nil)
+
+	uid, err := CreateTopic("26-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	assert.Equal(t, nil, IncTopicUpvote(uid))
+	assert.Equal(t, nil, IncTopicVotes(uid, false, 3))
+	assert.Nil(t, AddTopicVotes(uid, 2, 1))
+	up := uint64(10)
+	_, err = SetTopicVotes(uid, &up, nil, "admin", "recount")
+	assert.Nil(t, err)
+	assert.True(t, DeleteTopic(uid))
+
+	types := make([]MutationType, len(mutations))
+	for i, m := range mutations {
+		types[i] = m.Type
+		assert.Equal(t, uid, m.UID)
+	}
+	assert.Equal(t, []MutationType{TopicCreated, TopicVoted, TopicVoted, TopicVoted, TopicCorrected, TopicDeleted}, types)
+	assert.Equal(t, "26-1", mutations[0].Topic.Name)
+	assert.EqualValues(t, 1, mutations[1].Upvote)
+	assert.EqualValues(t, 3, mutations[2].Downvote)
+	assert.EqualValues(t, 2, mutations[3].Upvote)
+	assert.EqualValues(t, 1, mutations[3].Downvote)
+	assert.EqualValues(t, 10, mutations[4].Topic.Upvote)
+	assert.Nil(t, mutations[5].Topic)
+
+	// Deleting a missing topic changes nothing
+	assert.True(t, DeleteTopic(uid))
+	assert.Len(t, mutations, 6)
+
+	// Importing over an existing topic updates it
+	mutations = nil
+	ImportTopics([]Topic{{UID: uid, Name: "26-2"}}, ConflictSkip)
+	ImportTopics([]Topic{{UID: uid, Name: "26-3", Upvote: 4}}, ConflictOverwrite)
+	assert.Len(t, mutations, 2)
+	assert.Equal(t, TopicCreated, mutations[0].Type)
+	assert.Equal(t, TopicUpdated, mutations[1].Type)
+	assert.Equal(t, "26-3", mutations[1].Topic.Name)
+	assert.EqualValues(t, 4, mutations[1].Topic.Upvote)
+}
@@ -0,0 +1,122 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrTopicExists is returned when a topic with the same normalized name
+// already exists in the board
+var ErrTopicExists = errors.New("topic already exists")
+
+// ErrTopicNotFound is returned when a topic does not exist
+var ErrTopicNotFound = errors.New("topic not found")
+
+// SimilarTopic defines a topic and how similar its name is to a query
+type SimilarTopic struct {
+	Topic Topic   `json:"topic"`
+	Score float64 `json:"score"`
+}
+
+// Keeps the unique topic names
+// Key: Board id and normalized Topic name ; Value: Topic id
+var nameKV map[string]uuid.UUID
+
+// NormalizeName returns the form of a topic name used to detect duplicates:
+// Unicode NFC, case folded and with whitespace runs collapsed to one space
+func NormalizeName(name string) string {
+	name = cases.Fold().String(norm.NFC.String(name))
+	return norm.NFC.String(strings.Join(strings.Fields(name), " "))
+}
+
+// nameKey returns the nameKV key of a topic name in a board
+func nameKey(board, name string) string {
+	return board + "\x00" + NormalizeName(name)
+}
+
+// indexName records v as the owner of its name unless the name is taken.
+// The caller must hold the write lock.
+func indexName(v *Topic) {
+	key := nameKey(v.Board, v.Name)
+	if _, ok := nameKV[key]; !ok {
+		nameKV[key] = v.UID
+	}
+}
+
+// unindexName releases the name owned by v.
+// The caller must hold the write lock.
+func unindexName(v *Topic) {
+	key := nameKey(v.Board, v.Name)
+	if nameKV[key] == v.UID {
+		delete(nameKV, key)
+	}
+}
+
+// FindTopicByName gets the Topic of a board whose normalized name equals name's
+func FindTopicByName(board, name string) (*Topic, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if uid, ok := nameKV[nameKey(board, name)]; ok {
+		t := snapshot(topicKV[uid])
+		return &t, true
+	}
+	return nil, false
+}
+
+// trigrams returns the set of 3-rune substrings of the padded normalized name
+func trigrams(name string) map[string]struct{} {
+	runes := []rune("  " + NormalizeName(name) + " ")
+	set := make(map[string]struct{}, len(runes))
+	for i := 0; i+3 <= len(runes); i++ {
+		set[string(runes[i:i+3])] = struct{}{}
+	}
+	return set
+}
+
+// similarity returns the Jaccard index of two trigram sets
+func similarity(a, b map[string]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	var shared int
+	for gram := range a {
+		if _, ok := b[gram]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// GetSimilarTopics gets visible topics matching all filters whose name trigram
+// similarity to name is at least minScore, most similar first
+func GetSimilarTopics(name string, minScore float64, filters ...TopicFilter) []SimilarTopic {
+	query := trigrams(name)
+
+	lock.RLock()
+	topics := filterTopics(visibleOnly(filters))
+	lock.RUnlock()
+
+	similar := []SimilarTopic{}
+	for _, t := range topics {
+		if score := similarity(query, trigrams(t.Name)); score >= minScore {
+			similar = append(similar, SimilarTopic{Topic: t, Score: score})
+		}
+	}
+
+	sort.Slice(similar, func(i, j int) bool {
+		if similar[i].Score != similar[j].Score {
+			return similar[i].Score > similar[j].Score
+		}
+		if similar[i].Topic.Upvote != similar[j].Topic.Upvote {
+			return similar[i].Topic.Upvote > similar[j].Topic.Upvote
+		}
+		return similar[i].Topic.Name < similar[j].Topic.Name
+	})
+	return similar
+}
@@ -0,0 +1,93 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeName(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"Hello World", "hello world"},
+		{"  Hello \t\n World  ", "hello world"},
+		{"Straße", "strasse"},
+		// e + combining acute accent composes to é
+		{"Cafe\u0301", "caf\u00e9"},
+		{"CAF\u00c9", "caf\u00e9"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, NormalizeName(test.name), test.name)
+	}
+}
+
+func TestNewTopicDuplicate(t *testing.T) {
+	uid, err := CreateTopic("12-1 Café")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	existing, err := CreateTopic("  12-1   CAFÉ ")
+	assert.Equal(t, ErrTopicExists, err, "Create topic should failed")
+	assert.Equal(t, uid, existing)
+
+	topic, ok := FindTopicByName("", "12-1 café")
+	assert.Equal(t, true, ok, "The topic should exist")
+	assert.Equal(t, uid, topic.UID)
+
+	// Names are unique per board
+	err = CreateBoard("board-12", "Board 12")
+	assert.Equal(t, nil, err, "Create board failed")
+	_, err = NewTopic(Topic{Name: "12-1 Café", Board: "board-12"})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// The name is released when the topic is deleted
+	DeleteTopic(uid)
+	_, err = CreateTopic("12-1 café")
+	assert.Equal(t, nil, err, "Create topic failed")
+}
+
+func TestRenameTopic(t *testing.T) {
+	uid, err := CreateTopic("11-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, err = CreateTopic("11-2")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	err = RenameTopic(uid, "11-1-renamed")
+	assert.Equal(t, nil, err, "Rename topic failed")
+	assert.Equal(t, "11-1-renamed", GetTopicName(uid))
+
+	// Changing only the case of its own name is allowed
+	err = RenameTopic(uid, "11-1-RENAMED")
+	assert.Equal(t, nil, err, "Rename topic failed")
+
+	err = RenameTopic(uid, "11-2")
+	assert.Equal(t, ErrTopicExists, err, "Rename topic should failed")
+
+	// The old name is released
+	_, err = CreateTopic("11-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+}
+
+func TestGetSimilarTopics(t *testing.T) {
+	Reset()
+
+	_, err := CreateTopic("Migrate CI to GitHub Actions")
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, err = CreateTopic("Migrate the CI pipeline")
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, err = CreateTopic("Team lunch on Friday")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	similar := GetSimilarTopics("migrate ci to github action", 0.3)
+	assert.Len(t, similar, 1)
+	assert.Equal(t, "Migrate CI to GitHub Actions", similar[0].Topic.Name)
+	assert.True(t, similar[0].Score > 0.8)
+
+	similar = GetSimilarTopics("migrate ci", 0.2)
+	assert.Len(t, similar, 2)
+	assert.Equal(t, "Migrate the CI pipeline", similar[0].Topic.Name)
+
+	assert.Empty(t, GetSimilarTopics("migrate ci", 0.2, InBoard("other")))
+}
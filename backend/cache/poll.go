@@ -0,0 +1,296 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/tally"
+)
+
+// PollMode defines how many options a voter picks
+type PollMode string
+
+const (
+	// PollSingle voters pick exactly one option
+	PollSingle PollMode = "single"
+	// PollMulti voters pick one or more options, up to MaxChoices
+	PollMulti PollMode = "multi"
+	// PollRanked voters rank one or more options, up to MaxChoices
+	PollRanked PollMode = "ranked"
+)
+
+// ParsePollMode parses the poll mode name, empty means single-choice
+func ParsePollMode(s string) (PollMode, error) {
+	switch PollMode(strings.ToLower(s)) {
+	case "", PollSingle:
+		return PollSingle, nil
+	case PollMulti:
+		return PollMulti, nil
+	case PollRanked:
+		return PollRanked, nil
+	}
+	return "", fmt.Errorf("unknown poll mode %q", s)
+}
+
+var (
+	// ErrPollNotFound is returned when a poll does not exist
+	ErrPollNotFound = errors.New("poll not found")
+	// ErrInvalidChoice is returned when a vote picks unknown, duplicate or
+	// too many options
+	ErrInvalidChoice = errors.New("invalid poll choice")
+)
+
+// PollOption is an option of a poll with its vote count, the first
+// preferences of a ranked poll
+type PollOption struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Votes uint64 `json:"votes"`
+}
+
+// Poll defines a vote between several options
+type Poll struct {
+	UID  uuid.UUID `json:"uid"`
+	Name string    `json:"name"`
+	Mode PollMode  `json:"mode"`
+	// Method tallies the ballots, approval unless the poll is ranked
+	Method tally.Method `json:"method"`
+	// MaxChoices limits the options of a multi-choice or ranked vote, 0 allows all
+	MaxChoices int          `json:"maxChoices,omitempty"`
+	Options    []PollOption `json:"options"`
+	// Voters counts the votes cast, an option count is at most Voters
+	Voters uint64 `json:"voters"`
+
+	CreatedBy  string `json:"createdBy,omitempty"`
+	Restricted bool   `json:"restricted,omitempty"`
+
+	OpensAt  *time.Time `json:"opensAt,omitempty"`
+	ClosesAt *time.Time `json:"closesAt,omitempty"`
+}
+
+// Keeps the polls in-memory data cache, guarded by lock like topicKV
+// Key: Poll id ; Value: Poll
+var pollKV map[uuid.UUID]*Poll
+
+// Keeps the ballots cast on polls, guarded by lock
+// Key: Poll id ; Value: ballots in casting order
+var ballotKV map[uuid.UUID][]tally.Ballot
+
+// CheckOpen returns ErrPollNotOpen or ErrPollClosed when the poll is not
+// open for voting at now
+func (p *Poll) CheckOpen(now time.Time) error {
+	return checkOpen(p.OpensAt, p.ClosesAt, now)
+}
+
+// snapshotPoll returns a copy of v that is safe to use without holding
+// the lock. The caller must hold at least the read lock.
+func snapshotPoll(v *Poll) Poll {
+	p := *v
+	p.Voters = atomic.LoadUint64(&v.Voters)
+	p.Options = make([]PollOption, len(v.Options))
+	for i := range v.Options {
+		p.Options[i] = PollOption{ID: v.Options[i].ID, Name: v.Options[i].Name, Votes: atomic.LoadUint64(&v.Options[i].Votes)}
+	}
+	return p
+}
+
+// NewPoll creates a poll with the options names of p, numbered from 0
+func NewPoll(p Poll) (uuid.UUID, error) {
+	uid, err := uuid.NewRandom()
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	mode, err := ParsePollMode(string(p.Mode))
+	if err != nil {
+		return uuid.Nil, err
+	}
+	method, err := pollMethod(mode, p.Method)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if len(p.Options) < 2 {
+		return uuid.Nil, errors.New("poll has less than 2 options")
+	}
+	if p.MaxChoices < 0 || p.MaxChoices > len(p.Options) || (mode == PollSingle && p.MaxChoices > 1) {
+		return uuid.Nil, errors.New("poll max choices out of range")
+	}
+	if err := CheckWindow(p.OpensAt, p.ClosesAt); err != nil {
+		return uuid.Nil, err
+	}
+
+	v := &Poll{
+		UID:        uid,
+		Name:       p.Name,
+		Mode:       mode,
+		Method:     method,
+		MaxChoices: p.MaxChoices,
+		Options:    make([]PollOption, len(p.Options)),
+		CreatedBy:  p.CreatedBy,
+		Restricted: p.Restricted,
+		OpensAt:    utcTime(p.OpensAt),
+		ClosesAt:   utcTime(p.ClosesAt),
+	}
+	for i, o := range p.Options {
+		v.Options[i] = PollOption{ID: i, Name: o.Name}
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	pollKV[uid] = v
+	return uid, nil
+}
+
+// GetPoll get Poll accords uuid
+func GetPoll(uid uuid.UUID) (*Poll, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if v, ok := pollKV[uid]; ok {
+		p := snapshotPoll(v)
+		return &p, true
+	}
+	return nil, false
+}
+
+// pollMethod returns the tally method of a poll mode, ranked polls are
+// tallied by instant-runoff unless told otherwise
+func pollMethod(mode PollMode, method tally.Method) (tally.Method, error) {
+	if mode != PollRanked {
+		if method != "" && method != tally.Approval {
+			return "", fmt.Errorf("%v poll can not be tallied by %v", mode, method)
+		}
+		return tally.Approval, nil
+	}
+
+	if method == "" {
+		return tally.IRV, nil
+	}
+	if !method.Ranked() {
+		return "", fmt.Errorf("ranked poll can not be tallied by %v", method)
+	}
+	return method, nil
+}
+
+// DeletePoll deletes Poll accords uuid
+func DeletePoll(uid uuid.UUID) bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	delete(pollKV, uid)
+	delete(ballotKV, uid)
+	return true
+}
+
+// VotePoll counts a vote for the chosen option ids. A single-choice vote
+// picks one option, a multi-choice vote picks up to MaxChoices distinct
+// options and a ranked vote lists up to MaxChoices distinct options, the
+// most preferred first. It returns ErrPollNotFound, ErrInvalidChoice, or
+// ErrPollNotOpen and ErrPollClosed outside of the voting window.
+func VotePoll(uid uuid.UUID, choices []int) error {
+	// The ballot is appended, so it needs the write lock
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := pollKV[uid]
+	if !ok {
+		return ErrPollNotFound
+	}
+	if err := v.CheckOpen(time.Now()); err != nil {
+		return err
+	}
+	if err := v.CheckChoices(choices); err != nil {
+		return err
+	}
+
+	counted := choices
+	if v.Mode == PollRanked {
+		counted = choices[:1]
+	}
+	for _, id := range counted {
+		atomic.AddUint64(&v.Options[id].Votes, 1)
+	}
+	atomic.AddUint64(&v.Voters, 1)
+	ballotKV[uid] = append(ballotKV[uid], append(tally.Ballot(nil), choices...))
+	return nil
+}
+
+// GetPollBallots gets the ballots cast on a poll
+func GetPollBallots(uid uuid.UUID) ([]tally.Ballot, bool) {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	if _, ok := pollKV[uid]; !ok {
+		return nil, false
+	}
+	return append([]tally.Ballot(nil), ballotKV[uid]...), true
+}
+
+// CheckChoices returns ErrInvalidChoice unless the choices make a valid vote
+func (p *Poll) CheckChoices(choices []int) error {
+	max := p.MaxChoices
+	if p.Mode == PollSingle {
+		max = 1
+	} else if max == 0 {
+		max = len(p.Options)
+	}
+	if len(choices) == 0 || len(choices) > max {
+		return ErrInvalidChoice
+	}
+
+	seen := make(map[int]bool, len(choices))
+	for _, id := range choices {
+		if id < 0 || id >= len(p.Options) || seen[id] {
+			return ErrInvalidChoice
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// PollOptionList defines the PollOption array with votes
+type PollOptionList []PollOption
+
+func (l PollOptionList) Len() int      { return len(l) }
+func (l PollOptionList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l PollOptionList) Less(i, j int) bool {
+	if l[i].Votes != l[j].Votes {
+		return l[i].Votes < l[j].Votes
+	}
+	// Ties keep the option order once reversed
+	return l[i].ID > l[j].ID
+}
+
+// Ranking returns the options with desceding votes order
+func (p *Poll) Ranking() PollOptionList {
+	list := append(PollOptionList(nil), p.Options...)
+	sort.Sort(sort.Reverse(list))
+	return list
+}
+
+// PollListVoters defines the Poll array with voters
+type PollListVoters []Poll
+
+func (l PollListVoters) Len() int           { return len(l) }
+func (l PollListVoters) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l PollListVoters) Less(i, j int) bool { return l[i].Voters < l[j].Voters }
+
+// GetPollDescendVoters gets polls with desceding voters order
+func GetPollDescendVoters() PollListVoters {
+	lock.RLock()
+	list := make(PollListVoters, 0, len(pollKV))
+	for _, v := range pollKV {
+		list = append(list, snapshotPoll(v))
+	}
+	lock.RUnlock()
+
+	sort.Sort(sort.Reverse(list))
+	return list
+}
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jenting/voting-topic/backend/tally"
+)
+
+func options(names ...string) []PollOption {
+	o := make([]PollOption, len(names))
+	for i, name := range names {
+		o[i].Name = name
+	}
+	return o
+}
+
+func TestNewPoll(t *testing.T) {
+	_, err := NewPoll(Poll{Name: "16-1", Options: options("a")})
+	assert.NotEqual(t, nil, err, "Poll with one option should failed")
+
+	_, err = NewPoll(Poll{Name: "16-2", Mode: "weighted", Options: options("a", "b")})
+	assert.NotEqual(t, nil, err, "Poll with unknown mode should failed")
+
+	_, err = NewPoll(Poll{Name: "16-3", MaxChoices: 2, Options: options("a", "b")})
+	assert.NotEqual(t, nil, err, "Single-choice poll with max choices should failed")
+
+	uid, err := NewPoll(Poll{Name: "16-4", Options: []PollOption{{ID: 7, Name: "a", Votes: 3}, {Name: "b"}}})
+	assert.Equal(t, nil, err, "Create poll failed")
+
+	poll, ok := GetPoll(uid)
+	assert.Equal(t, true, ok, "The poll should exist")
+	assert.Equal(t, PollSingle, poll.Mode)
+	assert.Equal(t, []PollOption{{ID: 0, Name: "a"}, {ID: 1, Name: "b"}}, poll.Options)
+
+	assert.Equal(t, true, DeletePoll(uid), "Delete poll failed")
+	_, ok = GetPoll(uid)
+	assert.Equal(t, false, ok, "The poll should not exist")
+}
+
+func TestVotePoll(t *testing.T) {
+	single, err := NewPoll(Poll{Name: "17-1", Options: options("a", "b", "c")})
+	assert.Equal(t, nil, err, "Create poll failed")
+	multi, err := NewPoll(Poll{Name: "17-2", Mode: PollMulti, MaxChoices: 2, Options: options("a", "b", "c")})
+	assert.Equal(t, nil, err, "Create poll failed")
+
+	assert.Equal(t, ErrInvalidChoice, VotePoll(single, nil))
+	assert.Equal(t, ErrInvalidChoice, VotePoll(single, []int{0, 1}))
+	assert.Equal(t, ErrInvalidChoice, VotePoll(single, []int{3}))
+	assert.Equal(t, ErrInvalidChoice, VotePoll(multi, []int{1, 1}))
+	assert.Equal(t, ErrInvalidChoice, VotePoll(multi, []int{0, 1, 2}))
+	assert.Equal(t, ErrPollNotFound, VotePoll(uuid.New(), []int{0}))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, nil, VotePoll(single, []int{1}), "Vote poll failed")
+			assert.Equal(t, nil, VotePoll(multi, []int{0, 2}), "Vote poll failed")
+		}()
+	}
+	wg.Wait()
+
+	poll, _ := GetPoll(single)
+	assert.EqualValues(t, 100, poll.Voters)
+	assert.Equal(t, []PollOption{{0, "a", 0}, {1, "b", 100}, {2, "c", 0}}, poll.Options)
+
+	poll, _ = GetPoll(multi)
+	assert.EqualValues(t, 100, poll.Voters)
+	assert.Equal(t, []PollOption{{0, "a", 100}, {1, "b", 0}, {2, "c", 100}}, poll.Options)
+
+	// Ties keep the option order
+	assert.Equal(t, PollOptionList{{0, "a", 100}, {2, "c", 100}, {1, "b", 0}}, poll.Ranking())
+}
+
+func TestVotePollWindow(t *testing.T) {
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	_, err := NewPoll(Poll{Name: "18-1", Options: options("a", "b"), OpensAt: &future, ClosesAt: &past})
+	assert.Equal(t, ErrInvalidWindow, err, "Poll with invalid window should failed")
+
+	notOpen, err := NewPoll(Poll{Name: "18-2", Options: options("a", "b"), OpensAt: &future})
+	assert.Equal(t, nil, err, "Create poll failed")
+	closed, err := NewPoll(Poll{Name: "18-3", Options: options("a", "b"), ClosesAt: &past})
+	assert.Equal(t, nil, err, "Create poll failed")
+
+	assert.Equal(t, ErrPollNotOpen, VotePoll(notOpen, []int{0}))
+	assert.Equal(t, ErrPollClosed, VotePoll(closed, []int{0}))
+}
+
+func TestGetPollDescendVoters(t *testing.T) {
+	Reset()
+	uids := make([]uuid.UUID, 0, 3)
+	for i, votes := range []int{2, 5, 1} {
+		uid, err := NewPoll(Poll{Name: string(rune('a' + i)), Options: options("a", "b")})
+		assert.Equal(t, nil, err, "Create poll failed")
+		for j := 0; j < votes; j++ {
+			assert.Equal(t, nil, VotePoll(uid, []int{0}))
+		}
+		uids = append(uids, uid)
+	}
+
+	polls := GetPollDescendVoters()
+	assert.Len(t, polls, 3)
+	assert.Equal(t, uids[1], polls[0].UID)
+	assert.Equal(t, uids[0], polls[1].UID)
+	assert.Equal(t, uids[2], polls[2].UID)
+}
+
+func TestVoteRankedPoll(t *testing.T) {
+	_, err := NewPoll(Poll{Name: "19-1", Mode: PollRanked, Method: tally.Approval, Options: options("a", "b")})
+	assert.NotEqual(t, nil, err, "Ranked poll tallied by approval should failed")
+	_, err = NewPoll(Poll{Name: "19-2", Mode: PollMulti, Method: tally.Borda, Options: options("a", "b")})
+	assert.NotEqual(t, nil, err, "Multi-choice poll tallied by Borda should failed")
+
+	uid, err := NewPoll(Poll{Name: "19-3", Mode: PollRanked, Options: options("a", "b", "c")})
+	assert.Equal(t, nil, err, "Create poll failed")
+
+	poll, _ := GetPoll(uid)
+	assert.Equal(t, tally.IRV, poll.Method)
+
+	assert.Equal(t, ErrInvalidChoice, VotePoll(uid, []int{2, 2}))
+	assert.Equal(t, nil, VotePoll(uid, []int{2, 0, 1}))
+	assert.Equal(t, nil, VotePoll(uid, []int{0}))
+
+	// Options count the first preferences
+	poll, _ = GetPoll(uid)
+	assert.Equal(t, []PollOption{{0, "a", 1}, {1, "b", 0}, {2, "c", 1}}, poll.Options)
+
+	ballots, ok := GetPollBallots(uid)
+	assert.Equal(t, true, ok)
+	assert.Equal(t, []tally.Ballot{{2, 0, 1}, {0}}, ballots)
+
+	DeletePoll(uid)
+	_, ok = GetPollBallots(uid)
+	assert.Equal(t, false, ok)
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrAlreadyReported is returned when a reporter reports a topic twice
+var ErrAlreadyReported = errors.New("topic already reported")
+
+// Report is a viewer's flag of an abusive topic
+type Report struct {
+	// Reporter identifies the viewer, such as a voter id or client IP
+	Reporter  string    `json:"-"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// TopicReports is a reported topic with its reports, oldest first
+type TopicReports struct {
+	Topic   Topic    `json:"topic"`
+	Reports []Report `json:"reports"`
+}
+
+// reportKV maps topic UID to the reports of the topic
+var reportKV map[uuid.UUID][]Report
+
+// ReportTopic adds a report of reporter to a visible topic, each reporter
+// reports a topic once. Once the topic has threshold reports it is hidden,
+// waiting for a moderator's review. A threshold below 1 never hides the
+// topic. It returns the number of reports and whether this report hid the
+// topic, or ErrTopicNotFound and ErrAlreadyReported.
+func ReportTopic(uid uuid.UUID, reporter, reason string, threshold int) (int, bool, error) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok || v.State != StateVisible {
+		return 0, false, ErrTopicNotFound
+	}
+	for _, r := range reportKV[uid] {
+		if r.Reporter == reporter {
+			return len(reportKV[uid]), false, ErrAlreadyReported
+		}
+	}
+
+	reports := append(reportKV[uid], Report{Reporter: reporter, Reason: reason, CreatedAt: time.Now().UTC()})
+	reportKV[uid] = reports
+
+	hidden := threshold > 0 && len(reports) >= threshold
+	if hidden {
+		v.State = StateHidden
+	}
+	return len(reports), hidden, nil
+}
+
+// GetTopicReports gets the reports of a topic, oldest first
+func GetTopicReports(uid uuid.UUID) []Report {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	return append([]Report(nil), reportKV[uid]...)
+}
+
+// ClearTopicReports drops the reports of a topic once it has been reviewed
+func ClearTopicReports(uid uuid.UUID) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	delete(reportKV, uid)
+}
+
+// ListTopicReports gets the reported topics matching all filters, whatever
+// their state, the most reported first
+func ListTopicReports(filters ...TopicFilter) []TopicReports {
+	lock.RLock()
+	list := make([]TopicReports, 0, len(reportKV))
+next:
+	for uid, reports := range reportKV {
+		v, ok := topicKV[uid]
+		if !ok {
+			continue
+		}
+		t := snapshot(v)
+		for _, filter := range filters {
+			if !filter(&t) {
+				continue next
+			}
+		}
+		list = append(list, TopicReports{Topic: t, Reports: append([]Report(nil), reports...)})
+	}
+	lock.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if len(list[i].Reports) != len(list[j].Reports) {
+			return len(list[i].Reports) > len(list[j].Reports)
+		}
+		return list[i].Topic.UID.String() < list[j].Topic.UID.String()
+	})
+	return list
+}
@@ -0,0 +1,79 @@
+package cache
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportTopic(t *testing.T) {
+	Reset()
+
+	uid1, err := CreateTopic("14-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid2, err := CreateTopic("14-2")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	n, hidden, err := ReportTopic(uid2, "ip:10.0.0.1", "spam", 2)
+	assert.Equal(t, nil, err, "Report topic failed")
+	assert.Equal(t, 1, n)
+	assert.False(t, hidden)
+
+	// A reporter counts once
+	n, hidden, err = ReportTopic(uid2, "ip:10.0.0.1", "spam", 2)
+	assert.Equal(t, ErrAlreadyReported, err)
+	assert.Equal(t, 1, n)
+	assert.False(t, hidden)
+
+	for i, reason := range []string{"abusive", "spam"} {
+		n, hidden, err = ReportTopic(uid1, fmt.Sprintf("voter-%d", i), reason, 2)
+		assert.Equal(t, nil, err, "Report topic failed")
+		assert.Equal(t, i+1, n)
+		assert.Equal(t, i == 1, hidden)
+	}
+
+	// The hidden topic leaves the rankings and cannot be reported again
+	topic, _ := GetTopic(uid1)
+	assert.Equal(t, StateHidden, topic.State)
+	assert.Len(t, GetTopicDescendUpvote(), 1)
+	_, _, err = ReportTopic(uid1, "voter-2", "spam", 2)
+	assert.Equal(t, ErrTopicNotFound, err)
+
+	reports := GetTopicReports(uid1)
+	assert.Len(t, reports, 2)
+	assert.Equal(t, "abusive", reports[0].Reason)
+	assert.False(t, reports[0].CreatedAt.IsZero())
+
+	list := ListTopicReports()
+	assert.Len(t, list, 2)
+	assert.Equal(t, uid1, list[0].Topic.UID)
+	assert.Equal(t, uid2, list[1].Topic.UID)
+	assert.Len(t, ListTopicReports(InState(StateHidden)), 1)
+
+	ClearTopicReports(uid1)
+	assert.Empty(t, GetTopicReports(uid1))
+
+	// Deleted topics drop their reports
+	DeleteTopic(uid2)
+	assert.Empty(t, ListTopicReports())
+
+	_, _, err = ReportTopic(uuid.New(), "voter-0", "spam", 2)
+	assert.Equal(t, ErrTopicNotFound, err)
+}
+
+func TestReportTopicNoThreshold(t *testing.T) {
+	Reset()
+
+	uid, err := CreateTopic("14-3")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	for i := 0; i < 3; i++ {
+		_, hidden, err := ReportTopic(uid, fmt.Sprintf("voter-%d", i), "spam", 0)
+		assert.Equal(t, nil, err, "Report topic failed")
+		assert.False(t, hidden)
+	}
+	topic, _ := GetTopic(uid)
+	assert.Equal(t, StateVisible, topic.State)
+}
@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/google/uuid"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Weights of a term by the topic field it was found in
+const (
+	nameTermWeight        = 3
+	tagTermWeight         = 2
+	descriptionTermWeight = 1
+)
+
+// Relevance of a query token matching a term by prefix only
+const prefixMatchFactor = 0.5
+
+// SearchResult defines a topic found by a search and its ranking score
+type SearchResult struct {
+	Topic Topic   `json:"topic"`
+	Score float64 `json:"score"`
+}
+
+// Keeps the inverted index of topic texts
+// Key: term ; Value: weight of the term per Topic id
+var termKV map[string]map[uuid.UUID]int
+
+// Keeps the terms of termKV in order, so that the terms starting with a
+// prefix are found by binary search
+var sortedTerms []string
+
+// Tokenize splits text into Unicode NFC, case folded words of letters and digits
+func Tokenize(text string) []string {
+	text = cases.Fold().String(norm.NFC.String(text))
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+}
+
+// topicTerms returns the weighted terms of a topic's name, tags and description
+func topicTerms(v *Topic) map[string]int {
+	terms := make(map[string]int)
+	for _, term := range Tokenize(v.Name) {
+		terms[term] += nameTermWeight
+	}
+	for _, tag := range v.Tags {
+		for _, term := range Tokenize(tag) {
+			terms[term] += tagTermWeight
+		}
+	}
+	for _, term := range Tokenize(v.Description) {
+		terms[term] += descriptionTermWeight
+	}
+	return terms
+}
+
+// indexTerms adds the terms of v to the inverted index.
+// The caller must hold the write lock.
+func indexTerms(v *Topic) {
+	for term, weight := range topicTerms(v) {
+		postings, ok := termKV[term]
+		if !ok {
+			postings = make(map[uuid.UUID]int)
+			termKV[term] = postings
+
+			i := sort.SearchStrings(sortedTerms, term)
+			sortedTerms = append(sortedTerms, "")
+			copy(sortedTerms[i+1:], sortedTerms[i:])
+			sortedTerms[i] = term
+		}
+		postings[v.UID] = weight
+	}
+}
+
+// unindexTerms removes the terms of v from the inverted index.
+// The caller must hold the write lock.
+func unindexTerms(v *Topic) {
+	for term := range topicTerms(v) {
+		delete(termKV[term], v.UID)
+		if len(termKV[term]) == 0 {
+			delete(termKV, term)
+
+			i := sort.SearchStrings(sortedTerms, term)
+			sortedTerms = append(sortedTerms[:i], sortedTerms[i+1:]...)
+		}
+	}
+}
+
+// matchToken returns the relevance of each topic matching a query token,
+// exactly or by prefix, weighted by the inverse document frequency.
+// The caller must hold at least the read lock.
+func matchToken(token string) map[uuid.UUID]float64 {
+	scores := make(map[uuid.UUID]float64)
+	// The terms starting with the token follow it in order
+	for i := sort.SearchStrings(sortedTerms, token); i < len(sortedTerms) && strings.HasPrefix(sortedTerms[i], token); i++ {
+		term, postings := sortedTerms[i], termKV[sortedTerms[i]]
+		factor := 1.0
+		if term != token {
+			factor = prefixMatchFactor
+		}
+
+		idf := math.Log(1 + float64(len(topicKV))/float64(len(postings)))
+		for uid, weight := range postings {
+			// Keep the best matching term of the token
+			if score := factor * float64(weight) * idf; score > scores[uid] {
+				scores[uid] = score
+			}
+		}
+	}
+	return scores
+}
+
+// SearchTopics gets the visible topics matching all filters and every word of query,
+// exactly or by prefix. Results are ranked by text relevance boosted by the
+// topic's net votes.
+func SearchTopics(query string, filters ...TopicFilter) []SearchResult {
+	filters = visibleOnly(filters)
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return []SearchResult{}
+	}
+
+	lock.RLock()
+	var relevance map[uuid.UUID]float64
+	for i, token := range tokens {
+		scores := matchToken(token)
+		if i == 0 {
+			relevance = scores
+			continue
+		}
+		// Every token must match
+		for uid := range relevance {
+			if score, ok := scores[uid]; ok {
+				relevance[uid] += score
+			} else {
+				delete(relevance, uid)
+			}
+		}
+	}
+
+	results := make([]SearchResult, 0, len(relevance))
+next:
+	for uid, score := range relevance {
+		t := snapshot(topicKV[uid])
+		for _, filter := range filters {
+			if !filter(&t) {
+				continue next
+			}
+		}
+		results = append(results, SearchResult{Topic: t, Score: score * voteBoost(t)})
+	}
+	lock.RUnlock()
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Topic.UID.String() < results[j].Topic.UID.String()
+	})
+	return results
+}
+
+// voteBoost returns the factor by which a topic's net votes raise its relevance
+func voteBoost(t Topic) float64 {
+	if t.Upvote <= t.Downvote {
+		return 1
+	}
+	return 1 + 0.1*math.Log1p(float64(t.Upvote-t.Downvote))
+}
@@ -0,0 +1,89 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func searchUIDs(results []SearchResult) []uuid.UUID {
+	uids := make([]uuid.UUID, len(results))
+	for i, r := range results {
+		uids[i] = r.Topic.UID
+	}
+	return uids
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"hello", "wörld", "42", "go"}, Tokenize("Hello, WÖRLD! 42 (go)"))
+	assert.Empty(t, Tokenize(" !? "))
+}
+
+func TestSearchTopics(t *testing.T) {
+	Reset()
+
+	uid1, err := NewTopic(Topic{Name: "Kubernetes upgrade", Tags: []string{"infra"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid2, err := NewTopic(Topic{Name: "Team offsite", Description: "Talk about the kubernetes migration"})
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid3, err := NewTopic(Topic{Name: "Kube dashboards"})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// Name matches rank above description matches
+	assert.Equal(t, []uuid.UUID{uid1, uid2}, searchUIDs(SearchTopics("kubernetes")))
+
+	// Exact matches rank above prefix matches
+	assert.Equal(t, []uuid.UUID{uid3, uid1, uid2}, searchUIDs(SearchTopics("kube")))
+
+	// Every word must match
+	assert.Equal(t, []uuid.UUID{uid1}, searchUIDs(SearchTopics("kube infra")))
+	assert.Empty(t, SearchTopics("kube lunch"))
+	assert.Empty(t, SearchTopics("!!"))
+	assert.Empty(t, SearchTopics("kubez"))
+	assert.Equal(t, []string{"about", "dashboards", "infra", "kube", "kubernetes", "migration", "offsite", "talk", "team", "the", "upgrade"}, sortedTerms)
+
+	// Filters apply
+	assert.Equal(t, []uuid.UUID{uid1}, searchUIDs(SearchTopics("kube", WithTags("infra"))))
+}
+
+func TestSearchTopicsVotes(t *testing.T) {
+	Reset()
+
+	uid1, err := CreateTopic("Release notes v1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid2, err := CreateTopic("Release notes v2")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	IncTopicUpvote(uid2)
+	IncTopicUpvote(uid2)
+	assert.Equal(t, []uuid.UUID{uid2, uid1}, searchUIDs(SearchTopics("release notes")))
+}
+
+func TestSearchIndexMaintained(t *testing.T) {
+	Reset()
+
+	uid, err := CreateTopic("Observability roadmap")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	err = RenameTopic(uid, "Tracing roadmap")
+	assert.Equal(t, nil, err, "Rename topic failed")
+	assert.Empty(t, SearchTopics("observability"))
+	assert.Len(t, SearchTopics("tracing"), 1)
+
+	SetTopicTags(uid, []string{"otel"})
+	assert.Len(t, SearchTopics("otel"), 1)
+
+	SetTopicDetails(uid, "Adopt OpenTelemetry", "")
+	assert.Len(t, SearchTopics("opentelemetry"), 1)
+
+	ImportTopics([]Topic{{UID: uid, Name: "Logging roadmap"}}, ConflictOverwrite)
+	assert.Empty(t, SearchTopics("tracing"))
+	assert.Empty(t, SearchTopics("otel"))
+	assert.Len(t, SearchTopics("logging"), 1)
+
+	DeleteTopic(uid)
+	assert.Empty(t, SearchTopics("roadmap"))
+	assert.Empty(t, termKV)
+	assert.Empty(t, sortedTerms)
+}
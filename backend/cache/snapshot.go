@@ -0,0 +1,367 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SnapshotFormat defines the encoding of a topics dump
+type SnapshotFormat string
+
+const (
+	// FormatNDJSON encodes one JSON topic per line
+	FormatNDJSON SnapshotFormat = "ndjson"
+	// FormatCSV encodes one topic per row with a header row
+	FormatCSV SnapshotFormat = "csv"
+)
+
+// ParseSnapshotFormat parses the snapshot format name, empty means NDJSON
+func ParseSnapshotFormat(s string) (SnapshotFormat, error) {
+	switch SnapshotFormat(strings.ToLower(s)) {
+	case "", FormatNDJSON:
+		return FormatNDJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	}
+	return "", fmt.Errorf("unknown snapshot format %q", s)
+}
+
+// ConflictMode defines how an imported topic is applied when its UID already exists
+type ConflictMode string
+
+const (
+	// ConflictSkip keeps the existing topic untouched
+	ConflictSkip ConflictMode = "skip"
+	// ConflictOverwrite replaces the existing topic with the imported one
+	ConflictOverwrite ConflictMode = "overwrite"
+	// ConflictMerge adds the imported vote counts to the existing topic,
+	// a topic whose counts would overflow is left untouched
+	ConflictMerge ConflictMode = "merge"
+)
+
+// ParseConflictMode parses the conflict mode name, empty means skip
+func ParseConflictMode(s string) (ConflictMode, error) {
+	switch ConflictMode(strings.ToLower(s)) {
+	case "", ConflictSkip:
+		return ConflictSkip, nil
+	case ConflictOverwrite:
+		return ConflictOverwrite, nil
+	case ConflictMerge:
+		return ConflictMerge, nil
+	}
+	return "", fmt.Errorf("unknown conflict mode %q", s)
+}
+
+// ImportResult counts what happened to each imported topic
+type ImportResult struct {
+	Created     int `json:"created"`
+	Skipped     int `json:"skipped"`
+	Overwritten int `json:"overwritten"`
+	Merged      int `json:"merged"`
+	OutOfRange  int `json:"outOfRange"`
+}
+
+// csvHeader is the column order written by WriteSnapshot
+var csvHeader = []string{"uid", "name", "upvote", "downvote", "board", "tags", "description", "url", "author", "state", "createdBy", "restricted", "opensAt", "closesAt"}
+
+// csvRequired are the columns a CSV dump must have, the others are optional
+var csvRequired = []string{"uid", "name", "upvote", "downvote"}
+
+// ExportTopics returns a copy of all topics ordered by UID
+func ExportTopics() []Topic {
+	lock.RLock()
+	topics := make([]Topic, 0, len(topicKV))
+	for _, v := range topicKV {
+		topics = append(topics, snapshot(v))
+	}
+	lock.RUnlock()
+
+	sortByUID(topics)
+	return topics
+}
+
+// sortByUID sorts topics by UID
+func sortByUID(topics []Topic) {
+	sort.Slice(topics, func(i, j int) bool {
+		return topics[i].UID.String() < topics[j].UID.String()
+	})
+}
+
+// WriteSnapshot encodes topics to w in the given format
+func WriteSnapshot(w io.Writer, format SnapshotFormat, topics []Topic) error {
+	switch format {
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for i := range topics {
+			if err := enc.Encode(&topics[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+		for _, t := range topics {
+			record := []string{
+				t.UID.String(),
+				t.Name,
+				strconv.FormatUint(t.Upvote, 10),
+				strconv.FormatUint(t.Downvote, 10),
+				t.Board,
+				strings.Join(t.Tags, " "),
+				t.Description,
+				t.URL,
+				t.Author,
+				string(t.State),
+				t.CreatedBy,
+				strconv.FormatBool(t.Restricted),
+				formatTime(t.OpensAt),
+				formatTime(t.ClosesAt),
+			}
+			if err := cw.Write(record); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	return fmt.Errorf("unknown snapshot format %q", format)
+}
+
+// ReadSnapshot decodes topics from r in the given format.
+// Errors report the 1-based line (NDJSON) or row (CSV) of the bad record.
+func ReadSnapshot(r io.Reader, format SnapshotFormat) ([]Topic, error) {
+	switch format {
+	case FormatNDJSON:
+		return readNDJSON(r)
+	case FormatCSV:
+		return readCSV(r)
+	}
+	return nil, fmt.Errorf("unknown snapshot format %q", format)
+}
+
+func readNDJSON(r io.Reader) ([]Topic, error) {
+	var topics []Topic
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var line int
+	for scanner.Scan() {
+		line++
+		b := scanner.Bytes()
+		if len(strings.TrimSpace(string(b))) == 0 {
+			continue
+		}
+
+		var t Topic
+		if err := json.Unmarshal(b, &t); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		topics = append(topics, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return topics, nil
+}
+
+func readCSV(r io.Reader) ([]Topic, error) {
+	cr := csv.NewReader(r)
+
+	header, err := cr.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("row 1: %v", err)
+	}
+
+	// Map column name to index, so columns may come in any order
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range csvRequired {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("row 1: missing column %q", name)
+		}
+	}
+
+	var topics []Topic
+	row := 1
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		row++
+		if err != nil {
+			return nil, fmt.Errorf("row %d: %v", row, err)
+		}
+
+		var t Topic
+		if t.UID, err = uuid.Parse(record[columns["uid"]]); err != nil {
+			return nil, fmt.Errorf("row %d: invalid uid: %v", row, err)
+		}
+		t.Name = record[columns["name"]]
+		if t.Upvote, err = strconv.ParseUint(record[columns["upvote"]], 10, 64); err != nil {
+			return nil, fmt.Errorf("row %d: invalid upvote: %v", row, err)
+		}
+		if t.Downvote, err = strconv.ParseUint(record[columns["downvote"]], 10, 64); err != nil {
+			return nil, fmt.Errorf("row %d: invalid downvote: %v", row, err)
+		}
+		if i, ok := columns["board"]; ok {
+			t.Board = record[i]
+		}
+		if i, ok := columns["tags"]; ok && strings.TrimSpace(record[i]) != "" {
+			t.Tags = strings.Fields(record[i])
+		}
+		if i, ok := columns["description"]; ok {
+			t.Description = record[i]
+		}
+		if i, ok := columns["url"]; ok {
+			t.URL = record[i]
+		}
+		if i, ok := columns["author"]; ok {
+			t.Author = record[i]
+		}
+		if i, ok := columns["state"]; ok {
+			if t.State, err = ParseTopicState(record[i]); err != nil {
+				return nil, fmt.Errorf("row %d: %v", row, err)
+			}
+		}
+		if i, ok := columns["createdby"]; ok {
+			t.CreatedBy = record[i]
+		}
+		if i, ok := columns["restricted"]; ok && record[i] != "" {
+			if t.Restricted, err = strconv.ParseBool(record[i]); err != nil {
+				return nil, fmt.Errorf("row %d: invalid restricted: %v", row, err)
+			}
+		}
+		if i, ok := columns["opensat"]; ok {
+			if t.OpensAt, err = parseTime(record[i]); err != nil {
+				return nil, fmt.Errorf("row %d: invalid opensAt: %v", row, err)
+			}
+		}
+		if i, ok := columns["closesat"]; ok {
+			if t.ClosesAt, err = parseTime(record[i]); err != nil {
+				return nil, fmt.Errorf("row %d: invalid closesAt: %v", row, err)
+			}
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+// formatTime formats an optional time for CSV, nil is empty
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+// parseTime parses an optional CSV time, empty is nil
+func parseTime(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// ImportTopics loads topics into the cache, resolving UID conflicts with mode.
+// Boards referred to by imported topics are created when missing. Imported
+// topics are not checked for duplicate names, the first topic keeps the name.
+// The whole import is applied under a single lock so readers never observe
+// a partially imported dump.
+func ImportTopics(topics []Topic, mode ConflictMode) ImportResult {
+	var result ImportResult
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	for _, t := range topics {
+		if _, ok := boardKV[t.Board]; t.Board != "" && !ok {
+			boardKV[t.Board] = &Board{ID: t.Board, Name: t.Board}
+		}
+
+		v, ok := topicKV[t.UID]
+		if !ok {
+			v = &Topic{
+				UID:      t.UID,
+				Name:     t.Name,
+				Upvote:   t.Upvote,
+				Downvote: t.Downvote,
+				Board:    t.Board,
+				Tags:     NormalizeTags(t.Tags),
+
+				Description: t.Description,
+				URL:         t.URL,
+				Author:      t.Author,
+
+				State: t.State,
+
+				CreatedBy:  t.CreatedBy,
+				Restricted: t.Restricted,
+
+				OpensAt:  utcTime(t.OpensAt),
+				ClosesAt: utcTime(t.ClosesAt),
+			}
+			topicKV[t.UID] = v
+			addIndexes(v)
+			recordMutation(TopicCreated, v, 0, 0)
+			result.Created++
+			continue
+		}
+
+		switch mode {
+		case ConflictOverwrite:
+			removeIndexes(v)
+			v.Name = t.Name
+			v.Upvote = t.Upvote
+			v.Downvote = t.Downvote
+			v.Board = t.Board
+			v.Tags = NormalizeTags(t.Tags)
+			v.Description = t.Description
+			v.URL = t.URL
+			v.Author = t.Author
+			v.State = t.State
+			v.CreatedBy = t.CreatedBy
+			v.Restricted = t.Restricted
+			v.OpensAt = utcTime(t.OpensAt)
+			v.ClosesAt = utcTime(t.ClosesAt)
+			addIndexes(v)
+			recordMutation(TopicUpdated, v, 0, 0)
+			result.Overwritten++
+		case ConflictMerge:
+			up, upCarry := bits.Add64(v.Upvote, t.Upvote, 0)
+			down, downCarry := bits.Add64(v.Downvote, t.Downvote, 0)
+			if upCarry != 0 || downCarry != 0 {
+				result.OutOfRange++
+				continue
+			}
+			v.Upvote, v.Downvote = up, down
+			recordMutation(TopicVoted, v, t.Upvote, t.Downvote)
+			result.Merged++
+		default:
+			result.Skipped++
+		}
+	}
+	return result
+}
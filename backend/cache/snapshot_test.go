@@ -0,0 +1,80 @@
+package cache
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	opensAt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	closesAt := opensAt.Add(36 * time.Hour)
+
+	tests := []Topic{
+		{UID: uuid.New(), Name: "snap-1", Upvote: 3, Downvote: 1},
+		{UID: uuid.New(), Name: "snap, \"quoted\"\nname", Upvote: 0, Downvote: 7},
+		{UID: uuid.New(), Name: "snap-3", Board: "snap", Tags: []string{"go", "infra"}},
+		{UID: uuid.New(), Name: "snap-4", State: StateHidden, CreatedBy: "alice@example.com", Restricted: true},
+		{UID: uuid.New(), Name: "snap-5", OpensAt: &opensAt, ClosesAt: &closesAt},
+	}
+
+	for _, format := range []SnapshotFormat{FormatNDJSON, FormatCSV} {
+		var buf bytes.Buffer
+		err := WriteSnapshot(&buf, format, tests)
+		assert.Nil(t, err, "Write %v snapshot failed", format)
+
+		topics, err := ReadSnapshot(&buf, format)
+		assert.Nil(t, err, "Read %v snapshot failed", format)
+		assert.Equal(t, tests, topics)
+	}
+}
+
+func TestReadSnapshotInvalid(t *testing.T) {
+	_, err := ReadSnapshot(bytes.NewBufferString("{\"name\":\"ok\"}\nnot-json\n"), FormatNDJSON)
+	assert.EqualError(t, err, "line 2: invalid character 'o' in literal null (expecting 'u')")
+
+	_, err = ReadSnapshot(bytes.NewBufferString("uid,name\n"), FormatCSV)
+	assert.EqualError(t, err, "row 1: missing column \"upvote\"")
+
+	_, err = ReadSnapshot(bytes.NewBufferString("uid,name,upvote,downvote\nbad,x,1,2\n"), FormatCSV)
+	assert.Contains(t, err.Error(), "row 2: invalid uid")
+}
+
+func TestImportTopics(t *testing.T) {
+	uid, err := CreateTopic("import-1")
+	assert.Equal(t, nil, err, "Create topic failed")
+	IncTopicUpvote(uid)
+
+	newUID := uuid.New()
+	dump := []Topic{
+		{UID: uid, Name: "import-1-renamed", Upvote: 5, Downvote: 2},
+		{UID: newUID, Name: "import-2", Upvote: 1, Downvote: 1},
+	}
+
+	result := ImportTopics(dump, ConflictSkip)
+	assert.Equal(t, ImportResult{Created: 1, Skipped: 1}, result)
+	topic, _ := GetTopic(uid)
+	assert.Equal(t, Topic{UID: uid, Name: "import-1", Upvote: 1}, *topic)
+
+	result = ImportTopics(dump, ConflictMerge)
+	assert.Equal(t, ImportResult{Merged: 2}, result)
+	topic, _ = GetTopic(uid)
+	assert.Equal(t, Topic{UID: uid, Name: "import-1", Upvote: 6, Downvote: 2}, *topic)
+
+	// Counts beyond the uint64 range leave the topic untouched
+	result = ImportTopics([]Topic{{UID: uid, Upvote: math.MaxUint64}, {UID: newUID, Downvote: math.MaxUint64}}, ConflictMerge)
+	assert.Equal(t, ImportResult{OutOfRange: 2}, result)
+	topic, _ = GetTopic(uid)
+	assert.Equal(t, Topic{UID: uid, Name: "import-1", Upvote: 6, Downvote: 2}, *topic)
+
+	result = ImportTopics(dump, ConflictOverwrite)
+	assert.Equal(t, ImportResult{Overwritten: 2}, result)
+	topic, _ = GetTopic(uid)
+	assert.Equal(t, dump[0], *topic)
+	topic, _ = GetTopic(newUID)
+	assert.Equal(t, dump[1], *topic)
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// TopicState defines whether a topic is listed and open for voting
+type TopicState string
+
+const (
+	// StateVisible topics are listed and open for voting
+	StateVisible TopicState = ""
+	// StatePending topics wait for a moderator's approval
+	StatePending TopicState = "pending"
+	// StateHidden topics were hidden by a moderator
+	StateHidden TopicState = "hidden"
+)
+
+// ParseTopicState parses the topic state name, "visible" or empty means visible
+func ParseTopicState(s string) (TopicState, error) {
+	switch TopicState(s) {
+	case StateVisible, "visible":
+		return StateVisible, nil
+	case StatePending:
+		return StatePending, nil
+	case StateHidden:
+		return StateHidden, nil
+	}
+	return "", fmt.Errorf("unknown topic state %q", s)
+}
+
+// Visible includes only the visible topics
+func Visible() TopicFilter {
+	return InState(StateVisible)
+}
+
+// visibleOnly returns a copy of filters which also excludes non-visible topics
+func visibleOnly(filters []TopicFilter) []TopicFilter {
+	return append(filters[:len(filters):len(filters)], Visible())
+}
+
+// InState includes only the topics in the given state
+func InState(state TopicState) TopicFilter {
+	return func(t *Topic) bool { return t.State == state }
+}
+
+// SetTopicState sets Topic state
+func SetTopicState(uid uuid.UUID, state TopicState) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return ErrTopicNotFound
+	}
+
+	v.State = state
+	return nil
+}
+
+// ListTopics gets topics matching all filters, whatever their state,
+// ordered by UID
+func ListTopics(filters ...TopicFilter) []Topic {
+	lock.RLock()
+	topics := filterTopics(filters)
+	lock.RUnlock()
+
+	sortByUID(topics)
+	return topics
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetTopicState(t *testing.T) {
+	Reset()
+
+	uid1, err := NewTopic(Topic{Name: "13-1", State: StatePending, Tags: []string{"moderated"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid2, err := CreateTopic("13-2 moderated")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	// Non-visible topics are excluded from rankings, search and tags
+	assert.Len(t, GetTopicDescendUpvote(), 1)
+	assert.Len(t, GetTopicDescendDownvote(), 1)
+	assert.Len(t, SearchTopics("moderated"), 1)
+	assert.Empty(t, GetTagCounts())
+	assert.Equal(t, []Topic{{UID: uid1, Name: "13-1", State: StatePending, Tags: []string{"moderated"}}}, ListTopics(InState(StatePending)))
+
+	err = SetTopicState(uid1, StateVisible)
+	assert.Equal(t, nil, err, "Set topic state failed")
+	err = SetTopicState(uid2, StateHidden)
+	assert.Equal(t, nil, err, "Set topic state failed")
+
+	topics := GetTopicDescendUpvote()
+	assert.Len(t, topics, 1)
+	assert.Equal(t, uid1, topics[0].UID)
+	assert.Len(t, ListTopics(), 2)
+
+	err = SetTopicState(uuid.New(), StateHidden)
+	assert.Equal(t, ErrTopicNotFound, err, "Set topic state should failed")
+}
+
+func TestParseTopicState(t *testing.T) {
+	for _, s := range []string{"", "visible"} {
+		state, err := ParseTopicState(s)
+		assert.Nil(t, err)
+		assert.Equal(t, StateVisible, state)
+	}
+
+	state, err := ParseTopicState("hidden")
+	assert.Nil(t, err)
+	assert.Equal(t, StateHidden, state)
+
+	_, err = ParseTopicState("deleted")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// TagCount defines how many topics use a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTags lower-cases and trims tags, drops empty and duplicate ones
+// and sorts the result
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || hasTag(normalized, tag) {
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+	return normalized
+}
+
+// hasTag reports whether tag is in tags
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// SetTopicTags replaces Topic tags
+func SetTopicTags(uid uuid.UUID, tags []string) bool {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if v, ok := topicKV[uid]; ok {
+		removeIndexes(v)
+		v.Tags = NormalizeTags(tags)
+		addIndexes(v)
+		return true
+	}
+	return false
+}
+
+// GetTagCounts gets the tags of visible topics ordered by descending usage, then by name
+func GetTagCounts() []TagCount {
+	counts := make(map[string]int)
+
+	lock.RLock()
+	for _, v := range topicKV {
+		if v.State != StateVisible {
+			continue
+		}
+		for _, tag := range v.Tags {
+			counts[tag]++
+		}
+	}
+	lock.RUnlock()
+
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	return tags
+}
@@ -0,0 +1,43 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	assert.Nil(t, NormalizeTags(nil))
+	assert.Equal(t, []string{"go", "infra"}, NormalizeTags([]string{" Infra", "go", "GO", ""}))
+}
+
+func TestTopicTags(t *testing.T) {
+	Reset()
+
+	uid1, err := NewTopic(Topic{Name: "10-1", Tags: []string{"go", "infra"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid2, err := NewTopic(Topic{Name: "10-2", Tags: []string{"Go"}})
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid3, err := CreateTopic("10-3")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	IncTopicUpvote(uid2)
+
+	topics := GetTopicDescendUpvote(WithTags("go"))
+	assert.Len(t, topics, 2)
+	assert.Equal(t, uid2, topics[0].UID)
+	assert.Equal(t, []string{"go"}, topics[0].Tags)
+
+	topics = GetTopicDescendUpvote(WithTags("infra", "GO"))
+	assert.Len(t, topics, 1)
+	assert.Equal(t, uid1, topics[0].UID)
+
+	ok := SetTopicTags(uid3, []string{"infra"})
+	assert.Equal(t, true, ok, "Set topic tags failed")
+
+	assert.Equal(t, []TagCount{{Tag: "go", Count: 2}, {Tag: "infra", Count: 2}}, GetTagCounts())
+
+	ok = SetTopicTags(uid1, nil)
+	assert.Equal(t, true, ok, "Set topic tags failed")
+	assert.Equal(t, []TagCount{{Tag: "go", Count: 1}, {Tag: "infra", Count: 1}}, GetTagCounts())
+}
@@ -0,0 +1,52 @@
+package cache
+
+import (
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// ErrAlreadyVoted is returned when a voter votes twice on a topic
+var ErrAlreadyVoted = errors.New("topic already voted")
+
+// voterKV maps voter id to the topics voted, true for upvote
+var voterKV map[string]map[uuid.UUID]bool
+
+// RecordVote records the vote of a voter on a topic, a voter votes once
+// per topic
+func RecordVote(voter string, uid uuid.UUID, up bool) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	votes, ok := voterKV[voter]
+	if !ok {
+		votes = make(map[uuid.UUID]bool)
+		voterKV[voter] = votes
+	}
+	if _, ok := votes[uid]; ok {
+		return ErrAlreadyVoted
+	}
+	votes[uid] = up
+	return nil
+}
+
+// ForgetVote forgets the vote of a voter on a topic, such as a vote which
+// was not counted
+func ForgetVote(voter string, uid uuid.UUID) {
+	lock.Lock()
+	defer lock.Unlock()
+
+	delete(voterKV[voter], uid)
+}
+
+// GetVoterVotes gets the topics a voter voted on, true for upvote
+func GetVoterVotes(voter string) map[uuid.UUID]bool {
+	lock.RLock()
+	defer lock.RUnlock()
+
+	votes := make(map[uuid.UUID]bool, len(voterKV[voter]))
+	for uid, up := range voterKV[voter] {
+		votes[uid] = up
+	}
+	return votes
+}
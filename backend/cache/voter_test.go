@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordVote(t *testing.T) {
+	Reset()
+
+	uid1, uid2 := uuid.New(), uuid.New()
+	assert.Nil(t, RecordVote("voter1", uid1, true))
+	assert.Nil(t, RecordVote("voter1", uid2, false))
+	assert.Nil(t, RecordVote("voter2", uid1, false))
+
+	assert.Equal(t, ErrAlreadyVoted, RecordVote("voter1", uid1, true))
+	assert.Equal(t, ErrAlreadyVoted, RecordVote("voter1", uid1, false))
+
+	assert.Equal(t, map[uuid.UUID]bool{uid1: true, uid2: false}, GetVoterVotes("voter1"))
+	assert.Empty(t, GetVoterVotes("voter3"))
+
+	// A forgotten vote may be cast again
+	ForgetVote("voter1", uid1)
+	ForgetVote("voter3", uid1)
+	assert.Equal(t, map[uuid.UUID]bool{uid2: false}, GetVoterVotes("voter1"))
+	assert.Nil(t, RecordVote("voter1", uid1, false))
+}
@@ -0,0 +1,83 @@
+package cache
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrPollNotOpen is returned when voting on a topic before it opens
+	ErrPollNotOpen = errors.New("poll not open yet")
+	// ErrPollClosed is returned when voting on a topic after it closes
+	ErrPollClosed = errors.New("poll closed")
+	// ErrInvalidWindow is returned when a topic closes before it opens
+	ErrInvalidWindow = errors.New("poll closes before it opens")
+)
+
+// CheckOpen returns ErrPollNotOpen or ErrPollClosed when the topic is not
+// open for voting at now. A topic without window is always open.
+func (t *Topic) CheckOpen(now time.Time) error {
+	return checkOpen(t.OpensAt, t.ClosesAt, now)
+}
+
+// checkOpen returns ErrPollNotOpen or ErrPollClosed when now is out of
+// the voting window
+func checkOpen(opensAt, closesAt *time.Time, now time.Time) error {
+	if opensAt != nil && now.Before(*opensAt) {
+		return ErrPollNotOpen
+	}
+	if closesAt != nil && !now.Before(*closesAt) {
+		return ErrPollClosed
+	}
+	return nil
+}
+
+// CheckWindow returns ErrInvalidWindow when closesAt is not after opensAt
+func CheckWindow(opensAt, closesAt *time.Time) error {
+	if opensAt != nil && closesAt != nil && !closesAt.After(*opensAt) {
+		return ErrInvalidWindow
+	}
+	return nil
+}
+
+// SetTopicWindow sets Topic voting window, nil keeps the current time
+func SetTopicWindow(uid uuid.UUID, opensAt, closesAt *time.Time) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	v, ok := topicKV[uid]
+	if !ok {
+		return ErrTopicNotFound
+	}
+
+	if opensAt == nil {
+		opensAt = v.OpensAt
+	}
+	if closesAt == nil {
+		closesAt = v.ClosesAt
+	}
+	if err := CheckWindow(opensAt, closesAt); err != nil {
+		return err
+	}
+
+	v.OpensAt, v.ClosesAt = utcTime(opensAt), utcTime(closesAt)
+	return nil
+}
+
+// ClosedBetween includes only the topics closing in the (from, to] interval
+func ClosedBetween(from, to time.Time) TopicFilter {
+	return func(t *Topic) bool {
+		return t.ClosesAt != nil && t.ClosesAt.After(from) && !t.ClosesAt.After(to)
+	}
+}
+
+// utcTime returns a copy of t in UTC
+func utcTime(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+	u := t.UTC()
+	return &u
+}
@@ -0,0 +1,44 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollWindow(t *testing.T) {
+	Reset()
+
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	open, err := NewTopic(Topic{Name: "15-1", OpensAt: &past, ClosesAt: &future})
+	assert.Equal(t, nil, err, "Create topic failed")
+	notOpen, err := NewTopic(Topic{Name: "15-2", OpensAt: &future})
+	assert.Equal(t, nil, err, "Create topic failed")
+	closed, err := NewTopic(Topic{Name: "15-3", ClosesAt: &past})
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	assert.Equal(t, nil, IncTopicUpvote(open))
+	assert.Equal(t, ErrPollNotOpen, IncTopicUpvote(notOpen))
+	assert.Equal(t, ErrPollClosed, IncTopicDownvote(closed))
+
+	// Closed topics keep their final results
+	topic, _ := GetTopic(open)
+	assert.EqualValues(t, 1, topic.Upvote)
+	assert.Len(t, GetTopicDescendUpvote(), 3)
+
+	err = SetTopicWindow(notOpen, &past, nil)
+	assert.Equal(t, nil, err, "Set topic window failed")
+	assert.Equal(t, nil, IncTopicUpvote(notOpen))
+
+	err = SetTopicWindow(open, nil, &past)
+	assert.Equal(t, ErrInvalidWindow, err, "Set topic window should failed")
+
+	err = SetTopicWindow(closed, nil, &future)
+	assert.Equal(t, nil, err, "Set topic window failed")
+	assert.Equal(t, nil, IncTopicDownvote(closed))
+
+	topics := ListTopics(ClosedBetween(past, future))
+	assert.Len(t, topics, 2)
+	assert.Equal(t, time.UTC, topics[0].ClosesAt.Location())
+}
@@ -0,0 +1,81 @@
+// Package events publishes what happens to topics to in-process
+// subscribers.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Event types
+const (
+	// PollClosed is published when the voting window of a topic closes
+	PollClosed = "poll.closed"
+	// TopicCreated is published when a topic goes live
+	TopicCreated = "topic.created"
+	// TopicVoted is published with the topic after votes are counted
+	TopicVoted = "topic.voted"
+)
+
+// Event is something which happened to a topic
+type Event struct {
+	ID    uuid.UUID   `json:"id"`
+	Type  string      `json:"type"`
+	Time  time.Time   `json:"time"`
+	Topic uuid.UUID   `json:"topic,omitempty"`
+	Data  interface{} `json:"data,omitempty"`
+}
+
+// New returns an event of the topic happening now
+func New(typ string, topic uuid.UUID, data interface{}) Event {
+	return Event{ID: uuid.New(), Type: typ, Time: time.Now().UTC(), Topic: topic, Data: data}
+}
+
+// Handler receives the published events, it must not block
+type Handler func(Event)
+
+// Bus delivers the published events to the subscribers in order.
+// It is safe for concurrent use.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+// NewBus returns a bus without subscribers
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe adds a handler receiving the events published afterwards
+func (b *Bus) Subscribe(h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.handlers = append(b.handlers, h)
+}
+
+// Publish delivers the event to every subscriber
+func (b *Bus) Publish(e Event) {
+	b.mu.RLock()
+	handlers := b.handlers
+	b.mu.RUnlock()
+
+	for _, h := range handlers {
+		h(e)
+	}
+}
+
+// Default is the bus of the server
+var Default = NewBus()
+
+// Subscribe adds a handler to the Default bus
+func Subscribe(h Handler) {
+	Default.Subscribe(h)
+}
+
+// Publish delivers the event to the subscribers of the Default bus
+func Publish(e Event) {
+	Default.Publish(e)
+}
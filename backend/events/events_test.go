@@ -0,0 +1,31 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	uid := uuid.New()
+
+	// Events before subscribing are not delivered
+	bus.Publish(New(PollClosed, uid, nil))
+
+	var first, second []Event
+	bus.Subscribe(func(e Event) { first = append(first, e) })
+	bus.Subscribe(func(e Event) { second = append(second, e) })
+
+	e1 := New(PollClosed, uid, "data")
+	e2 := New(PollClosed, uuid.New(), nil)
+	bus.Publish(e1)
+	bus.Publish(e2)
+
+	assert.Equal(t, []Event{e1, e2}, first)
+	assert.Equal(t, first, second)
+	assert.NotEqual(t, e1.ID, e2.ID)
+	assert.Equal(t, uid, e1.Topic)
+	assert.Equal(t, "data", e1.Data)
+}
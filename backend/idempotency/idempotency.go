@@ -0,0 +1,131 @@
+// Package idempotency remembers the responses of requests by idempotency
+// key, so that a retried request is answered without being applied again.
+package idempotency
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// State is the state of a key when a request begins
+type State int
+
+const (
+	// Apply keys are not seen yet, the request is applied
+	Apply State = iota
+	// InFlight keys belong to a request which is still being applied
+	InFlight
+	// Replay keys have a stored response to replay
+	Replay
+	// Mismatch keys were used by a different request
+	Mismatch
+)
+
+// Response is a stored response
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+type entry struct {
+	key         string
+	fingerprint string
+	done        bool
+	response    Response
+	expires     time.Time
+}
+
+// Store keeps the responses by key for a TTL. It is bounded, the least
+// recently used key is forgotten first. It is safe for concurrent use.
+type Store struct {
+	// Now returns the current time, it is replaced by tests
+	Now func() time.Time
+
+	mu      sync.Mutex
+	ttl     time.Duration
+	max     int
+	entries map[string]*list.Element
+	order   *list.List // front is the most recently used
+}
+
+// New returns a store of at most max keys kept for ttl
+func New(max int, ttl time.Duration) *Store {
+	return &Store{
+		Now:     time.Now,
+		ttl:     ttl,
+		max:     max,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Begin starts a request with key, the fingerprint identifies the request
+// using the key. An Apply key is reserved until Finish or Abort, a
+// Replay key returns the stored response.
+func (s *Store) Begin(key, fingerprint string) (Response, State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.Now()
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*entry)
+		if now.Before(e.expires) {
+			s.order.MoveToFront(el)
+			switch {
+			case e.fingerprint != fingerprint:
+				return Response{}, Mismatch
+			case !e.done:
+				return Response{}, InFlight
+			}
+			return e.response, Replay
+		}
+		s.remove(el)
+	}
+
+	s.entries[key] = s.order.PushFront(&entry{key: key, fingerprint: fingerprint, expires: now.Add(s.ttl)})
+	for s.order.Len() > s.max {
+		s.remove(s.order.Back())
+	}
+	return Response{}, Apply
+}
+
+// Finish stores the response of a request begun with key
+func (s *Store) Finish(key string, r Response) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok {
+		e := el.Value.(*entry)
+		e.done = true
+		e.response = r
+		e.expires = s.Now().Add(s.ttl)
+	}
+}
+
+// Abort forgets a request begun with key, so that it can be retried
+func (s *Store) Abort(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.entries[key]; ok && !el.Value.(*entry).done {
+		s.remove(el)
+	}
+}
+
+// Len returns the number of keys kept, expired ones included until reused
+// or evicted
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.order.Len()
+}
+
+// remove forgets the key of el. The caller must hold the lock.
+func (s *Store) remove(el *list.Element) {
+	s.order.Remove(el)
+	delete(s.entries, el.Value.(*entry).key)
+}
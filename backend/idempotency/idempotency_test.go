@@ -0,0 +1,88 @@
+package idempotency
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func newStore(max int, ttl time.Duration) (*Store, *time.Time) {
+	now := epoch
+	s := New(max, ttl)
+	s.Now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestBeginFinish(t *testing.T) {
+	s, _ := newStore(10, time.Hour)
+
+	_, state := s.Begin("k", "a")
+	assert.Equal(t, Apply, state)
+	_, state = s.Begin("k", "a")
+	assert.Equal(t, InFlight, state)
+	_, state = s.Begin("k", "b")
+	assert.Equal(t, Mismatch, state)
+
+	s.Finish("k", Response{Status: 201, Body: []byte("ok")})
+	r, state := s.Begin("k", "a")
+	assert.Equal(t, Replay, state)
+	assert.Equal(t, Response{Status: 201, Body: []byte("ok")}, r)
+	_, state = s.Begin("k", "b")
+	assert.Equal(t, Mismatch, state)
+}
+
+func TestAbort(t *testing.T) {
+	s, _ := newStore(10, time.Hour)
+
+	_, state := s.Begin("k", "a")
+	assert.Equal(t, Apply, state)
+	s.Abort("k")
+	_, state = s.Begin("k", "b")
+	assert.Equal(t, Apply, state)
+
+	// Finished keys are not aborted
+	s.Finish("k", Response{Status: 200})
+	s.Abort("k")
+	_, state = s.Begin("k", "b")
+	assert.Equal(t, Replay, state)
+}
+
+func TestExpiry(t *testing.T) {
+	s, now := newStore(10, time.Minute)
+
+	s.Begin("k", "a")
+	s.Finish("k", Response{Status: 200})
+
+	*now = now.Add(59 * time.Second)
+	_, state := s.Begin("k", "a")
+	assert.Equal(t, Replay, state)
+
+	*now = now.Add(2 * time.Second)
+	_, state = s.Begin("k", "b")
+	assert.Equal(t, Apply, state)
+}
+
+func TestBounded(t *testing.T) {
+	s, _ := newStore(3, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		key := fmt.Sprint(i)
+		s.Begin(key, "a")
+		s.Finish(key, Response{Status: 200})
+	}
+
+	// Using key 0 makes key 1 the least recently used
+	_, state := s.Begin("0", "a")
+	assert.Equal(t, Replay, state)
+	s.Begin("3", "a")
+	assert.Equal(t, 3, s.Len())
+
+	_, state = s.Begin("1", "a")
+	assert.Equal(t, Apply, state)
+	_, state = s.Begin("0", "a")
+	assert.Equal(t, Replay, state)
+}
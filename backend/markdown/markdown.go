@@ -0,0 +1,151 @@
+// Package markdown renders the small Markdown subset allowed in topic
+// descriptions to HTML which is safe to embed in the homepage.
+//
+// The source is HTML escaped before any Markdown is interpreted, so raw HTML
+// in a description is always displayed as text. Supported syntax:
+//
+//	paragraphs separated by blank lines, hard line breaks
+//	# headings (rendered from <h5> down)
+//	- or * unordered lists, 1. ordered lists
+//	**bold**, *italic*, _italic_, `code`
+//	[text](url) links with http, https or mailto scheme
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	headingPattern     = regexp.MustCompile(`^(#{1,6})\s+(.*)$`)
+	unorderedPattern   = regexp.MustCompile(`^[-*]\s+(.*)$`)
+	orderedPattern     = regexp.MustCompile(`^\d+\.\s+(.*)$`)
+	codePattern        = regexp.MustCompile("`([^`]+)`")
+	linkPattern        = regexp.MustCompile(`\[([^\]]+)\]\(([^)\s]+)\)`)
+	boldPattern        = regexp.MustCompile(`\*\*([^*]+)\*\*`)
+	italicStarPattern  = regexp.MustCompile(`\*([^*]+)\*`)
+	italicUnderPattern = regexp.MustCompile(`\b_([^_]+)_\b`)
+)
+
+// Render converts Markdown source to sanitized HTML
+func Render(src string) template.HTML {
+	var out strings.Builder
+
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	// Kind of the block being written: "", "p", "ul" or "ol"
+	var block string
+	closeBlock := func() {
+		if block != "" {
+			out.WriteString("</" + block + ">\n")
+			block = ""
+		}
+	}
+	openBlock := func(kind string) {
+		if block != kind {
+			closeBlock()
+			out.WriteString("<" + kind + ">")
+			block = kind
+		}
+	}
+
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			closeBlock()
+		case headingPattern.MatchString(trimmed):
+			closeBlock()
+			m := headingPattern.FindStringSubmatch(trimmed)
+			level := len(m[1]) + 4
+			if level > 6 {
+				level = 6
+			}
+			tag := "h" + string(rune('0'+level))
+			out.WriteString("<" + tag + ">" + inline(m[2]) + "</" + tag + ">\n")
+		case unorderedPattern.MatchString(trimmed):
+			openBlock("ul")
+			out.WriteString("<li>" + inline(unorderedPattern.FindStringSubmatch(trimmed)[1]) + "</li>")
+		case orderedPattern.MatchString(trimmed):
+			openBlock("ol")
+			out.WriteString("<li>" + inline(orderedPattern.FindStringSubmatch(trimmed)[1]) + "</li>")
+		default:
+			if block == "p" {
+				out.WriteString("<br>")
+			}
+			openBlock("p")
+			out.WriteString(inline(trimmed))
+		}
+	}
+	closeBlock()
+
+	return template.HTML(strings.TrimSuffix(out.String(), "\n"))
+}
+
+// Code spans and link tags are replaced by their index between these marks
+// of the Unicode private use area, which no Markdown syntax matches
+const (
+	codeMark = "\uE000"
+	linkMark = "\uE001"
+)
+
+// inline escapes a line and renders its inline Markdown. Code spans and
+// link tags are rendered last from placeholders so that the emphasis
+// leaves their content and hrefs untouched.
+func inline(s string) string {
+	// Drop the placeholder marks from the text
+	s = strings.NewReplacer(codeMark, "", linkMark, "").Replace(html.EscapeString(s))
+
+	var codes []string
+	s = codePattern.ReplaceAllStringFunc(s, func(m string) string {
+		codes = append(codes, codePattern.FindStringSubmatch(m)[1])
+		return codeMark + strconv.Itoa(len(codes)-1) + codeMark
+	})
+
+	var links []string
+	s = linkPattern.ReplaceAllStringFunc(s, func(m string) string {
+		sub := linkPattern.FindStringSubmatch(m)
+		href, ok := SafeURL(html.UnescapeString(sub[2]))
+		if !ok {
+			return sub[1]
+		}
+		links = append(links, `<a href="`+html.EscapeString(href)+`" rel="nofollow noopener">`)
+		return linkMark + strconv.Itoa(len(links)-1) + linkMark + sub[1] + "</a>"
+	})
+	s = boldPattern.ReplaceAllString(s, "<strong>$1</strong>")
+	s = italicStarPattern.ReplaceAllString(s, "<em>$1</em>")
+	s = italicUnderPattern.ReplaceAllString(s, "<em>$1</em>")
+
+	for i, link := range links {
+		s = strings.Replace(s, linkMark+strconv.Itoa(i)+linkMark, link, 1)
+	}
+
+	for i, code := range codes {
+		s = strings.Replace(s, codeMark+strconv.Itoa(i)+codeMark, "<code>"+code+"</code>", 1)
+	}
+	return s
+}
+
+// SafeURL parses an absolute link and reports whether its scheme is
+// http, https or mailto.
+func SafeURL(raw string) (string, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+	default:
+		return "", false
+	}
+	return u.String(), true
+}
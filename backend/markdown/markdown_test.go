@@ -0,0 +1,70 @@
+package markdown
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected template.HTML
+	}{
+		{"", ""},
+		{"hello\nworld", "<p>hello<br>world</p>"},
+		{"one\n\ntwo", "<p>one</p>\n<p>two</p>"},
+		{"# Title", "<h5>Title</h5>"},
+		{"###### Small", "<h6>Small</h6>"},
+		{"- a\n- b", "<ul><li>a</li><li>b</li></ul>"},
+		{"1. a\n2. b", "<ol><li>a</li><li>b</li></ol>"},
+		{"**bold** *em* _em_ `x*y*`", "<p><strong>bold</strong> <em>em</em> <em>em</em> <code>x*y*</code></p>"},
+		{"[docs](https://example.com/a?b=1&c=2)", `<p><a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener">docs</a></p>`},
+		{"snake_case_name", "<p>snake_case_name</p>"},
+		{"[a](https://x.com/a_b_c) and [b](https://x.com/*d*) *e*", `<p><a href="https://x.com/a_b_c" rel="nofollow noopener">a</a> and <a href="https://x.com/*d*" rel="nofollow noopener">b</a> <em>e</em></p>`},
+		{"[**docs**](https://x.com/__init__) `x` \uE000\uE0010\uE001", `<p><a href="https://x.com/__init__" rel="nofollow noopener"><strong>docs</strong></a> <code>x</code> 0</p>`},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Render(test.src), test.src)
+	}
+
+	// The placeholders of many code spans do not read as emphasis
+	var src, expected []string
+	for i := 0; i < 100; i++ {
+		src = append(src, fmt.Sprintf("`%d`", i))
+		expected = append(expected, fmt.Sprintf("<code>%d</code>", i))
+	}
+	assert.Equal(t, template.HTML("<p>"+strings.Join(expected, ", ")+" *</p>"), Render(strings.Join(src, ", ")+" *"))
+}
+
+func TestRenderSanitize(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected template.HTML
+	}{
+		{"<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{`<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>"},
+		{"[click](javascript:alert`1`)", "<p>click</p>"},
+		{`[click](https://x.com/"onmouseover="alert)`, `<p><a href="https://x.com/%22onmouseover=%22alert" rel="nofollow noopener">click</a></p>`},
+		{"`<b>`", "<p><code>&lt;b&gt;</code></p>"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Render(test.src), test.src)
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	for _, raw := range []string{"https://example.com", "http://example.com/x", "mailto:a@example.com"} {
+		_, ok := SafeURL(raw)
+		assert.True(t, ok, raw)
+	}
+	for _, raw := range []string{"javascript:alert(1)", "data:text/html,x", "/relative", "https://", "ftp://example.com"} {
+		_, ok := SafeURL(raw)
+		assert.False(t, ok, raw)
+	}
+}
@@ -0,0 +1,146 @@
+// Package moderation decides whether a new topic goes live, waits for a
+// moderator's approval or is rejected.
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/jenting/voting-topic/backend/cache"
+)
+
+// Decision defines what happens to a new topic
+type Decision int
+
+const (
+	// Allow publishes the topic immediately
+	Allow Decision = iota
+	// Hold keeps the topic pending until a moderator approves it
+	Hold
+	// Reject refuses to create the topic
+	Reject
+)
+
+// String returns the decision name
+func (d Decision) String() string {
+	switch d {
+	case Allow:
+		return "allow"
+	case Hold:
+		return "hold"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Decision(%d)", int(d))
+}
+
+// Result defines a moderation decision and why it was taken
+type Result struct {
+	Decision Decision
+	Reason   string
+}
+
+// Moderator is the moderation hook applied when a topic is created or edited
+type Moderator interface {
+	Moderate(t cache.Topic) Result
+}
+
+// Filter is a Moderator matching topics against a blocklist of words and
+// regular expressions. A zero Filter allows every topic.
+type Filter struct {
+	// Words are matched case-insensitively against whole words
+	Words []string
+	// Patterns are matched against the raw topic text
+	Patterns []*regexp.Regexp
+	// OnMatch is the decision for a blocklisted topic, Reject or Hold
+	OnMatch Decision
+	// RequireApproval holds every topic which is not blocklisted
+	RequireApproval bool
+}
+
+// Config is the JSON configuration of a Filter
+type Config struct {
+	Words    []string `json:"words"`
+	Patterns []string `json:"patterns"`
+	// OnMatch is "reject" (default) or "hold"
+	OnMatch         string `json:"onMatch"`
+	RequireApproval bool   `json:"requireApproval"`
+}
+
+// NewFilter compiles a Filter from its configuration
+func NewFilter(cfg Config) (*Filter, error) {
+	f := &Filter{OnMatch: Reject, RequireApproval: cfg.RequireApproval}
+
+	switch strings.ToLower(cfg.OnMatch) {
+	case "", "reject":
+	case "hold":
+		f.OnMatch = Hold
+	default:
+		return nil, fmt.Errorf("unknown onMatch decision %q", cfg.OnMatch)
+	}
+
+	for _, word := range cfg.Words {
+		tokens := cache.Tokenize(word)
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("blocklist word %q has no letters or digits", word)
+		}
+		f.Words = append(f.Words, strings.Join(tokens, " "))
+	}
+
+	for _, pattern := range cfg.Patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("blocklist pattern %q: %v", pattern, err)
+		}
+		f.Patterns = append(f.Patterns, re)
+	}
+	return f, nil
+}
+
+// LoadFilter reads a Filter configuration in JSON
+func LoadFilter(r io.Reader) (*Filter, error) {
+	var cfg Config
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return NewFilter(cfg)
+}
+
+// LoadFilterFile reads a Filter configuration JSON file
+func LoadFilterFile(path string) (*Filter, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadFilter(f)
+}
+
+// Moderate implements Moderator
+func (f *Filter) Moderate(t cache.Topic) Result {
+	text := strings.Join(append([]string{t.Name, t.Description, t.URL, t.Author}, t.Tags...), "\n")
+
+	// Pad with spaces so that words only match whole tokens
+	tokens := " " + strings.Join(cache.Tokenize(text), " ") + " "
+	for _, word := range f.Words {
+		if strings.Contains(tokens, " "+word+" ") {
+			return Result{Decision: f.OnMatch, Reason: fmt.Sprintf("blocklisted word %q", word)}
+		}
+	}
+
+	for _, re := range f.Patterns {
+		if re.MatchString(text) {
+			return Result{Decision: f.OnMatch, Reason: fmt.Sprintf("blocklisted pattern %q", re)}
+		}
+	}
+
+	if f.RequireApproval {
+		return Result{Decision: Hold, Reason: "approval required"}
+	}
+	return Result{Decision: Allow}
+}
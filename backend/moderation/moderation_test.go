@@ -0,0 +1,56 @@
+package moderation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterModerate(t *testing.T) {
+	f, err := NewFilter(Config{
+		Words:    []string{"Spam", "buy now"},
+		Patterns: []string{`(?i)casino\d+`},
+	})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		topic    cache.Topic
+		expected Result
+	}{
+		{cache.Topic{Name: "Quarterly planning"}, Result{Decision: Allow}},
+		{cache.Topic{Name: "No SPAM please"}, Result{Decision: Reject, Reason: `blocklisted word "spam"`}},
+		{cache.Topic{Name: "Spamalot tickets"}, Result{Decision: Allow}},
+		{cache.Topic{Name: "Deal", Description: "Buy   now!"}, Result{Decision: Reject, Reason: `blocklisted word "buy now"`}},
+		{cache.Topic{Name: "Deal", Tags: []string{"spam"}}, Result{Decision: Reject, Reason: `blocklisted word "spam"`}},
+		{cache.Topic{Name: "Deal", Author: "Spam King"}, Result{Decision: Reject, Reason: `blocklisted word "spam"`}},
+		{cache.Topic{Name: "Visit Casino777"}, Result{Decision: Reject, Reason: `blocklisted pattern "(?i)casino\\d+"`}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, f.Moderate(test.topic), test.topic.Name)
+	}
+
+	f.OnMatch = Hold
+	f.RequireApproval = true
+	assert.Equal(t, Hold, f.Moderate(cache.Topic{Name: "spam"}).Decision)
+	assert.Equal(t, Result{Decision: Hold, Reason: "approval required"}, f.Moderate(cache.Topic{Name: "Quarterly planning"}))
+
+	assert.Equal(t, Result{Decision: Allow}, (&Filter{}).Moderate(cache.Topic{Name: "spam"}))
+}
+
+func TestLoadFilter(t *testing.T) {
+	f, err := LoadFilter(strings.NewReader(`{"words": ["spam"], "onMatch": "hold", "requireApproval": true}`))
+	assert.Nil(t, err)
+	assert.Equal(t, &Filter{Words: []string{"spam"}, OnMatch: Hold, RequireApproval: true}, f)
+
+	for _, cfg := range []string{
+		`{"onMatch": "delete"}`,
+		`{"words": ["!!"]}`,
+		`{"patterns": ["("]}`,
+		`not json`,
+	} {
+		_, err := LoadFilter(strings.NewReader(cfg))
+		assert.NotNil(t, err, cfg)
+	}
+}
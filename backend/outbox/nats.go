@@ -0,0 +1,356 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultNATSPort is the client port of a NATS server
+const defaultNATSPort = "4222"
+
+// natsInfo is the INFO a NATS server sends when a client connects
+type natsInfo struct {
+	MaxPayload  int64 `json:"max_payload"`
+	TLSRequired bool  `json:"tls_required"`
+	Headers     bool  `json:"headers"`
+}
+
+// natsConnect is the CONNECT a client sends to a NATS server
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name,omitempty"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+	Headers  bool   `json:"headers"`
+	// NoResponders asks for a 503 status reply to the requests nobody
+	// answers, instead of a timeout
+	NoResponders bool `json:"no_responders"`
+}
+
+// jsPubAck is the reply of JetStream to a published message
+type jsPubAck struct {
+	Stream    string `json:"stream"`
+	Seq       uint64 `json:"seq"`
+	Duplicate bool   `json:"duplicate"`
+	Error     *struct {
+		Code        int    `json:"code"`
+		Description string `json:"description"`
+	} `json:"error"`
+}
+
+// NATS publishes the messages to a NATS server with the client protocol,
+// the payload of each message is its JSON encoding. It connects on the
+// first publish and again after an error.
+//
+// With JetStream, a batch is accepted once a stream stored each of its
+// messages, which carry their ID in the Nats-Msg-Id header for the stream
+// to drop the duplicates. Else a batch is accepted once the server answered
+// the PING sent after it, which only means the server received it: the
+// messages nobody subscribed to are lost, so delivery is at most once.
+type NATS struct {
+	// Name is the client name shown by the server
+	Name string
+	// JetStream waits for the acknowledgement of a stream, true by default
+	JetStream bool
+	timeout   time.Duration
+	addr      string
+	user      string
+	pass      string
+	token     string
+
+	mu         sync.Mutex
+	conn       net.Conn
+	r          *bufio.Reader
+	maxPayload int64
+	headers    bool
+	inbox      string // the subject prefix of the acknowledgements
+	replies    uint64
+}
+
+// NewNATS returns a publisher to the server at the URL
+// nats://[user:pass@|token@]host[:port], whose operations time out after
+// timeout
+func NewNATS(rawurl string, timeout time.Duration) (*NATS, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || u.Scheme != "nats" || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid NATS url %q", rawurl)
+	}
+
+	n := &NATS{Name: "voting-topic", JetStream: true, timeout: timeout, addr: u.Host}
+	if u.Port() == "" {
+		n.addr = net.JoinHostPort(u.Hostname(), defaultNATSPort)
+	}
+	if u.User != nil {
+		if pass, ok := u.User.Password(); ok {
+			n.user, n.pass = u.User.Username(), pass
+		} else {
+			n.token = u.User.Username()
+		}
+	}
+	return n, nil
+}
+
+// Publish publishes the messages in order
+func (n *NATS) Publish(ctx context.Context, msgs []Message) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		if err := n.connect(ctx); err != nil {
+			return err
+		}
+	}
+
+	n.setDeadline(ctx)
+	if err := n.publish(msgs); err != nil {
+		n.conn.Close()
+		n.conn = nil
+		return err
+	}
+	return nil
+}
+
+// Close closes the connection
+func (n *NATS) Close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		return nil
+	}
+	err := n.conn.Close()
+	n.conn = nil
+	return err
+}
+
+// setDeadline bounds the next operations by the timeout and ctx
+func (n *NATS) setDeadline(ctx context.Context) {
+	deadline := time.Now().Add(n.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	n.conn.SetDeadline(deadline)
+}
+
+// connect connects and authenticates to the server
+func (n *NATS) connect(ctx context.Context) error {
+	dialer := net.Dialer{Timeout: n.timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", n.addr)
+	if err != nil {
+		return err
+	}
+	n.conn, n.r = conn, bufio.NewReader(conn)
+	n.setDeadline(ctx)
+
+	if err := n.handshake(); err != nil {
+		conn.Close()
+		n.conn = nil
+		return err
+	}
+	return nil
+}
+
+// handshake reads the server INFO, then sends CONNECT, subscribes to the
+// acknowledgements with JetStream and waits for the server to accept it
+func (n *NATS) handshake() error {
+	line, err := n.readLine()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return fmt.Errorf("unexpected NATS greeting %q", line)
+	}
+	var info natsInfo
+	if err := json.Unmarshal([]byte(line[len("INFO "):]), &info); err != nil {
+		return fmt.Errorf("invalid NATS info: %v", err)
+	}
+	if info.TLSRequired {
+		return errors.New("NATS server requires TLS, which is not supported")
+	}
+	n.maxPayload = info.MaxPayload
+	n.headers = n.JetStream && info.Headers
+
+	connect, err := json.Marshal(natsConnect{
+		Name:         n.Name,
+		Lang:         "go",
+		Version:      "1.0.0",
+		Protocol:     1,
+		User:         n.user,
+		Pass:         n.pass,
+		Token:        n.token,
+		Headers:      n.headers,
+		NoResponders: n.headers,
+	})
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(n.conn)
+	fmt.Fprintf(w, "CONNECT %s\r\n", connect)
+	if n.JetStream {
+		n.inbox = "_INBOX." + strings.ReplaceAll(uuid.New().String(), "-", "")
+		fmt.Fprintf(w, "SUB %s.* 1\r\n", n.inbox)
+	}
+	w.WriteString("PING\r\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return n.waitPong()
+}
+
+// publish sends a PUB of each message, then waits for the acknowledgement
+// of each of them with JetStream, else for the PONG of a PING
+func (n *NATS) publish(msgs []Message) error {
+	w := bufio.NewWriter(n.conn)
+	pending := make(map[string]uint64) // the acknowledgement subjects
+	for _, m := range msgs {
+		if m.Subject == "" || strings.ContainsAny(m.Subject, " \t\r\n") {
+			return fmt.Errorf("invalid NATS subject %q", m.Subject)
+		}
+		payload, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if n.maxPayload > 0 && int64(len(payload)) > n.maxPayload {
+			return fmt.Errorf("message %d of %d bytes exceeds the NATS max payload %d", m.Seq, len(payload), n.maxPayload)
+		}
+
+		switch {
+		case !n.JetStream:
+			fmt.Fprintf(w, "PUB %s %d\r\n", m.Subject, len(payload))
+		case !n.headers:
+			n.replies++
+			reply := n.inbox + "." + strconv.FormatUint(n.replies, 10)
+			pending[reply] = m.Seq
+			fmt.Fprintf(w, "PUB %s %s %d\r\n", m.Subject, reply, len(payload))
+		default:
+			n.replies++
+			reply := n.inbox + "." + strconv.FormatUint(n.replies, 10)
+			pending[reply] = m.Seq
+			header := "NATS/1.0\r\nNats-Msg-Id: " + m.ID.String() + "\r\n\r\n"
+			fmt.Fprintf(w, "HPUB %s %s %d %d\r\n%s", m.Subject, reply, len(header), len(header)+len(payload), header)
+		}
+		w.Write(payload)
+		w.WriteString("\r\n")
+	}
+	if !n.JetStream {
+		w.WriteString("PING\r\n")
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if !n.JetStream {
+		return n.waitPong()
+	}
+	return n.waitAcks(pending)
+}
+
+// waitAcks reads the server messages until every pending subject got its
+// JetStream acknowledgement
+func (n *NATS) waitAcks(pending map[string]uint64) error {
+	for len(pending) > 0 {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		op := strings.Fields(line)
+		if len(op) == 0 || (op[0] != "MSG" && op[0] != "HMSG") {
+			if err := n.control(line); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// MSG <subject> <sid> [reply] <size> or
+		// HMSG <subject> <sid> [reply] <header size> <size>
+		hlen, size := 0, 0
+		if op[0] == "HMSG" && (len(op) == 5 || len(op) == 6) {
+			hlen, err = strconv.Atoi(op[len(op)-2])
+		} else if op[0] != "MSG" || (len(op) != 4 && len(op) != 5) {
+			err = errors.New("unexpected arguments")
+		}
+		if err == nil {
+			size, err = strconv.Atoi(op[len(op)-1])
+		}
+		if err != nil || hlen < 0 || hlen > size {
+			return fmt.Errorf("invalid NATS message %q", line)
+		}
+		payload := make([]byte, size+2)
+		if _, err := io.ReadFull(n.r, payload); err != nil {
+			return err
+		}
+
+		seq, ok := pending[op[1]]
+		if !ok {
+			continue
+		}
+		delete(pending, op[1])
+		if status := string(payload[:hlen]); strings.HasPrefix(status, "NATS/1.0 503") {
+			return fmt.Errorf("no JetStream stream stores message %d", seq)
+		}
+		var ack jsPubAck
+		if err := json.Unmarshal(payload[hlen:size], &ack); err != nil {
+			return fmt.Errorf("invalid JetStream acknowledgement of message %d: %v", seq, err)
+		}
+		if ack.Error != nil {
+			return fmt.Errorf("JetStream refused message %d: %v", seq, ack.Error.Description)
+		}
+	}
+	return nil
+}
+
+// waitPong reads the server messages until a PONG, answering its PINGs
+func (n *NATS) waitPong() error {
+	for {
+		line, err := n.readLine()
+		if err != nil {
+			return err
+		}
+		if line == "PONG" {
+			return nil
+		}
+		if err := n.control(line); err != nil {
+			return err
+		}
+	}
+}
+
+// control handles a server message other than PONG and MSG, answering its
+// PINGs
+func (n *NATS) control(line string) error {
+	switch {
+	case line == "PING":
+		_, err := n.conn.Write([]byte("PONG\r\n"))
+		return err
+	case strings.HasPrefix(line, "-ERR"):
+		return fmt.Errorf("NATS error: %v", strings.TrimSpace(line[len("-ERR"):]))
+	case line == "+OK", strings.HasPrefix(line, "INFO "):
+		return nil
+	}
+	return fmt.Errorf("unexpected NATS message %q", line)
+}
+
+// readLine reads a protocol line without its CRLF
+func (n *NATS) readLine() (string, error) {
+	line, err := n.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
@@ -0,0 +1,238 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// natsServer is an embedded server speaking the publishing part of the
+// NATS client protocol, with a JetStream stream storing the subjects of the
+// stream prefix once per Nats-Msg-Id
+type natsServer struct {
+	net.Listener
+	token  string
+	stream string
+
+	mu       sync.Mutex
+	connects int
+	received []Message
+	ids      map[string]bool
+	pubs     int
+	dropAt   int // drops the connection at that PUB without processing it, 0 never
+}
+
+func newNATSServer(t *testing.T, token string) *natsServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	s := &natsServer{Listener: l, token: token, stream: "voting.", ids: make(map[string]bool)}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *natsServer) url() string {
+	if s.token != "" {
+		return fmt.Sprintf("nats://%v@%v", s.token, s.Addr())
+	}
+	return "nats://" + s.Addr().String()
+}
+
+func (s *natsServer) messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.received...)
+}
+
+func (s *natsServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"server_id\":\"test\",\"max_payload\":4096,\"headers\":true,\"auth_required\":%v}\r\n", s.token != "")
+
+	var headers bool
+	sid := ""
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		op := strings.Fields(line)
+		switch op[0] {
+		case "CONNECT":
+			var c natsConnect
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "CONNECT ")), &c)
+			if c.Token != s.token {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+			headers = c.Headers
+			s.mu.Lock()
+			s.connects++
+			s.mu.Unlock()
+		case "SUB":
+			sid = op[2]
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		case "PUB", "HPUB":
+			// PUB <subject> [reply] <size> or HPUB <subject> [reply] <header size> <size>
+			size, _ := strconv.Atoi(op[len(op)-1])
+			hlen, reply := 0, ""
+			if op[0] == "HPUB" {
+				hlen, _ = strconv.Atoi(op[len(op)-2])
+				if len(op) == 5 {
+					reply = op[2]
+				}
+			} else if len(op) == 4 {
+				reply = op[2]
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			var m Message
+			_ = json.Unmarshal(payload[hlen:size], &m)
+			id := ""
+			for _, h := range strings.Split(string(payload[:hlen]), "\r\n") {
+				if strings.HasPrefix(h, "Nats-Msg-Id: ") {
+					id = strings.TrimPrefix(h, "Nats-Msg-Id: ")
+				}
+			}
+
+			s.mu.Lock()
+			s.pubs++
+			drop := s.pubs == s.dropAt
+			stored := !drop && strings.HasPrefix(op[1], s.stream)
+			duplicate := id != "" && s.ids[id]
+			if stored && !duplicate {
+				s.received = append(s.received, m)
+				s.ids[id] = id != ""
+			}
+			seq := len(s.received)
+			s.mu.Unlock()
+			if drop {
+				return
+			}
+
+			switch {
+			case reply == "":
+			case stored:
+				ack := fmt.Sprintf(`{"stream":"VOTING","seq":%d,"duplicate":%v}`, seq, duplicate)
+				fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(ack), ack)
+			case headers:
+				status := "NATS/1.0 503\r\n\r\n"
+				fmt.Fprintf(conn, "HMSG %s %s %d %d\r\n%s\r\n", reply, sid, len(status), len(status), status)
+			}
+		}
+	}
+}
+
+func TestNATSPublish(t *testing.T) {
+	s := newNATSServer(t, "secret")
+	p, err := NewNATS(s.url(), time.Second)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	o := New(100)
+	o.Batch = 3
+	o.Backoff, o.MaxBackoff = time.Millisecond, time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Relay(ctx, p)
+
+	for i := 0; i < 5; i++ {
+		_, err := o.Append("voting.topic.voted", i)
+		assert.Nil(t, err)
+	}
+	waitEmpty(t, o)
+
+	received := s.messages()
+	assert.Len(t, received, 5)
+	assert.Equal(t, "voting.topic.voted", received[0].Subject)
+	assert.EqualValues(t, 1, received[0].Seq)
+	assert.EqualValues(t, 5, received[4].Seq)
+
+	// A connection lost in the middle of a batch is reopened and the batch
+	// published again
+	s.mu.Lock()
+	s.dropAt = s.pubs + 2
+	s.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		_, err := o.Append("voting.topic.deleted", i)
+		assert.Nil(t, err)
+	}
+	waitEmpty(t, o)
+
+	seqs := make(map[uint64]bool)
+	for _, m := range s.messages() {
+		seqs[m.Seq] = true
+	}
+	assert.Len(t, seqs, 8)
+	// The stream dropped the messages published again by their id
+	assert.Len(t, s.messages(), 8)
+	s.mu.Lock()
+	assert.Equal(t, 2, s.connects)
+	s.mu.Unlock()
+
+	// Payloads over the server max are refused
+	err = p.Publish(ctx, []Message{{Subject: "big", Data: json.RawMessage(`"` + strings.Repeat("x", 5000) + `"`)}})
+	assert.NotNil(t, err)
+	err = p.Publish(ctx, []Message{{Subject: "with space"}})
+	assert.NotNil(t, err)
+
+	// Messages no stream stores are not accepted
+	err = p.Publish(ctx, []Message{{Subject: "other.topic.voted", Seq: 9}})
+	assert.Contains(t, fmt.Sprint(err), "no JetStream stream stores message 9")
+}
+
+func TestNATSCorePublish(t *testing.T) {
+	s := newNATSServer(t, "")
+	p, err := NewNATS(s.url(), time.Second)
+	assert.Nil(t, err)
+	p.JetStream = false
+	defer p.Close()
+
+	// Accepted once the server received them, stored or not
+	err = p.Publish(context.Background(), []Message{{Subject: "voting.topic.voted", Seq: 1}, {Subject: "other.topic.voted", Seq: 2}})
+	assert.Nil(t, err)
+	received := s.messages()
+	assert.Len(t, received, 1)
+	assert.EqualValues(t, 1, received[0].Seq)
+}
+
+func TestNATSAuth(t *testing.T) {
+	s := newNATSServer(t, "secret")
+	p, err := NewNATS("nats://wrong@"+s.Addr().String(), time.Second)
+	assert.Nil(t, err)
+
+	err = p.Publish(context.Background(), []Message{{Subject: "s", Seq: 1}})
+	assert.Contains(t, fmt.Sprint(err), "Authorization Violation")
+	assert.Empty(t, s.messages())
+
+	for _, rawurl := range []string{"http://localhost:4222", "nats://", "%"} {
+		_, err := NewNATS(rawurl, time.Second)
+		assert.NotNil(t, err, rawurl)
+	}
+
+	p, err = NewNATS("nats://localhost", time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, "localhost:4222", p.addr)
+}
@@ -0,0 +1,184 @@
+// Package outbox publishes messages to a message queue at least once. The
+// messages are appended to an in-memory outbox while the data changes, and
+// a relay publishes them in order, removing them only once the queue
+// accepted them. The outbox is not persisted, the messages still pending
+// when the process stops without a flush are lost.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a message in the outbox. Consumers drop the duplicates of a
+// redelivery by ID or Seq.
+type Message struct {
+	ID      uuid.UUID `json:"id"`
+	Seq     uint64    `json:"seq"`
+	Subject string    `json:"subject"`
+	Time    time.Time `json:"time"`
+	// Data is the JSON payload
+	Data json.RawMessage `json:"data"`
+}
+
+// Publisher sends messages to a message queue. Publish returns nil only
+// once the queue accepted all of the messages.
+type Publisher interface {
+	Publish(ctx context.Context, msgs []Message) error
+	Close() error
+}
+
+// Outbox keeps the messages until they are published. It never drops a
+// message, the writers apply backpressure by refusing the changes while it
+// is Full. It is safe for concurrent use.
+type Outbox struct {
+	// Now returns the current time, it is replaced by tests
+	Now func() time.Time
+	// Batch is the number of messages published at once
+	Batch int
+	// Backoff is the wait before retrying a failed batch, it doubles up to
+	// MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Errorf reports the failed batches when not nil
+	Errorf func(format string, args ...interface{})
+
+	mu      sync.Mutex
+	max     int
+	seq     uint64
+	pending []Message // the oldest first
+	ready   chan struct{}
+}
+
+// New returns an empty outbox which is full with max messages
+func New(max int) *Outbox {
+	return &Outbox{
+		Now:        time.Now,
+		Batch:      100,
+		Backoff:    100 * time.Millisecond,
+		MaxBackoff: 30 * time.Second,
+		max:        max,
+		ready:      make(chan struct{}, 1),
+	}
+}
+
+// Append adds a message of the subject with the JSON encoding of v, also
+// to a full outbox. It never blocks on the publisher.
+func (o *Outbox) Append(subject string, v interface{}) (Message, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return Message{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.seq++
+	m := Message{ID: uuid.New(), Seq: o.seq, Subject: subject, Time: o.Now().UTC(), Data: data}
+	o.pending = append(o.pending, m)
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+	return m, nil
+}
+
+// Len returns the number of messages waiting to be published
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.pending)
+}
+
+// Full returns whether the outbox holds its max messages or more, then the
+// writers should refuse new changes until the relay catches up
+func (o *Outbox) Full() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return len(o.pending) >= o.max
+}
+
+// next returns the oldest messages, at most a batch
+func (o *Outbox) next() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := len(o.pending)
+	if n > o.Batch {
+		n = o.Batch
+	}
+	return append([]Message(nil), o.pending[:n]...)
+}
+
+// remove removes the n oldest messages
+func (o *Outbox) remove(n int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.pending = append(o.pending[:0], o.pending[n:]...)
+}
+
+// Relay publishes the messages in order with p until ctx is done. A failed
+// batch stays in the outbox and is published again, so messages may be
+// published more than once but are not lost while the process runs.
+func (o *Outbox) Relay(ctx context.Context, p Publisher) {
+	o.relay(ctx, p, false)
+}
+
+// Flush publishes the pending messages with p until the outbox is empty or
+// ctx is done, such as before the process stops. It returns an error when
+// messages are left. It must not run along with Relay.
+func (o *Outbox) Flush(ctx context.Context, p Publisher) error {
+	o.relay(ctx, p, true)
+	if n := o.Len(); n > 0 {
+		return fmt.Errorf("%d messages not published: %v", n, ctx.Err())
+	}
+	return nil
+}
+
+// relay publishes the messages until ctx is done, or the outbox is empty
+// when flush is true
+func (o *Outbox) relay(ctx context.Context, p Publisher, flush bool) {
+	wait := o.Backoff
+	for {
+		batch := o.next()
+		if len(batch) == 0 {
+			if flush {
+				return
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-o.ready:
+				continue
+			}
+		}
+
+		if err := p.Publish(ctx, batch); err != nil {
+			if o.Errorf != nil {
+				o.Errorf("Publish %d messages from %d err: %v", len(batch), batch[0].Seq, err)
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			if wait *= 2; wait > o.MaxBackoff {
+				wait = o.MaxBackoff
+			}
+			continue
+		}
+		wait = o.Backoff
+		o.remove(len(batch))
+	}
+}
@@ -0,0 +1,172 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// flaky is a publisher failing every other batch
+type flaky struct {
+	mu        sync.Mutex
+	calls     int
+	published []Message
+}
+
+func (p *flaky) Publish(ctx context.Context, msgs []Message) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.calls++
+	if p.calls%2 == 1 {
+		// Some messages may be published before the failure
+		p.published = append(p.published, msgs[:len(msgs)/2]...)
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, msgs...)
+	return nil
+}
+
+func (p *flaky) Close() error {
+	return nil
+}
+
+func (p *flaky) seqs() map[uint64]bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	seqs := make(map[uint64]bool)
+	for _, m := range p.published {
+		seqs[m.Seq] = true
+	}
+	return seqs
+}
+
+// waitEmpty waits until the outbox has no pending messages
+func waitEmpty(t *testing.T, o *Outbox) {
+	deadline := time.Now().Add(5 * time.Second)
+	for o.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out with %d pending messages", o.Len())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestRelayAtLeastOnce(t *testing.T) {
+	o := New(100)
+	o.Batch = 4
+	o.Backoff, o.MaxBackoff = time.Millisecond, 2*time.Millisecond
+
+	p := &flaky{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go o.Relay(ctx, p)
+
+	for i := 0; i < 10; i++ {
+		m, err := o.Append("topic.voted", map[string]int{"n": i})
+		assert.Nil(t, err)
+		assert.EqualValues(t, i+1, m.Seq)
+	}
+	waitEmpty(t, o)
+
+	// Every message is published, some twice
+	seqs := p.seqs()
+	assert.Len(t, seqs, 10)
+	assert.GreaterOrEqual(t, len(p.published), 10)
+
+	var data map[string]int
+	assert.Nil(t, json.Unmarshal(p.published[0].Data, &data))
+	assert.Equal(t, 0, data["n"])
+	assert.Equal(t, "topic.voted", p.published[0].Subject)
+}
+
+func TestOutboxFull(t *testing.T) {
+	o := New(2)
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, i >= 2, o.Full())
+		_, err := o.Append("s", i)
+		assert.Nil(t, err)
+	}
+	// Nothing is dropped
+	assert.Equal(t, 3, o.Len())
+	assert.Equal(t, true, o.Full())
+
+	_, err := o.Append("s", func() {})
+	assert.NotNil(t, err)
+}
+
+func TestFlush(t *testing.T) {
+	o := New(10)
+	o.Batch = 2
+	o.Backoff, o.MaxBackoff = time.Millisecond, time.Millisecond
+	for i := 0; i < 5; i++ {
+		_, err := o.Append("s", i)
+		assert.Nil(t, err)
+	}
+
+	// Failed batches are retried until the outbox is empty
+	p := &flaky{}
+	assert.Nil(t, o.Flush(context.Background(), p))
+	assert.Equal(t, 0, o.Len())
+	assert.Len(t, p.seqs(), 5)
+
+	// The messages left by the deadline are reported
+	_, err := o.Append("s", 5)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = o.Flush(ctx, down{})
+	assert.Contains(t, fmt.Sprint(err), "1 messages not published")
+	assert.Equal(t, 1, o.Len())
+}
+
+// down is a publisher failing every batch
+type down struct{}
+
+func (down) Publish(ctx context.Context, msgs []Message) error {
+	return errors.New("broker unavailable")
+}
+
+func (down) Close() error {
+	return nil
+}
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	s, err := NewFileSink(path)
+	assert.Nil(t, err)
+
+	o := New(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	go o.Relay(ctx, s)
+	for _, subject := range []string{"topic.created", "topic.voted", "topic.deleted"} {
+		_, err := o.Append(subject, nil)
+		assert.Nil(t, err)
+	}
+	waitEmpty(t, o)
+	cancel()
+	assert.Nil(t, s.Close())
+
+	f, err := os.Open(path)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	var subjects []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var m Message
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &m))
+		subjects = append(subjects, m.Subject)
+	}
+	assert.Equal(t, []string{"topic.created", "topic.voted", "topic.deleted"}, subjects)
+}
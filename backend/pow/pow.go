@@ -0,0 +1,247 @@
+// Package pow gates anonymous requests behind a hashcash-style proof of
+// work. The server issues signed challenges, a client solves one by finding
+// a nonce such that SHA-256(token + nonce) starts with difficulty zero bits.
+// The difficulty rises when challenges are requested faster than the load
+// threshold.
+package pow
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxDifficulty bounds the difficulty so that challenges stay solvable
+	// by a browser
+	MaxDifficulty = 32
+	// maxNonceLen bounds the nonce a client may send
+	maxNonceLen = 64
+)
+
+var (
+	// ErrInvalidChallenge means the challenge was not issued by the server
+	ErrInvalidChallenge = errors.New("invalid challenge")
+	// ErrExpiredChallenge means the challenge is too old
+	ErrExpiredChallenge = errors.New("expired challenge")
+	// ErrReusedChallenge means the challenge was already solved once
+	ErrReusedChallenge = errors.New("challenge already used")
+	// ErrInsufficientWork means the nonce does not solve the challenge
+	ErrInsufficientWork = errors.New("insufficient proof of work")
+)
+
+// Challenge is a signed puzzle handed to a client
+type Challenge struct {
+	Token      string    `json:"token"`
+	Difficulty int       `json:"difficulty"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// Config defines the challenges issued by a Gate
+type Config struct {
+	// Secret signs the challenges, a random secret is generated when empty
+	Secret []byte
+	// Difficulty is the number of leading zero bits required without load
+	Difficulty int
+	// MaxDifficulty caps the difficulty under load
+	MaxDifficulty int
+	// TTL is how long a challenge may be solved
+	TTL time.Duration
+	// LoadWindow is the period challenge requests are counted over
+	LoadWindow time.Duration
+	// LoadThreshold is the number of challenges per window above which the
+	// difficulty rises by one bit each time the rate doubles, zero keeps the
+	// difficulty fixed
+	LoadThreshold int
+}
+
+// Gate issues and verifies challenges. It is safe for concurrent use.
+type Gate struct {
+	cfg Config
+
+	// Now returns the current time, tests may replace it
+	Now func() time.Time
+
+	mu         sync.Mutex
+	windowFrom time.Time
+	issued     int
+	lastIssued int
+	used       map[string]time.Time
+	lastSweep  time.Time
+}
+
+// New creates a Gate from its configuration
+func New(cfg Config) (*Gate, error) {
+	if cfg.Difficulty < 1 || cfg.Difficulty > MaxDifficulty {
+		return nil, fmt.Errorf("proof of work difficulty must be within [1, %d]", MaxDifficulty)
+	}
+	if cfg.MaxDifficulty < cfg.Difficulty {
+		cfg.MaxDifficulty = cfg.Difficulty
+	}
+	if cfg.MaxDifficulty > MaxDifficulty {
+		return nil, fmt.Errorf("proof of work max difficulty must be within [1, %d]", MaxDifficulty)
+	}
+	if cfg.TTL <= 0 || cfg.LoadWindow <= 0 || cfg.LoadThreshold < 0 {
+		return nil, fmt.Errorf("proof of work ttl and load window must be positive")
+	}
+	if len(cfg.Secret) == 0 {
+		cfg.Secret = make([]byte, 32)
+		if _, err := rand.Read(cfg.Secret); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Gate{cfg: cfg, Now: time.Now, used: make(map[string]time.Time)}, nil
+}
+
+// Issue returns a new challenge at the current difficulty
+func (g *Gate) Issue() (Challenge, error) {
+	now := g.Now()
+
+	g.mu.Lock()
+	difficulty := g.difficulty(now)
+	g.issued++
+	g.mu.Unlock()
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return Challenge{}, err
+	}
+
+	expiresAt := now.Add(g.cfg.TTL).Truncate(time.Second)
+	payload := fmt.Sprintf("%d.%d.%s", difficulty, expiresAt.Unix(), hex.EncodeToString(salt))
+	return Challenge{
+		Token:      payload + "." + g.sign(payload),
+		Difficulty: difficulty,
+		ExpiresAt:  expiresAt.UTC(),
+	}, nil
+}
+
+// difficulty returns the difficulty for the load of the last full window.
+// The caller must hold the lock.
+func (g *Gate) difficulty(now time.Time) int {
+	if elapsed := now.Sub(g.windowFrom); elapsed >= g.cfg.LoadWindow {
+		if elapsed >= 2*g.cfg.LoadWindow {
+			// The last window had no challenge requests
+			g.lastIssued = 0
+		} else {
+			g.lastIssued = g.issued
+		}
+		g.issued = 0
+		g.windowFrom = now.Truncate(g.cfg.LoadWindow)
+	}
+
+	// Rate of the window so far or the last one, whichever is higher
+	load := g.issued
+	if g.lastIssued > load {
+		load = g.lastIssued
+	}
+
+	difficulty := g.cfg.Difficulty
+	if g.cfg.LoadThreshold > 0 && load >= g.cfg.LoadThreshold {
+		difficulty += 1 + int(math.Log2(float64(load)/float64(g.cfg.LoadThreshold)))
+	}
+	if difficulty > g.cfg.MaxDifficulty {
+		difficulty = g.cfg.MaxDifficulty
+	}
+	return difficulty
+}
+
+// Verify checks that nonce solves the challenge token, a challenge can be
+// solved only once
+func (g *Gate) Verify(token, nonce string) error {
+	i := strings.LastIndexByte(token, '.')
+	if i < 0 || !hmac.Equal([]byte(token[i+1:]), []byte(g.sign(token[:i]))) {
+		return ErrInvalidChallenge
+	}
+
+	fields := strings.Split(token[:i], ".")
+	if len(fields) != 3 {
+		return ErrInvalidChallenge
+	}
+	difficulty, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	expires, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return ErrInvalidChallenge
+	}
+	expiresAt := time.Unix(expires, 0)
+
+	now := g.Now()
+	if now.After(expiresAt) {
+		return ErrExpiredChallenge
+	}
+	if len(nonce) > maxNonceLen || LeadingZeroBits(token, nonce) < difficulty {
+		return ErrInsufficientWork
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.sweep(now)
+	if _, ok := g.used[token]; ok {
+		return ErrReusedChallenge
+	}
+	g.used[token] = expiresAt
+	return nil
+}
+
+// sweep forgets the used challenges which expired, at most once per TTL.
+// The caller must hold the lock.
+func (g *Gate) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.cfg.TTL {
+		return
+	}
+	g.lastSweep = now
+
+	for token, expiresAt := range g.used {
+		if now.After(expiresAt) {
+			delete(g.used, token)
+		}
+	}
+}
+
+// sign returns the signature of a challenge payload
+func (g *Gate) sign(payload string) string {
+	mac := hmac.New(sha256.New, g.cfg.Secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// LeadingZeroBits returns the number of leading zero bits of
+// SHA-256(token + nonce)
+func LeadingZeroBits(token, nonce string) int {
+	sum := sha256.Sum256([]byte(token + nonce))
+
+	n := 0
+	for _, b := range sum {
+		n += bits.LeadingZeros8(b)
+		if b != 0 {
+			break
+		}
+	}
+	return n
+}
+
+// Solve finds a nonce solving the challenge, it is meant for tests and
+// command line clients
+func Solve(c Challenge) string {
+	for i := 0; ; i++ {
+		nonce := strconv.Itoa(i)
+		if LeadingZeroBits(c.Token, nonce) >= c.Difficulty {
+			return nonce
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package pow
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newGate(t *testing.T, cfg Config) (*Gate, *time.Time) {
+	g, err := New(cfg)
+	assert.Nil(t, err)
+
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	g.Now = func() time.Time { return now }
+	return g, &now
+}
+
+func TestVerify(t *testing.T) {
+	g, now := newGate(t, Config{Difficulty: 8, TTL: time.Minute, LoadWindow: time.Second})
+
+	c, err := g.Issue()
+	assert.Nil(t, err)
+	assert.Equal(t, 8, c.Difficulty)
+	assert.Equal(t, now.Add(time.Minute), c.ExpiresAt)
+
+	nonce := Solve(c)
+	assert.True(t, LeadingZeroBits(c.Token, nonce) >= 8)
+
+	// Find a nonce which does not solve the challenge
+	bad := "x"
+	for LeadingZeroBits(c.Token, bad) >= 8 {
+		bad += "x"
+	}
+	assert.Equal(t, ErrInsufficientWork, g.Verify(c.Token, bad))
+	assert.Equal(t, ErrInsufficientWork, g.Verify(c.Token, strings.Repeat("0", maxNonceLen+1)))
+
+	assert.Nil(t, g.Verify(c.Token, nonce))
+	assert.Equal(t, ErrReusedChallenge, g.Verify(c.Token, nonce))
+
+	// Tampered or foreign challenges
+	assert.Equal(t, ErrInvalidChallenge, g.Verify("1"+c.Token[1:], nonce))
+	assert.Equal(t, ErrInvalidChallenge, g.Verify("", nonce))
+	other, _ := newGate(t, Config{Difficulty: 8, TTL: time.Minute, LoadWindow: time.Second})
+	assert.Equal(t, ErrInvalidChallenge, other.Verify(c.Token, nonce))
+
+	c, err = g.Issue()
+	assert.Nil(t, err)
+	*now = now.Add(2 * time.Minute)
+	assert.Equal(t, ErrExpiredChallenge, g.Verify(c.Token, Solve(c)))
+}
+
+func TestDifficultyUnderLoad(t *testing.T) {
+	g, now := newGate(t, Config{Difficulty: 4, MaxDifficulty: 7, TTL: time.Minute, LoadWindow: time.Second, LoadThreshold: 2})
+
+	difficulties := func(n int) []int {
+		var d []int
+		for i := 0; i < n; i++ {
+			c, err := g.Issue()
+			assert.Nil(t, err)
+			d = append(d, c.Difficulty)
+		}
+		return d
+	}
+
+	// Loads 0, 1, 2, 3, 4, ..., 8 and 16 give 4, 4, 5, 5, 6, ..., 7, capped
+	assert.Equal(t, []int{4, 4, 5, 5, 6, 6, 6, 6, 7}, difficulties(9))
+
+	// The next window remembers the load of the last one
+	*now = now.Add(time.Second)
+	assert.Equal(t, []int{7}, difficulties(1))
+
+	// After an idle window the difficulty drops back
+	*now = now.Add(3 * time.Second)
+	assert.Equal(t, []int{4}, difficulties(1))
+}
+
+func TestNew(t *testing.T) {
+	for _, cfg := range []Config{
+		{Difficulty: 0, TTL: time.Minute, LoadWindow: time.Second},
+		{Difficulty: MaxDifficulty + 1, TTL: time.Minute, LoadWindow: time.Second},
+		{Difficulty: 8, MaxDifficulty: MaxDifficulty + 1, TTL: time.Minute, LoadWindow: time.Second},
+		{Difficulty: 8, LoadWindow: time.Second},
+		{Difficulty: 8, TTL: time.Minute},
+	} {
+		_, err := New(cfg)
+		assert.NotNil(t, err, "%+v", cfg)
+	}
+}
@@ -0,0 +1,64 @@
+// Package scheduler fires the time based events of the topics, such as
+// the closing of their voting windows.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+)
+
+// Scheduler publishes a PollClosed event for each topic whose voting
+// window closed since the previous tick. Topics created already closed
+// get no event.
+type Scheduler struct {
+	bus      *events.Bus
+	interval time.Duration
+	last     time.Time
+
+	// Now returns the current time, tests may replace it
+	Now func() time.Time
+}
+
+// New returns a scheduler publishing to bus every interval
+func New(bus *events.Bus, interval time.Duration) *Scheduler {
+	return &Scheduler{bus: bus, interval: interval, Now: time.Now}
+}
+
+// Run ticks until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	s.Tick()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.Tick()
+		}
+	}
+}
+
+// Tick publishes the events due since the previous tick, and returns them.
+// The first tick only starts the clock.
+func (s *Scheduler) Tick() []events.Event {
+	now := s.Now()
+	last := s.last
+	s.last = now
+	if last.IsZero() {
+		return nil
+	}
+
+	var fired []events.Event
+	for _, t := range cache.ListTopics(cache.ClosedBetween(last, now)) {
+		e := events.New(events.PollClosed, t.UID, t)
+		e.Time = *t.ClosesAt
+		s.bus.Publish(e)
+		fired = append(fired, e)
+	}
+	return fired
+}
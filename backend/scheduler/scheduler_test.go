@@ -0,0 +1,49 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTick(t *testing.T) {
+	cache.Reset()
+
+	now := time.Now().Add(time.Hour).Truncate(time.Second).UTC()
+	closes1, closes2 := now.Add(time.Minute), now.Add(2*time.Minute)
+	uid1, err := cache.NewTopic(cache.Topic{Name: "poll-1", ClosesAt: &closes1})
+	assert.Equal(t, nil, err, "Create topic failed")
+	uid2, err := cache.NewTopic(cache.Topic{Name: "poll-2", ClosesAt: &closes2})
+	assert.Equal(t, nil, err, "Create topic failed")
+	_, err = cache.CreateTopic("poll-3")
+	assert.Equal(t, nil, err, "Create topic failed")
+
+	bus := events.NewBus()
+	var published []events.Event
+	bus.Subscribe(func(e events.Event) { published = append(published, e) })
+
+	s := New(bus, time.Second)
+	s.Now = func() time.Time { return now }
+	assert.Empty(t, s.Tick(), "The first tick starts the clock")
+
+	now = closes1
+	fired := s.Tick()
+	assert.Len(t, fired, 1)
+	assert.Equal(t, events.PollClosed, fired[0].Type)
+	assert.Equal(t, uid1, fired[0].Topic)
+	assert.Equal(t, closes1, fired[0].Time)
+
+	// Each poll closes once
+	now = now.Add(30 * time.Second)
+	assert.Empty(t, s.Tick())
+
+	now = now.Add(time.Hour)
+	fired = s.Tick()
+	assert.Len(t, fired, 1)
+	assert.Equal(t, uid2, fired[0].Topic)
+
+	assert.Len(t, published, 2)
+}
@@ -0,0 +1,293 @@
+// Package tally counts ballots by instant-runoff, Borda count, Schulze
+// (Condorcet) and approval voting. Results are deterministic: they do not
+// depend on the ballots order and ties are broken by option id, the lower
+// id first.
+package tally
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Method defines how ballots are counted
+type Method string
+
+const (
+	// IRV eliminates the option with the fewest first preferences until
+	// one option has a majority of the ballots left
+	IRV Method = "irv"
+	// Borda gives n-1 points to the first choice of n options, n-2 to the
+	// second and so on, unranked options get no point
+	Borda Method = "borda"
+	// Schulze ranks the options by the strongest paths of pairwise wins,
+	// it always elects the Condorcet winner when there is one
+	Schulze Method = "schulze"
+	// Approval counts the ballots approving each option, the order of a
+	// ballot does not matter
+	Approval Method = "approval"
+)
+
+// ParseMethod parses the method name
+func ParseMethod(s string) (Method, error) {
+	switch m := Method(strings.ToLower(s)); m {
+	case IRV, Borda, Schulze, Approval:
+		return m, nil
+	}
+	return "", fmt.Errorf("unknown tally method %q", s)
+}
+
+// Ranked reports whether the method counts the order of the ballots
+func (m Method) Ranked() bool {
+	return m == IRV || m == Borda || m == Schulze
+}
+
+// ErrInvalidBallot is returned when a ballot is empty, names an unknown
+// option or names an option twice
+var ErrInvalidBallot = errors.New("invalid ballot")
+
+// Ballot lists option ids, the most preferred first. Options are numbered
+// from 0, unlisted options are ranked last.
+type Ballot []int
+
+// CheckBallot returns ErrInvalidBallot unless b is a valid ballot of the
+// given number of options
+func CheckBallot(options int, b Ballot) error {
+	if len(b) == 0 || len(b) > options {
+		return ErrInvalidBallot
+	}
+
+	seen := make([]bool, options)
+	for _, id := range b {
+		if id < 0 || id >= options || seen[id] {
+			return ErrInvalidBallot
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// Round is an instant-runoff counting round
+type Round struct {
+	// Counts are the ballots per option, eliminated options count 0
+	Counts []uint64 `json:"counts"`
+	// Exhausted counts the ballots without any option left
+	Exhausted uint64 `json:"exhausted"`
+	// Eliminated is the option eliminated at the end of the round
+	Eliminated *int `json:"eliminated,omitempty"`
+	// Elected is the winner, set in the last round
+	Elected *int `json:"elected,omitempty"`
+}
+
+// Result is the outcome of a count
+type Result struct {
+	Method  Method `json:"method"`
+	Ballots int    `json:"ballots"`
+	Winner  int    `json:"winner"`
+	// Ranking lists all option ids, the winner first
+	Ranking []int `json:"ranking"`
+	// Scores per option: final round counts for IRV, points for Borda,
+	// pairwise wins for Schulze and approvals for Approval
+	Scores []uint64 `json:"scores"`
+	// Rounds are the instant-runoff rounds
+	Rounds []Round `json:"rounds,omitempty"`
+	// Pairwise counts the ballots preferring option i to option j for Schulze
+	Pairwise [][]uint64 `json:"pairwise,omitempty"`
+}
+
+// Count counts the ballots of a poll with the given number of options
+func Count(method Method, options int, ballots []Ballot) (Result, error) {
+	if options < 1 {
+		return Result{}, errors.New("no option to count")
+	}
+	for _, b := range ballots {
+		if err := CheckBallot(options, b); err != nil {
+			return Result{}, err
+		}
+	}
+
+	var r Result
+	switch method {
+	case IRV:
+		r = countIRV(options, ballots)
+	case Borda:
+		r = countBorda(options, ballots)
+	case Schulze:
+		r = countSchulze(options, ballots)
+	case Approval:
+		r = countApproval(options, ballots)
+	default:
+		return Result{}, fmt.Errorf("unknown tally method %q", method)
+	}
+
+	r.Method = method
+	r.Ballots = len(ballots)
+	r.Winner = r.Ranking[0]
+	return r, nil
+}
+
+// rankByScores returns the option ids by descending scores, ties by id
+func rankByScores(scores []uint64) []int {
+	ranking := make([]int, len(scores))
+	for i := range ranking {
+		ranking[i] = i
+	}
+	sort.SliceStable(ranking, func(i, j int) bool { return scores[ranking[i]] > scores[ranking[j]] })
+	return ranking
+}
+
+func countApproval(options int, ballots []Ballot) Result {
+	scores := make([]uint64, options)
+	for _, b := range ballots {
+		for _, id := range b {
+			scores[id]++
+		}
+	}
+	return Result{Ranking: rankByScores(scores), Scores: scores}
+}
+
+func countBorda(options int, ballots []Ballot) Result {
+	scores := make([]uint64, options)
+	for _, b := range ballots {
+		for i, id := range b {
+			scores[id] += uint64(options - 1 - i)
+		}
+	}
+	return Result{Ranking: rankByScores(scores), Scores: scores}
+}
+
+func countSchulze(options int, ballots []Ballot) Result {
+	// d[i][j] counts the ballots preferring i to j
+	d := make([][]uint64, options)
+	for i := range d {
+		d[i] = make([]uint64, options)
+	}
+	pos := make([]int, options)
+	for _, b := range ballots {
+		for i := range pos {
+			pos[i] = len(b)
+		}
+		for i, id := range b {
+			pos[id] = i
+		}
+		for i := 0; i < options; i++ {
+			for j := 0; j < options; j++ {
+				if pos[i] < pos[j] {
+					d[i][j]++
+				}
+			}
+		}
+	}
+
+	// p[i][j] is the strength of the strongest path from i to j
+	p := make([][]uint64, options)
+	for i := range p {
+		p[i] = make([]uint64, options)
+		for j := range p[i] {
+			if i != j && d[i][j] > d[j][i] {
+				p[i][j] = d[i][j]
+			}
+		}
+	}
+	for k := 0; k < options; k++ {
+		for i := 0; i < options; i++ {
+			if i == k {
+				continue
+			}
+			for j := 0; j < options; j++ {
+				if j == k || j == i {
+					continue
+				}
+				if s := min(p[i][k], p[k][j]); s > p[i][j] {
+					p[i][j] = s
+				}
+			}
+		}
+	}
+
+	// The Schulze relation is transitive, so the wins order the options
+	scores := make([]uint64, options)
+	for i := 0; i < options; i++ {
+		for j := 0; j < options; j++ {
+			if p[i][j] > p[j][i] {
+				scores[i]++
+			}
+		}
+	}
+	return Result{Ranking: rankByScores(scores), Scores: scores, Pairwise: d}
+}
+
+func countIRV(options int, ballots []Ballot) Result {
+	eliminated := make([]bool, options)
+	var rounds []Round
+	var order []int // eliminated options, first eliminated first
+
+	// fewer reports whether option i goes out before option j when both
+	// have the fewest votes: the one with fewer votes in the latest round
+	// they differ, then the higher id
+	fewer := func(i, j int) bool {
+		for k := len(rounds) - 1; k >= 0; k-- {
+			if rounds[k].Counts[i] != rounds[k].Counts[j] {
+				return rounds[k].Counts[i] < rounds[k].Counts[j]
+			}
+		}
+		return i > j
+	}
+
+	for {
+		round := Round{Counts: make([]uint64, options)}
+		for _, b := range ballots {
+			counted := false
+			for _, id := range b {
+				if !eliminated[id] {
+					round.Counts[id]++
+					counted = true
+					break
+				}
+			}
+			if !counted {
+				round.Exhausted++
+			}
+		}
+		active := uint64(len(ballots)) - round.Exhausted
+
+		leader, last, remaining := -1, -1, 0
+		for id := 0; id < options; id++ {
+			if eliminated[id] {
+				continue
+			}
+			remaining++
+			if leader < 0 || round.Counts[id] > round.Counts[leader] {
+				leader = id
+			}
+			if last < 0 || round.Counts[id] < round.Counts[last] ||
+				(round.Counts[id] == round.Counts[last] && fewer(id, last)) {
+				last = id
+			}
+		}
+
+		if remaining == 1 || 2*round.Counts[leader] > active {
+			round.Elected = &leader
+			rounds = append(rounds, round)
+
+			// The winner, then the options left by final count, then the
+			// eliminated options, the last eliminated first
+			ranking := []int{leader}
+			for _, id := range rankByScores(round.Counts) {
+				if id != leader && !eliminated[id] {
+					ranking = append(ranking, id)
+				}
+			}
+			for i := len(order) - 1; i >= 0; i-- {
+				ranking = append(ranking, order[i])
+			}
+			return Result{Ranking: ranking, Scores: round.Counts, Rounds: rounds}
+		}
+
+		round.Eliminated = &last
+		rounds = append(rounds, round)
+		eliminated[last] = true
+		order = append(order, last)
+	}
+}
@@ -0,0 +1,281 @@
+package tally
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var methods = []Method{IRV, Borda, Schulze, Approval}
+
+// ballots parses ballots written as strings of option letters
+func ballots(spec map[string]int) []Ballot {
+	keys := make([]string, 0, len(spec))
+	for k := range spec {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var list []Ballot
+	for _, k := range keys {
+		b := make(Ballot, len(k))
+		for i, c := range k {
+			b[i] = int(c - 'a')
+		}
+		for n := 0; n < spec[k]; n++ {
+			list = append(list, b)
+		}
+	}
+	return list
+}
+
+// randomBallots returns n valid random ballots of the given options
+func randomBallots(r *rand.Rand, options, n int) []Ballot {
+	list := make([]Ballot, n)
+	for i := range list {
+		list[i] = Ballot(r.Perm(options)[:1+r.Intn(options)])
+	}
+	return list
+}
+
+func TestParseMethod(t *testing.T) {
+	for _, m := range methods {
+		v, err := ParseMethod(string(m))
+		assert.Equal(t, nil, err)
+		assert.Equal(t, m, v)
+	}
+	_, err := ParseMethod("plurality")
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, false, Approval.Ranked())
+	assert.Equal(t, true, Schulze.Ranked())
+}
+
+func TestCheckBallot(t *testing.T) {
+	assert.Equal(t, nil, CheckBallot(3, Ballot{2, 0}))
+	assert.Equal(t, ErrInvalidBallot, CheckBallot(3, Ballot{}))
+	assert.Equal(t, ErrInvalidBallot, CheckBallot(3, Ballot{3}))
+	assert.Equal(t, ErrInvalidBallot, CheckBallot(3, Ballot{-1}))
+	assert.Equal(t, ErrInvalidBallot, CheckBallot(3, Ballot{1, 1}))
+
+	_, err := Count(IRV, 3, []Ballot{{0}, {0, 0}})
+	assert.Equal(t, ErrInvalidBallot, err)
+	_, err = Count("plurality", 3, nil)
+	assert.NotEqual(t, nil, err)
+	_, err = Count(IRV, 0, nil)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestCountIRV(t *testing.T) {
+	// c is eliminated first, its ballots move to b which wins
+	r, err := Count(IRV, 3, ballots(map[string]int{"abc": 4, "bac": 3, "cba": 2}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, r.Winner)
+	assert.Equal(t, []int{1, 0, 2}, r.Ranking)
+	assert.Len(t, r.Rounds, 2)
+	assert.Equal(t, []uint64{4, 3, 2}, r.Rounds[0].Counts)
+	assert.Equal(t, 2, *r.Rounds[0].Eliminated)
+	assert.Equal(t, []uint64{4, 5, 0}, r.Rounds[1].Counts)
+	assert.Equal(t, 1, *r.Rounds[1].Elected)
+
+	// Ballots without any option left are exhausted
+	r, err = Count(IRV, 3, ballots(map[string]int{"a": 3, "b": 2, "c": 2}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, r.Winner)
+	assert.EqualValues(t, 2, r.Rounds[1].Exhausted)
+
+	// Tied last options: the one with fewer votes in an earlier round goes
+	// out, then the higher id
+	r, err = Count(IRV, 4, ballots(map[string]int{"a": 5, "b": 4, "cb": 3, "d": 3}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, *r.Rounds[0].Eliminated)
+	assert.Equal(t, 2, *r.Rounds[1].Eliminated)
+	assert.Equal(t, 1, r.Winner)
+}
+
+func TestCountBorda(t *testing.T) {
+	r, err := Count(Borda, 3, ballots(map[string]int{"abc": 2, "bca": 2, "c": 1}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []uint64{4, 6, 4}, r.Scores)
+	assert.Equal(t, []int{1, 0, 2}, r.Ranking)
+}
+
+func TestCountSchulze(t *testing.T) {
+	// The example of Schulze's paper, e wins
+	r, err := Count(Schulze, 5, ballots(map[string]int{
+		"acbed": 5, "adecb": 5, "bedac": 8, "cabed": 3,
+		"caebd": 7, "cbade": 2, "dceba": 7, "ebadc": 8,
+	}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int{4, 0, 2, 1, 3}, r.Ranking)
+	assert.EqualValues(t, 20, r.Pairwise[0][1])
+	assert.EqualValues(t, 25, r.Pairwise[1][0])
+
+	// Condorcet cycle of equal strength, ties keep the id order
+	r, err = Count(Schulze, 3, ballots(map[string]int{"abc": 1, "bca": 1, "cab": 1}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []int{0, 1, 2}, r.Ranking)
+}
+
+func TestCountApproval(t *testing.T) {
+	r, err := Count(Approval, 3, ballots(map[string]int{"ab": 2, "cb": 1, "c": 2}))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []uint64{2, 3, 3}, r.Scores)
+	assert.Equal(t, []int{1, 2, 0}, r.Ranking)
+}
+
+func TestCountNoBallots(t *testing.T) {
+	for _, m := range methods {
+		r, err := Count(m, 3, nil)
+		assert.Equal(t, nil, err)
+		assert.Equal(t, 0, r.Winner, string(m))
+		assert.Equal(t, []int{0, 1, 2}, r.Ranking, string(m))
+	}
+}
+
+func TestCountProperties(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	for n := 0; n < 500; n++ {
+		options := 1 + r.Intn(6)
+		list := randomBallots(r, options, r.Intn(40))
+
+		for _, m := range methods {
+			result, err := Count(m, options, list)
+			assert.Equal(t, nil, err)
+
+			// The ranking is a permutation of the options, winner first
+			ranking := append([]int(nil), result.Ranking...)
+			sort.Ints(ranking)
+			for i := range ranking {
+				assert.Equal(t, i, ranking[i], string(m))
+			}
+			assert.Equal(t, result.Ranking[0], result.Winner, string(m))
+
+			// The ballots order does not matter
+			shuffled := append([]Ballot(nil), list...)
+			r.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+			again, err := Count(m, options, shuffled)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, result, again, string(m))
+		}
+	}
+}
+
+func TestCountUnanimity(t *testing.T) {
+	r := rand.New(rand.NewSource(7))
+	for n := 0; n < 200; n++ {
+		options := 2 + r.Intn(5)
+		favorite := r.Intn(options)
+		list := randomBallots(r, options, 1+r.Intn(30))
+		for _, b := range list {
+			// Move the favorite first, or put it in place of the first choice
+			i := 0
+			for i < len(b)-1 && b[i] != favorite {
+				i++
+			}
+			if b[i] == favorite {
+				copy(b[1:i+1], b[:i])
+			}
+			b[0] = favorite
+		}
+
+		for _, m := range []Method{IRV, Borda, Schulze} {
+			result, err := Count(m, options, list)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, favorite, result.Winner, string(m))
+		}
+	}
+}
+
+func TestCountMajority(t *testing.T) {
+	r := rand.New(rand.NewSource(11))
+	for n := 0; n < 200; n++ {
+		options := 2 + r.Intn(5)
+		list := randomBallots(r, options, 1+r.Intn(30))
+		first := make([]int, options)
+		for _, b := range list {
+			first[b[0]]++
+		}
+
+		result, err := Count(IRV, options, list)
+		assert.Equal(t, nil, err)
+		for id, count := range first {
+			if 2*count > len(list) {
+				// A first preference majority wins in the first round
+				assert.Equal(t, id, result.Winner)
+				assert.Len(t, result.Rounds, 1)
+			}
+		}
+
+		// Each round counts every ballot once
+		for _, round := range result.Rounds {
+			total := round.Exhausted
+			for _, c := range round.Counts {
+				total += c
+			}
+			assert.EqualValues(t, len(list), total)
+		}
+
+		// Every round but the last eliminates one option, the last elects
+		last := len(result.Rounds) - 1
+		for i, round := range result.Rounds {
+			assert.Equal(t, i < last, round.Eliminated != nil)
+			assert.Equal(t, i == last, round.Elected != nil)
+		}
+		assert.Less(t, last, options)
+	}
+}
+
+func TestCountCondorcet(t *testing.T) {
+	r := rand.New(rand.NewSource(13))
+	for n := 0; n < 300; n++ {
+		options := 2 + r.Intn(5)
+		list := randomBallots(r, options, 1+r.Intn(30))
+
+		result, err := Count(Schulze, options, list)
+		assert.Equal(t, nil, err)
+
+		// A Condorcet winner beats every other option pairwise
+		for i := 0; i < options; i++ {
+			wins := true
+			for j := 0; j < options; j++ {
+				if i != j && result.Pairwise[i][j] <= result.Pairwise[j][i] {
+					wins = false
+				}
+			}
+			if wins {
+				assert.Equal(t, i, result.Winner)
+			}
+		}
+	}
+}
+
+func TestCountScoreTotals(t *testing.T) {
+	r := rand.New(rand.NewSource(17))
+	for n := 0; n < 200; n++ {
+		options := 1 + r.Intn(6)
+		list := randomBallots(r, options, r.Intn(30))
+
+		var points, approvals uint64
+		for _, b := range list {
+			for i := range b {
+				points += uint64(options - 1 - i)
+			}
+			approvals += uint64(len(b))
+		}
+
+		result, _ := Count(Borda, options, list)
+		assert.Equal(t, points, sum(result.Scores))
+		result, _ = Count(Approval, options, list)
+		assert.Equal(t, approvals, sum(result.Scores))
+	}
+}
+
+func sum(scores []uint64) uint64 {
+	var total uint64
+	for _, s := range scores {
+		total += s
+	}
+	return total
+}
@@ -0,0 +1,184 @@
+// Package validation checks user supplied text fields with Unicode aware
+// rules and reports field-level errors.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Rule defines the constraints of a text field
+type Rule struct {
+	// Field is the JSON name of the field reported in errors
+	Field string `json:"field"`
+	// Label names the field in error messages, e.g. "Topic name"
+	Label string `json:"label"`
+	// Required rejects empty values (after trimming)
+	Required bool `json:"required"`
+	// MinLen and MaxLen bound the length in user-perceived characters,
+	// zero means no bound
+	MinLen int `json:"minLen"`
+	MaxLen int `json:"maxLen"`
+	// Trim removes leading and trailing whitespace
+	Trim bool `json:"trim"`
+	// Multiline allows line feed and tab characters
+	Multiline bool `json:"multiline"`
+}
+
+// FieldError defines why a field is invalid
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors is a list of field errors
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fe := range e {
+		messages[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Add appends a field error
+func (e *Errors) Add(field, message string) {
+	*e = append(*e, FieldError{Field: field, Message: message})
+}
+
+// Apply normalizes value to Unicode NFC, trims it if configured, and checks
+// it against the rule. It returns the normalized value, and the field error
+// or nil when value is valid.
+func (r Rule) Apply(value string) (string, *FieldError) {
+	if !utf8.ValidString(value) {
+		return value, &FieldError{Field: r.Field, Message: r.Label + " is not valid UTF-8"}
+	}
+
+	value = norm.NFC.String(value)
+	if r.Trim {
+		value = strings.TrimSpace(value)
+	}
+
+	if value == "" {
+		if r.Required {
+			return value, &FieldError{Field: r.Field, Message: r.Label + " is required"}
+		}
+		return value, nil
+	}
+
+	for _, c := range value {
+		if !allowed(c, r.Multiline) {
+			return value, &FieldError{Field: r.Field, Message: r.Label + " has invalid characters"}
+		}
+	}
+
+	length := Length(value)
+	if r.MaxLen > 0 && length > r.MaxLen {
+		return value, &FieldError{Field: r.Field, Message: r.Label + " over length"}
+	}
+	if r.MinLen > 0 && length < r.MinLen {
+		return value, &FieldError{Field: r.Field, Message: r.Label + " under length"}
+	}
+	return value, nil
+}
+
+// allowed reports whether c may appear in a field. Control characters are
+// rejected except line feed and tab in multiline fields, and so are the
+// bidirectional overrides which can disguise text.
+func allowed(c rune, multiline bool) bool {
+	switch {
+	case c == '\n' || c == '\t':
+		return multiline
+	case c == '\r':
+		return multiline
+	case unicode.IsControl(c):
+		return false
+	case c >= 0x202A && c <= 0x202E, c >= 0x2066 && c <= 0x2069:
+		return false
+	case c == utf8.RuneError:
+		return false
+	}
+	return true
+}
+
+// Length returns the number of user-perceived characters in s. It
+// approximates Unicode grapheme clusters: combining marks, variation
+// selectors, emoji modifiers and zero-width-joined sequences extend the
+// previous character, and regional indicators count one per flag pair.
+func Length(s string) int {
+	var (
+		n              int
+		joined         bool
+		regionalIsOpen bool
+	)
+	for _, c := range s {
+		switch {
+		case joined:
+			// Character after a zero width joiner
+			joined = false
+		case c == 0x200D:
+			joined = n > 0
+		case unicode.In(c, unicode.Mn, unicode.Me, unicode.Mc):
+		case c >= 0xFE00 && c <= 0xFE0F, c >= 0xE0100 && c <= 0xE01EF:
+			// Variation selectors
+		case c >= 0x1F3FB && c <= 0x1F3FF:
+			// Emoji skin tone modifiers
+		case c >= 0x1F1E6 && c <= 0x1F1FF:
+			// Regional indicators pair up into flags
+			if regionalIsOpen {
+				regionalIsOpen = false
+			} else {
+				regionalIsOpen = true
+				n++
+			}
+			continue
+		default:
+			n++
+		}
+		regionalIsOpen = false
+	}
+	return n
+}
+
+// Rules is a set of rules keyed by field
+type Rules map[string]Rule
+
+// LoadRules reads a JSON array of rules
+func LoadRules(r io.Reader) (Rules, error) {
+	var list []Rule
+	if err := json.NewDecoder(r).Decode(&list); err != nil {
+		return nil, err
+	}
+
+	rules := make(Rules, len(list))
+	for _, rule := range list {
+		if rule.Field == "" {
+			return nil, errors.New("rule without field")
+		}
+		if rule.MaxLen < 0 || rule.MinLen < 0 || (rule.MaxLen > 0 && rule.MinLen > rule.MaxLen) {
+			return nil, fmt.Errorf("rule %q has invalid length bounds", rule.Field)
+		}
+		rules[rule.Field] = rule
+	}
+	return rules, nil
+}
+
+// LoadRuleFile reads a JSON array of rules from a file
+func LoadRuleFile(path string) (Rules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return LoadRules(f)
+}
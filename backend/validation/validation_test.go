@@ -0,0 +1,89 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLength(t *testing.T) {
+	tests := []struct {
+		s        string
+		expected int
+	}{
+		{"", 0},
+		{"abc", 3},
+		{"投票主題", 4},
+		// e + combining acute accent
+		{"e\u0301", 1},
+		// thumbs up + skin tone modifier
+		{"\U0001F44D\U0001F3FD", 1},
+		// family: man ZWJ woman ZWJ girl
+		{"\U0001F468\u200d\U0001F469\u200d\U0001F467", 1},
+		// heart + variation selector
+		{"\u2764\ufe0f", 1},
+		// two flags: TW, JP
+		{"\U0001F1F9\U0001F1FC\U0001F1EF\U0001F1F5", 2},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Length(test.s), test.s)
+	}
+}
+
+func TestRuleApply(t *testing.T) {
+	rule := Rule{Field: "name", Label: "Name", Required: true, MaxLen: 5, Trim: true}
+
+	v, fe := rule.Apply("  主題  ")
+	assert.Nil(t, fe)
+	assert.Equal(t, "主題", v)
+
+	// Normalized to NFC
+	v, fe = rule.Apply("Cafe\u0301")
+	assert.Nil(t, fe)
+	assert.Equal(t, "Caf\u00e9", v)
+
+	tests := []struct {
+		value   string
+		message string
+	}{
+		{"", "Name is required"},
+		{" \t ", "Name is required"},
+		{"a\x00b", "Name has invalid characters"},
+		{"a\nb", "Name has invalid characters"},
+		{"a\u202eb", "Name has invalid characters"},
+		{"\xff", "Name is not valid UTF-8"},
+		{"abcdef", "Name over length"},
+	}
+	for _, test := range tests {
+		_, fe := rule.Apply(test.value)
+		assert.Equal(t, &FieldError{Field: "name", Message: test.message}, fe, test.value)
+	}
+
+	multiline := Rule{Field: "description", Label: "Description", MinLen: 2, Multiline: true}
+	_, fe = multiline.Apply("a\n\tb")
+	assert.Nil(t, fe)
+	_, fe = multiline.Apply("a")
+	assert.Equal(t, &FieldError{Field: "description", Message: "Description under length"}, fe)
+	_, fe = multiline.Apply("")
+	assert.Nil(t, fe)
+}
+
+func TestErrors(t *testing.T) {
+	var errs Errors
+	errs.Add("name", "Name is required")
+	errs.Add("url", "Invalid URL")
+	assert.EqualError(t, errs, "name: Name is required; url: Invalid URL")
+}
+
+func TestLoadRules(t *testing.T) {
+	rules, err := LoadRules(strings.NewReader(`[{"field": "name", "label": "Topic name", "required": true, "maxLen": 80, "trim": true}]`))
+	assert.Nil(t, err)
+	assert.Equal(t, Rules{"name": {Field: "name", Label: "Topic name", Required: true, MaxLen: 80, Trim: true}}, rules)
+
+	_, err = LoadRules(strings.NewReader(`[{"label": "No field"}]`))
+	assert.NotNil(t, err)
+	_, err = LoadRules(strings.NewReader(`[{"field": "name", "minLen": 10, "maxLen": 5}]`))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,167 @@
+// Package voter identifies anonymous voters by an HMAC-signed cookie.
+// The cookie holds a random voter id, the id of the signing key and the
+// signature, so that keys can be rotated: the first key signs new cookies,
+// the others are still accepted and their cookies are signed again.
+package voter
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CookieName is the name of the voter cookie
+	CookieName = "voter"
+	// cookieMaxAge is how long a browser keeps the voter cookie
+	cookieMaxAge = 365 * 24 * time.Hour
+)
+
+// ErrInvalidCookie means the cookie was not signed by a known key
+var ErrInvalidCookie = errors.New("invalid voter cookie")
+
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Key is a cookie signing key
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKeys parses signing keys given as "id:secret" pairs separated by
+// commas, the first key is the current one
+func ParseKeys(s string) ([]Key, error) {
+	var keys []Key
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.IndexByte(pair, ':')
+		if i < 0 {
+			return nil, fmt.Errorf("voter key %q is not an id:secret pair", pair)
+		}
+		keys = append(keys, Key{ID: pair[:i], Secret: []byte(pair[i+1:])})
+	}
+	return keys, nil
+}
+
+// Sessions signs and verifies voter cookies
+type Sessions struct {
+	keys []Key
+}
+
+// New creates Sessions signing with the first key and accepting all keys.
+// Without keys, a random key is generated, which forgets the voters when
+// the server restarts.
+func New(keys []Key) (*Sessions, error) {
+	if len(keys) == 0 {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		keys = []Key{{ID: "random", Secret: secret}}
+	}
+
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if !keyIDPattern.MatchString(key.ID) {
+			return nil, fmt.Errorf("invalid voter key id %q", key.ID)
+		}
+		if len(key.Secret) < 16 {
+			return nil, fmt.Errorf("voter key %q secret is shorter than 16 bytes", key.ID)
+		}
+		if seen[key.ID] {
+			return nil, fmt.Errorf("duplicate voter key id %q", key.ID)
+		}
+		seen[key.ID] = true
+	}
+	return &Sessions{keys: keys}, nil
+}
+
+// Sign returns the cookie value of the voter id, signed with the current key
+func (s *Sessions) Sign(id string) string {
+	key := s.keys[0]
+	return id + "." + key.ID + "." + sign(key, id)
+}
+
+// Parse verifies a cookie value and returns the voter id, and whether the
+// cookie is signed with the current key
+func (s *Sessions) Parse(value string) (string, bool, error) {
+	fields := strings.Split(value, ".")
+	if len(fields) != 3 || fields[0] == "" {
+		return "", false, ErrInvalidCookie
+	}
+	id, keyID, sig := fields[0], fields[1], fields[2]
+
+	for i, key := range s.keys {
+		if key.ID != keyID {
+			continue
+		}
+		if !hmac.Equal([]byte(sig), []byte(sign(key, id))) {
+			return "", false, ErrInvalidCookie
+		}
+		return id, i == 0, nil
+	}
+	return "", false, ErrInvalidCookie
+}
+
+// Get returns the voter id of the request cookie
+func (s *Sessions) Get(c *gin.Context) (string, bool) {
+	value, err := c.Cookie(CookieName)
+	if err != nil {
+		return "", false
+	}
+	id, _, err := s.Parse(value)
+	return id, err == nil
+}
+
+// Ensure returns the voter id of the request cookie. A new voter gets a
+// new cookie, a cookie signed with a former key is signed again.
+func (s *Sessions) Ensure(c *gin.Context) (string, error) {
+	if value, err := c.Cookie(CookieName); err == nil {
+		id, current, err := s.Parse(value)
+		if err == nil {
+			if !current {
+				s.setCookie(c, id)
+			}
+			return id, nil
+		}
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	id := hex.EncodeToString(b)
+	s.setCookie(c, id)
+	return id, nil
+}
+
+func (s *Sessions) setCookie(c *gin.Context, id string) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     CookieName,
+		Value:    s.Sign(id),
+		Path:     "/",
+		MaxAge:   int(cookieMaxAge / time.Second),
+		Secure:   c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func sign(key Key, id string) string {
+	mac := hmac.New(sha256.New, key.Secret)
+	mac.Write([]byte(key.ID + "." + id))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
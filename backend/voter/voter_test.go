@@ -0,0 +1,112 @@
+package voter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	oldKey = Key{ID: "k1", Secret: []byte("0123456789abcdef-old")}
+	newKey = Key{ID: "k2", Secret: []byte("0123456789abcdef-new")}
+)
+
+func TestParse(t *testing.T) {
+	old, err := New([]Key{oldKey})
+	assert.Nil(t, err)
+	rotated, err := New([]Key{newKey, oldKey})
+	assert.Nil(t, err)
+
+	value := old.Sign("voter1")
+	assert.True(t, strings.HasPrefix(value, "voter1.k1."))
+
+	id, current, err := old.Parse(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "voter1", id)
+	assert.True(t, current)
+
+	// A rotated key is still accepted
+	id, current, err = rotated.Parse(value)
+	assert.Nil(t, err)
+	assert.Equal(t, "voter1", id)
+	assert.False(t, current)
+
+	for _, value := range []string{
+		"",
+		"voter1",
+		"voter2" + value[len("voter1"):],
+		"voter1.k3." + strings.SplitN(value, ".", 3)[2],
+		value + "x",
+	} {
+		_, _, err := rotated.Parse(value)
+		assert.Equal(t, ErrInvalidCookie, err, value)
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	old, _ := New([]Key{oldKey})
+	rotated, _ := New([]Key{newKey, oldKey})
+
+	ensure := func(s *Sessions, cookie string) (string, []*http.Cookie) {
+		resp := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(resp)
+		c.Request, _ = http.NewRequest("GET", "/", nil)
+		if cookie != "" {
+			c.Request.AddCookie(&http.Cookie{Name: CookieName, Value: cookie})
+		}
+		id, err := s.Ensure(c)
+		assert.Nil(t, err)
+		return id, resp.Result().Cookies()
+	}
+
+	// A new visitor gets a cookie
+	id, cookies := ensure(old, "")
+	assert.Len(t, id, 32)
+	assert.Len(t, cookies, 1)
+	assert.True(t, cookies[0].HttpOnly)
+	value := cookies[0].Value
+
+	// A known visitor keeps the cookie
+	again, cookies := ensure(old, value)
+	assert.Equal(t, id, again)
+	assert.Empty(t, cookies)
+
+	// A cookie of a rotated key is signed again
+	again, cookies = ensure(rotated, value)
+	assert.Equal(t, id, again)
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, rotated.Sign(id), cookies[0].Value)
+
+	// A forged cookie is replaced
+	again, cookies = ensure(rotated, "forged.k2.sig")
+	assert.NotEqual(t, "forged", again)
+	assert.Len(t, cookies, 1)
+}
+
+func TestNew(t *testing.T) {
+	s, err := New(nil)
+	assert.Nil(t, err)
+	id, _, err := s.Parse(s.Sign("voter1"))
+	assert.Nil(t, err)
+	assert.Equal(t, "voter1", id)
+
+	for _, keys := range [][]Key{
+		{{ID: "k.1", Secret: oldKey.Secret}},
+		{{ID: "k1", Secret: []byte("short")}},
+		{oldKey, oldKey},
+	} {
+		_, err := New(keys)
+		assert.NotNil(t, err)
+	}
+
+	keys, err := ParseKeys(" k2:secret2, k1:sec:ret1,")
+	assert.Nil(t, err)
+	assert.Equal(t, []Key{{ID: "k2", Secret: []byte("secret2")}, {ID: "k1", Secret: []byte("sec:ret1")}}, keys)
+	_, err = ParseKeys("k1")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,416 @@
+// Package webhook delivers the topic events to outgoing webhooks. Payloads
+// are signed with HMAC-SHA256, failed deliveries are retried with
+// exponential backoff and end in a dead-letter list.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+)
+
+// TopicThreshold is delivered when the upvotes of a topic reach one of the
+// thresholds of a hook
+const TopicThreshold = "topic.threshold"
+
+// Delivery headers
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	TimestampHeader = "X-Webhook-Timestamp"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// deliverable are the event types hooks may subscribe to
+var deliverable = map[string]bool{
+	events.TopicCreated: true,
+	events.PollClosed:   true,
+	TopicThreshold:      true,
+}
+
+var (
+	// ErrDeadLetterNotFound is returned when redelivering an unknown dead letter
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrQueueFull is returned when the delivery queue has no room left
+	ErrQueueFull = errors.New("delivery queue full")
+)
+
+// Hook is an outgoing webhook
+type Hook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret"`
+	// Events are the delivered event types, empty delivers all of them
+	Events []string `json:"events,omitempty"`
+	// Thresholds are the upvote counts announced by a TopicThreshold event
+	Thresholds []uint64 `json:"thresholds,omitempty"`
+}
+
+// wants returns whether the hook subscribes to the event type typ
+func (h *Hook) wants(typ string) bool {
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Config are the webhook settings, durations are Go duration strings
+type Config struct {
+	Hooks []Hook `json:"hooks"`
+	// MaxAttempts is the number of attempts of a delivery
+	MaxAttempts int `json:"maxAttempts"`
+	// Backoff is the wait before the first retry, it doubles up to MaxBackoff
+	Backoff    string `json:"backoff"`
+	MaxBackoff string `json:"maxBackoff"`
+	// Timeout bounds each attempt
+	Timeout string `json:"timeout"`
+	// Queue is the number of deliveries waiting for a worker
+	Queue   int `json:"queue"`
+	Workers int `json:"workers"`
+	// DeadLetters is the number of dead letters kept, the oldest is dropped first
+	DeadLetters int `json:"deadLetters"`
+}
+
+// DefaultConfig returns the default settings, without hooks
+func DefaultConfig() Config {
+	return Config{
+		MaxAttempts: 5,
+		Backoff:     "1s",
+		MaxBackoff:  "1m",
+		Timeout:     "10s",
+		Queue:       1000,
+		Workers:     4,
+		DeadLetters: 1000,
+	}
+}
+
+// Delivery is an event on its way to a hook
+type Delivery struct {
+	ID    uuid.UUID    `json:"id"`
+	URL   string       `json:"url"`
+	Event events.Event `json:"event"`
+
+	hook int
+}
+
+// DeadLetter is a delivery which failed for good
+type DeadLetter struct {
+	Delivery
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error"`
+	Time     time.Time `json:"time"`
+}
+
+// Dispatcher delivers the events it handles to the hooks in the background.
+// Deliveries run concurrently, so a hook may receive events out of order.
+// It is safe for concurrent use.
+type Dispatcher struct {
+	// Now returns the current time, it is replaced by tests
+	Now func() time.Time
+
+	cfg        Config
+	backoff    time.Duration
+	maxBackoff time.Duration
+	client     *http.Client
+	queue      chan Delivery
+
+	mu      sync.Mutex
+	reached []map[uuid.UUID]uint64 // highest threshold announced per hook and topic
+	dead    []DeadLetter           // the newest last
+}
+
+// New returns a dispatcher with the configuration cfg
+func New(cfg Config) (*Dispatcher, error) {
+	d := &Dispatcher{Now: time.Now, cfg: cfg}
+
+	var err error
+	if d.backoff, err = time.ParseDuration(cfg.Backoff); err != nil || d.backoff <= 0 {
+		return nil, fmt.Errorf("invalid webhook backoff %q", cfg.Backoff)
+	}
+	if d.maxBackoff, err = time.ParseDuration(cfg.MaxBackoff); err != nil || d.maxBackoff < d.backoff {
+		return nil, fmt.Errorf("invalid webhook max backoff %q", cfg.MaxBackoff)
+	}
+	timeout, err := time.ParseDuration(cfg.Timeout)
+	if err != nil || timeout <= 0 {
+		return nil, fmt.Errorf("invalid webhook timeout %q", cfg.Timeout)
+	}
+	if cfg.MaxAttempts < 1 || cfg.Queue < 1 || cfg.Workers < 1 || cfg.DeadLetters < 1 {
+		return nil, errors.New("webhook maxAttempts, queue, workers and deadLetters must be positive")
+	}
+
+	for i := range cfg.Hooks {
+		h := &cfg.Hooks[i]
+		if u, err := url.Parse(h.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid webhook url %q", h.URL)
+		}
+		if h.Secret == "" {
+			return nil, fmt.Errorf("webhook %v has no secret", h.URL)
+		}
+		for _, e := range h.Events {
+			if !deliverable[e] {
+				return nil, fmt.Errorf("invalid webhook %v event %q", h.URL, e)
+			}
+		}
+		for _, threshold := range h.Thresholds {
+			if threshold == 0 {
+				return nil, fmt.Errorf("invalid webhook %v threshold 0", h.URL)
+			}
+		}
+		h.Thresholds = append([]uint64(nil), h.Thresholds...)
+		sort.Slice(h.Thresholds, func(i, j int) bool { return h.Thresholds[i] < h.Thresholds[j] })
+
+		d.reached = append(d.reached, make(map[uuid.UUID]uint64))
+	}
+
+	d.client = &http.Client{Timeout: timeout}
+	d.queue = make(chan Delivery, cfg.Queue)
+	return d, nil
+}
+
+// Load reads a Dispatcher configuration, missing settings keep their defaults
+func Load(r io.Reader) (*Dispatcher, error) {
+	cfg := DefaultConfig()
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
+		return nil, err
+	}
+	return New(cfg)
+}
+
+// LoadFile reads a Dispatcher configuration JSON file
+func LoadFile(path string) (*Dispatcher, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Load(f)
+}
+
+// Hooks returns the number of hooks
+func (d *Dispatcher) Hooks() int {
+	return len(d.cfg.Hooks)
+}
+
+// Handle queues the deliveries of event e, it never blocks. TopicVoted
+// events carrying the voted topic become TopicThreshold events.
+func (d *Dispatcher) Handle(e events.Event) {
+	for i := range d.cfg.Hooks {
+		h := &d.cfg.Hooks[i]
+		if e.Type == events.TopicVoted {
+			if threshold, ok := d.reach(i, e); ok && h.wants(TopicThreshold) {
+				topic := e.Data.(*cache.Topic)
+				d.enqueue(i, events.New(TopicThreshold, e.Topic, thresholdData{Topic: topic, Threshold: threshold}))
+			}
+			continue
+		}
+		if deliverable[e.Type] && h.wants(e.Type) {
+			d.enqueue(i, e)
+		}
+	}
+}
+
+// thresholdData is the data of a TopicThreshold event
+type thresholdData struct {
+	Topic     *cache.Topic `json:"topic"`
+	Threshold uint64       `json:"threshold"`
+}
+
+// reach returns the highest threshold of hook i reached by the topic voted
+// in event e, unless it was announced already
+func (d *Dispatcher) reach(i int, e events.Event) (uint64, bool) {
+	topic, ok := e.Data.(*cache.Topic)
+	if !ok {
+		return 0, false
+	}
+
+	thresholds := d.cfg.Hooks[i].Thresholds
+	n := sort.Search(len(thresholds), func(j int) bool { return thresholds[j] > topic.Upvote })
+	if n == 0 {
+		return 0, false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.reached[i][e.Topic] >= thresholds[n-1] {
+		return 0, false
+	}
+	d.reached[i][e.Topic] = thresholds[n-1]
+	return thresholds[n-1], true
+}
+
+// enqueue queues the delivery of event e to hook i, or dead-letters it
+// when the queue is full
+func (d *Dispatcher) enqueue(i int, e events.Event) {
+	delivery := Delivery{ID: uuid.New(), URL: d.cfg.Hooks[i].URL, Event: e, hook: i}
+	if err := d.push(delivery); err != nil {
+		d.bury(delivery, 0, err)
+	}
+}
+
+// push queues a delivery without blocking
+func (d *Dispatcher) push(delivery Delivery) error {
+	select {
+	case d.queue <- delivery:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Run delivers the queued events until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for w := 0; w < d.cfg.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case delivery := <-d.queue:
+					d.deliver(ctx, delivery)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// deliver attempts a delivery until it succeeds, fails for good or ctx is
+// done. Failed deliveries are dead-lettered.
+func (d *Dispatcher) deliver(ctx context.Context, delivery Delivery) {
+	wait := d.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.send(ctx, delivery)
+		if err == nil {
+			return
+		}
+		if !retry || attempt == d.cfg.MaxAttempts {
+			d.bury(delivery, attempt, err)
+			return
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			d.bury(delivery, attempt, err)
+			return
+		case <-timer.C:
+		}
+		if wait *= 2; wait > d.maxBackoff {
+			wait = d.maxBackoff
+		}
+	}
+}
+
+// send posts a delivery once, it returns whether a failure may be retried.
+// Network errors, timeouts, 408, 429 and 5xx responses are retried.
+func (d *Dispatcher) send(ctx context.Context, delivery Delivery) (bool, error) {
+	body, err := json.Marshal(delivery.Event)
+	if err != nil {
+		return false, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(d.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event.Type)
+	req.Header.Set(DeliveryHeader, delivery.ID.String())
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Hooks[delivery.hook].Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("unexpected status %v", resp.Status)
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests
+	return retry, err
+}
+
+// Sign returns the signature header value of a payload sent at the unix
+// timestamp: "sha256=" and the hex HMAC-SHA256 of the timestamp, a dot and
+// the body, keyed by the hook secret
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// bury adds a failed delivery to the dead letters
+func (d *Dispatcher) bury(delivery Delivery, attempts int, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.dead) == d.cfg.DeadLetters {
+		d.dead = append(d.dead[:0], d.dead[1:]...)
+	}
+	d.dead = append(d.dead, DeadLetter{Delivery: delivery, Attempts: attempts, Error: err.Error(), Time: d.Now().UTC()})
+}
+
+// DeadLetters returns the dead letters, the newest first
+func (d *Dispatcher) DeadLetters() []DeadLetter {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dead := make([]DeadLetter, 0, len(d.dead))
+	for i := len(d.dead) - 1; i >= 0; i-- {
+		dead = append(dead, d.dead[i])
+	}
+	return dead
+}
+
+// Redeliver queues a dead letter again and removes it from the dead letters
+func (d *Dispatcher) Redeliver(id uuid.UUID) (DeadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for i, letter := range d.dead {
+		if letter.ID != id {
+			continue
+		}
+		if err := d.push(letter.Delivery); err != nil {
+			return DeadLetter{}, err
+		}
+		d.dead = append(d.dead[:i], d.dead[i+1:]...)
+		return letter, nil
+	}
+	return DeadLetter{}, ErrDeadLetterNotFound
+}
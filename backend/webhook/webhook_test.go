@@ -0,0 +1,228 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/events"
+)
+
+// receiver is a webhook endpoint answering with the given statuses in turn,
+// then 200
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	attempts int
+	received []events.Event
+	done     chan struct{}
+}
+
+func newReceiver(t *testing.T, secret string, statuses ...int) *receiver {
+	r := &receiver{statuses: statuses, done: make(chan struct{}, 100)}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		assert.Equal(t, Sign(secret, req.Header.Get(TimestampHeader), body), req.Header.Get(SignatureHeader))
+		assert.NotEmpty(t, req.Header.Get(DeliveryHeader))
+
+		r.mu.Lock()
+		status := http.StatusOK
+		if r.attempts < len(r.statuses) {
+			status = r.statuses[r.attempts]
+		}
+		r.attempts++
+		if status == http.StatusOK {
+			var e events.Event
+			assert.Nil(t, json.Unmarshal(body, &e))
+			assert.Equal(t, e.Type, req.Header.Get(EventHeader))
+			r.received = append(r.received, e)
+		}
+		r.mu.Unlock()
+
+		w.WriteHeader(status)
+		r.done <- struct{}{}
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// wait waits for n requests
+func (r *receiver) wait(t *testing.T, n int) {
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for request %d of %d", i+1, n)
+		}
+	}
+}
+
+func (r *receiver) events() []events.Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]events.Event(nil), r.received...)
+}
+
+func newDispatcher(t *testing.T, hooks ...Hook) *Dispatcher {
+	cfg := DefaultConfig()
+	cfg.Hooks = hooks
+	cfg.MaxAttempts = 3
+	cfg.Backoff = "1ms"
+	cfg.MaxBackoff = "2ms"
+	d, err := New(cfg)
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go d.Run(ctx)
+	return d
+}
+
+// waitDead waits until d has n dead letters
+func waitDead(t *testing.T, d *Dispatcher, n int) []DeadLetter {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if dead := d.DeadLetters(); len(dead) == n {
+			return dead
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("Timed out waiting for %d dead letters", n)
+	return nil
+}
+
+func TestDeliverFiltered(t *testing.T) {
+	created := newReceiver(t, "s1")
+	all := newReceiver(t, "s2")
+	d := newDispatcher(t,
+		Hook{URL: created.URL, Secret: "s1", Events: []string{events.TopicCreated}},
+		Hook{URL: all.URL, Secret: "s2"})
+
+	topic := &cache.Topic{UID: uuid.New(), Name: "Webhook"}
+	e1 := events.New(events.TopicCreated, topic.UID, topic)
+	e2 := events.New(events.PollClosed, topic.UID, topic)
+	d.Handle(e1)
+	d.Handle(e2)
+	// Votes without thresholds are not delivered
+	d.Handle(events.New(events.TopicVoted, topic.UID, topic))
+
+	created.wait(t, 1)
+	all.wait(t, 2)
+	assert.Len(t, created.events(), 1)
+	assert.Equal(t, e1.ID, created.events()[0].ID)
+	assert.ElementsMatch(t, []uuid.UUID{e1.ID, e2.ID}, []uuid.UUID{all.events()[0].ID, all.events()[1].ID})
+	assert.Empty(t, d.DeadLetters())
+}
+
+func TestDeliverThresholds(t *testing.T) {
+	r := newReceiver(t, "secret")
+	d := newDispatcher(t, Hook{URL: r.URL, Secret: "secret", Thresholds: []uint64{100, 10}})
+
+	topic := &cache.Topic{UID: uuid.New(), Name: "Popular"}
+	for _, upvote := range []uint64{9, 10, 11, 150, 99, 200} {
+		d.Handle(events.New(events.TopicVoted, topic.UID, &cache.Topic{UID: topic.UID, Name: topic.Name, Upvote: upvote}))
+	}
+
+	// Each threshold is announced once, when reached
+	r.wait(t, 2)
+	var thresholds []float64
+	for _, e := range r.events() {
+		assert.Equal(t, TopicThreshold, e.Type)
+		assert.Equal(t, topic.UID, e.Topic)
+		thresholds = append(thresholds, e.Data.(map[string]interface{})["threshold"].(float64))
+	}
+	assert.ElementsMatch(t, []float64{10, 100}, thresholds)
+}
+
+func TestRetryAndDeadLetter(t *testing.T) {
+	flaky := newReceiver(t, "secret", http.StatusInternalServerError, http.StatusTooManyRequests)
+	down := newReceiver(t, "secret", http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway)
+	rejecting := newReceiver(t, "secret", http.StatusBadRequest)
+	d := newDispatcher(t,
+		Hook{URL: flaky.URL, Secret: "secret"},
+		Hook{URL: down.URL, Secret: "secret"},
+		Hook{URL: rejecting.URL, Secret: "secret"})
+
+	e := events.New(events.TopicCreated, uuid.New(), nil)
+	d.Handle(e)
+
+	// Retried until delivered
+	flaky.wait(t, 3)
+	assert.Len(t, flaky.events(), 1)
+
+	// Retried up to the max attempts, client errors are not retried
+	down.wait(t, 3)
+	rejecting.wait(t, 1)
+	dead := waitDead(t, d, 2)
+	attempts := map[string]int{}
+	for _, letter := range dead {
+		assert.Equal(t, e.ID, letter.Event.ID)
+		attempts[letter.URL] = letter.Attempts
+	}
+	assert.Equal(t, map[string]int{down.URL: 3, rejecting.URL: 1}, attempts)
+	assert.Contains(t, dead[0].Error, "unexpected status")
+
+	// The endpoint recovered
+	letter, err := d.Redeliver(dead[0].ID)
+	assert.Nil(t, err)
+	assert.Equal(t, dead[0].ID, letter.ID)
+	waitDead(t, d, 1)
+
+	_, err = d.Redeliver(dead[0].ID)
+	assert.Equal(t, ErrDeadLetterNotFound, err)
+}
+
+func TestQueueFull(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Hooks = []Hook{{URL: "http://example.com/hook", Secret: "secret"}}
+	cfg.Queue = 1
+	d, err := New(cfg)
+	assert.Nil(t, err)
+
+	// Not running, the second delivery finds the queue full
+	d.Handle(events.New(events.TopicCreated, uuid.New(), nil))
+	d.Handle(events.New(events.TopicCreated, uuid.New(), nil))
+
+	dead := d.DeadLetters()
+	assert.Len(t, dead, 1)
+	assert.Equal(t, 0, dead[0].Attempts)
+	assert.Equal(t, ErrQueueFull.Error(), dead[0].Error)
+
+	_, err = d.Redeliver(dead[0].ID)
+	assert.Equal(t, ErrQueueFull, err)
+	assert.Len(t, d.DeadLetters(), 1)
+}
+
+func TestLoad(t *testing.T) {
+	d, err := Load(strings.NewReader(`{"hooks": [{"url": "https://example.com/hook", "secret": "s", "events": ["topic.threshold"], "thresholds": [5]}], "maxAttempts": 2}`))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, d.Hooks())
+	assert.Equal(t, 2, d.cfg.MaxAttempts)
+	assert.Equal(t, time.Second, d.backoff)
+
+	for _, input := range []string{
+		`{"hooks": [{"url": "ftp://example.com", "secret": "s"}]}`,
+		`{"hooks": [{"url": "https://example.com"}]}`,
+		`{"hooks": [{"url": "https://example.com", "secret": "s", "events": ["topic.voted"]}]}`,
+		`{"hooks": [{"url": "https://example.com", "secret": "s", "thresholds": [0]}]}`,
+		`{"backoff": "soon"}`,
+		`{"backoff": "1m", "maxBackoff": "1s"}`,
+		`{"workers": 0}`,
+		`[`,
+	} {
+		_, err := Load(strings.NewReader(input))
+		assert.NotNil(t, err, input)
+	}
+}
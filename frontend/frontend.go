@@ -1,26 +1,106 @@
 package frontend
 
 import (
+	"html/template"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang/glog"
+	"github.com/google/uuid"
 	"github.com/jenting/voting-topic/backend/cache"
+	"github.com/jenting/voting-topic/backend/markdown"
+	"github.com/jenting/voting-topic/backend/voter"
 )
 
+// Number of topics listed in each section of the homepage.
+const maxListedTopics = 20
+
+// topicRow is a topic on the homepage with the visitor's vote on it,
+// "up", "down" or empty, and why it is not open for voting.
+type topicRow struct {
+	cache.Topic
+	Voted  string
+	Closed string
+}
+
+// boardSection is a board with its top topics on the homepage.
+type boardSection struct {
+	Board  cache.Board
+	Topics []topicRow
+}
+
+// voterSessions issues the voter cookies, nil disables them.
+var voterSessions *voter.Sessions
+
+// SetVoterSessions sets the voter cookie sessions, nil disables them.
+// It is not safe to call while serving.
+func SetVoterSessions(s *voter.Sessions) {
+	voterSessions = s
+}
+
 // SetupFrontend setup frontend routes.
 func SetupFrontend(router *gin.Engine) {
 	// Create route
 	router.GET("/", renderHTML)
 
+	// Topic descriptions are Markdown, rendered to sanitized HTML.
+	router.SetFuncMap(template.FuncMap{"markdown": markdown.Render})
 	router.LoadHTMLFiles("./frontend/index.html")
 }
 
 func renderHTML(c *gin.Context) {
+	// Identify the visitor to show the topics already voted on
+	var votes map[uuid.UUID]bool
+	if voterSessions != nil {
+		id, err := voterSessions.Ensure(c)
+		if err != nil {
+			glog.Errorf("Issue voter cookie err: %v", err)
+		} else {
+			votes = cache.GetVoterVotes(id)
+		}
+	}
+
+	boards := cache.ListBoards()
+	sections := make([]boardSection, len(boards))
+	for i, b := range boards {
+		sections[i] = boardSection{Board: b, Topics: topicRows(cache.GetTopicDescendUpvote(cache.InBoard(b.ID)), votes)}
+	}
+
+	// Board topics are listed in their board section only
+	topTopics := topicRows(cache.GetTopicDescendUpvote(cache.InBoard("")), votes)
+
 	// Display homepage
 	c.HTML(http.StatusOK, "index.html",
 		gin.H{
 			"title":     "Hola cómo estás",
-			"toptopics": cache.GetTopicDescendUpvote(),
+			"toptopics": topTopics,
+			"boards":    sections,
 		},
 	)
 }
+
+// topicRows returns the first topics to list with the visitor's votes
+func topicRows(topics cache.TopicListUpvote, votes map[uuid.UUID]bool) []topicRow {
+	if len(topics) > maxListedTopics {
+		topics = topics[:maxListedTopics]
+	}
+
+	now := time.Now()
+	rows := make([]topicRow, len(topics))
+	for i, t := range topics {
+		rows[i].Topic = t
+		switch t.CheckOpen(now) {
+		case cache.ErrPollNotOpen:
+			rows[i].Closed = "Not open yet"
+		case cache.ErrPollClosed:
+			rows[i].Closed = "Closed, final results"
+		}
+		if up, ok := votes[t.UID]; ok && up {
+			rows[i].Voted = "up"
+		} else if ok {
+			rows[i].Voted = "down"
+		}
+	}
+	return rows
+}
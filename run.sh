@@ -7,4 +7,4 @@ make clean
 make all
 
 ## run binary
-./voting-topic
+./voting-topic -fixtures fixtures/topics.json